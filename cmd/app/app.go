@@ -1,15 +1,26 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"dev-challenge/internal/cell"
 	"dev-challenge/internal/database"
+	"dev-challenge/internal/evaluator"
+	"dev-challenge/internal/events"
+	"dev-challenge/internal/external"
+	"dev-challenge/internal/function"
+	"dev-challenge/internal/presence"
 	"dev-challenge/internal/router"
 	"dev-challenge/internal/sheet"
 	"log"
 	"net/http"
+	"time"
 
 	_ "github.com/lib/pq"
 )
@@ -34,8 +45,22 @@ func main() {
 
 	server := App(db)
 
+	// background jobs of the app stop once the server has been shut down
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-shutdown
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Println(err)
+		}
+	}()
+
 	log.Println("Starting server...")
-	server.ListenAndServe()
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Println(err)
+	}
 }
 
 func App(db *sql.DB) *http.Server {
@@ -43,13 +68,63 @@ func App(db *sql.DB) *http.Server {
 	cellRepo := database.NewCellRepository(db)
 	cellRepo.CreateTableIfNotExists()
 
-	cellService := cell.NewService(cellRepo)
+	nameRepo := database.NewNameRepository(db)
+	nameRepo.CreateTableIfNotExists()
+
+	functionRepo := database.NewFunctionRepository(db)
+	functionRepo.CreateTableIfNotExists()
+
+	eventBus := events.NewBus()
+
+	cellService := cell.NewService(cellRepo, nameRepo, eventBus)
 	sheetService := sheet.NewService(cellService)
 
-	router := router.New(sheetService, cellService)
+	// closed when the server is shut down, see below
+	stop := make(chan struct{})
+
+	// results of TODAY(), NOW() and RAND() change without any cell being written
+	go cellService.RefreshVolatile(time.Minute, stop)
+
+	functionService := function.NewService(functionRepo, cellService)
+	if err := functionService.Load(); err != nil {
+		log.Println(err)
+	}
+
+	presenceTracker := presence.NewTracker()
 
-	return &http.Server{
+	// remote servers notify this one about changes of cells referenced
+	// with EXTERNAL_REF only if it knows the url it is reachable at
+	webhookURL := ""
+	if publicURL := os.Getenv("PUBLIC_URL"); publicURL != "" {
+		webhookURL = strings.TrimRight(publicURL, "/") + "/api/v1/external/webhook"
+	}
+
+	// instances of the service deployed within a private network reference each other's
+	// cells by private addresses, which are refused by default to prevent requests to
+	// internal services on behalf of formulas and subscribers
+	allowPrivate := os.Getenv("EXTERNAL_ALLOW_PRIVATE") == "true"
+
+	externalClient := external.NewClient(5*time.Second, time.Minute, webhookURL, allowPrivate)
+	evaluator.RegisterFunction(external.FunctionName, externalClient.Function())
+
+	notifier := external.NewNotifier(5*time.Second, external.SubscriptionTTL, allowPrivate)
+	go notifier.Listen(eventBus, stop)
+
+	// pages served from other origins may open websockets only if they are listed
+	allowedOrigins := make([]string, 0)
+	for _, origin := range strings.Split(os.Getenv("WS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			allowedOrigins = append(allowedOrigins, origin)
+		}
+	}
+
+	router := router.New(sheetService, cellService, functionService, eventBus, presenceTracker, externalClient, notifier, allowedOrigins)
+
+	server := &http.Server{
 		Addr:    ":8080",
 		Handler: router,
 	}
+	server.RegisterOnShutdown(func() { close(stop) })
+
+	return server
 }
@@ -1,20 +1,37 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"database/sql"
+	"dev-challenge/internal/websocket"
+	"dev-challenge/internal/xlsx"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
-func newTestServer(db *sql.DB) *httptest.Server {
+func newTestServer(t *testing.T, db *sql.DB) *httptest.Server {
+	ts := httptest.NewUnstartedServer(nil)
+	// the app references and subscribes to its own cells in the external reference tests
+	t.Setenv("PUBLIC_URL", "http://"+ts.Listener.Addr().String())
+	t.Setenv("EXTERNAL_ALLOW_PRIVATE", "true")
+
 	server := App(db)
-	return httptest.NewServer(server.Handler)
+	// stops the background jobs of the app
+	t.Cleanup(func() { server.Shutdown(context.Background()) })
+
+	ts.Config.Handler = server.Handler
+	ts.Start()
+	return ts
 }
 
 func TestApp_Integration(t *testing.T) {
@@ -35,7 +52,7 @@ func TestApp_Integration(t *testing.T) {
 		panic(err)
 	}
 
-	ts := newTestServer(db)
+	ts := newTestServer(t, db)
 	defer ts.Close()
 
 	t.Run("cell not found", func(t *testing.T) {
@@ -246,4 +263,1465 @@ func TestApp_Integration(t *testing.T) {
 			}
 		})
 	})
+
+	t.Run("sheet events", func(t *testing.T) {
+		sheetID := "sheet_events"
+
+		reqCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, fmt.Sprintf("%s/api/v1/%s/events", ts.URL, sheetID), nil)
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		stream, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+		defer stream.Body.Close()
+
+		if stream.StatusCode != http.StatusOK {
+			t.Fatalf("want (%v) got (%v)", http.StatusOK, stream.StatusCode)
+		}
+
+		body := bytes.NewBufferString("{\"value\": \"1+2\"}")
+		resp, err := http.Post(fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, sheetID, "cell_events"), "application/json", body)
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("want (%v) got (%v)", http.StatusCreated, resp.StatusCode)
+		}
+
+		scanner := bufio.NewScanner(stream.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+
+			event := struct {
+				Type   string `json:"type"`
+				CellID string `json:"cell_id"`
+				Result string `json:"result"`
+			}{}
+
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				t.Fatalf("could not decode an event: %v", err)
+			}
+
+			if event.Type != "cell_created" || event.CellID != "cell_events" || event.Result != "3" {
+				t.Fatalf("unexpected event (%+v)", event)
+			}
+			return
+		}
+
+		t.Fatalf("stream closed before an event was received: %v", scanner.Err())
+	})
+
+	t.Run("sheet socket", func(t *testing.T) {
+		sheetID := "sheet_socket"
+
+		conn, err := websocket.Dial(fmt.Sprintf("ws%s/api/v1/%s/ws?user=alice", strings.TrimPrefix(ts.URL, "http"), sheetID))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+		defer conn.Close()
+
+		type message struct {
+			Type    string `json:"type"`
+			ID      string `json:"id"`
+			Result  string `json:"result"`
+			Message string `json:"message"`
+		}
+
+		// waits for a message of the given type skipping all the others
+		receive := func(messageType string) message {
+			for {
+				data, err := conn.ReadMessage()
+				if err != nil {
+					t.Fatalf("expected no error, got (%v)", err)
+				}
+
+				m := message{}
+				if err := json.Unmarshal(data, &m); err != nil {
+					t.Fatalf("could not decode a message: %v", err)
+				}
+
+				if m.Type == messageType {
+					return m
+				}
+			}
+		}
+
+		if err := conn.WriteMessage([]byte(`{"type": "edit", "id": "1", "cell_id": "cell_socket", "value": "2*3"}`)); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if ack := receive("ack"); ack.ID != "1" || ack.Result != "6" {
+			t.Fatalf("unexpected acknowledgement (%+v)", ack)
+		}
+
+		if err := conn.WriteMessage([]byte(`{"type": "edit", "id": "2", "cell_id": "cell_socket", "value": "2*"}`)); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if e := receive("error"); e.ID != "2" || e.Message != "invalid operation" {
+			t.Fatalf("unexpected error (%+v)", e)
+		}
+
+		// ids which could not be requested over http are rejected like there
+		for _, cellID := range []string{"events", "a b"} {
+			if err := conn.WriteMessage([]byte(fmt.Sprintf(`{"type": "edit", "id": "3", "cell_id": "%s", "value": "1"}`, cellID))); err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			if e := receive("error"); e.ID != "3" || !strings.HasPrefix(e.Message, "invalid cell id") {
+				t.Fatalf("%s: unexpected error (%+v)", cellID, e)
+			}
+		}
+	})
+
+	t.Run("conditional requests", func(t *testing.T) {
+		cellURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_conditional", "cell_conditional")
+
+		post := func(value, ifMatch string) *http.Response {
+			req, err := http.NewRequest(http.MethodPost, cellURL, bytes.NewBufferString(fmt.Sprintf("{\"value\": \"%s\"}", value)))
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+			if ifMatch != "" {
+				req.Header.Set("If-Match", ifMatch)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+			return resp
+		}
+
+		resp := post("1", "")
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("want (%v) got (%v)", http.StatusCreated, resp.StatusCode)
+		}
+		etag := resp.Header.Get("ETag")
+
+		if resp := post("2", etag); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("want (%v) got (%v)", http.StatusCreated, resp.StatusCode)
+		}
+
+		// the first etag is stale now
+		if resp := post("3", etag); resp.StatusCode != http.StatusPreconditionFailed {
+			t.Fatalf("want (%v) got (%v)", http.StatusPreconditionFailed, resp.StatusCode)
+		}
+
+		// a cell created again with the same id does not match the etags of the former one
+		resp = post("4", "")
+		etag = resp.Header.Get("ETag")
+
+		renameURL := fmt.Sprintf("%s/api/v1/%s/%s/rename", ts.URL, "sheet_conditional", "cell_conditional")
+		resp, err := http.Post(renameURL, "application/json", bytes.NewBufferString("{\"cell_id\": \"cell_moved\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("want (%v) got (%v)", http.StatusOK, resp.StatusCode)
+		}
+
+		for _, value := range []string{"5", "6", "7"} {
+			if resp := post(value, ""); resp.StatusCode != http.StatusCreated {
+				t.Fatalf("want (%v) got (%v)", http.StatusCreated, resp.StatusCode)
+			}
+		}
+
+		if resp := post("8", etag); resp.StatusCode != http.StatusPreconditionFailed {
+			t.Fatalf("want (%v) got (%v)", http.StatusPreconditionFailed, resp.StatusCode)
+		}
+
+		resp, err = http.Get(fmt.Sprintf("%s/api/v1/%s", ts.URL, "sheet_conditional"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/%s", ts.URL, "sheet_conditional"), nil)
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+		req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusNotModified {
+			t.Fatalf("want (%v) got (%v)", http.StatusNotModified, resp.StatusCode)
+		}
+	})
+
+	t.Run("csv import and export", func(t *testing.T) {
+		sheetURL := fmt.Sprintf("%s/api/v1/%s", ts.URL, "sheet_csv")
+
+		resp, err := http.Post(sheetURL+"/import", "text/csv", bytes.NewBufferString("=B1*2,3\n=A1+B1,\n"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("want (%v) got (%v)", http.StatusOK, resp.StatusCode)
+		}
+
+		report := struct {
+			Imported int `json:"imported"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if report.Imported != 3 {
+			t.Fatalf("want (3) got (%v)", report.Imported)
+		}
+
+		resp, err = http.Get(sheetURL + "/export.csv")
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("want (%v) got (%v)", http.StatusOK, resp.StatusCode)
+		}
+
+		want := "6,3\n9,\n"
+		got := new(strings.Builder)
+		if _, err := io.Copy(got, resp.Body); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if got.String() != want {
+			t.Fatalf("want (%q) got (%q)", want, got.String())
+		}
+	})
+
+	t.Run("xlsx import and export", func(t *testing.T) {
+		workbook := xlsx.Workbook{
+			Sheets: []xlsx.Worksheet{
+				{
+					Name: "Sheet XLSX",
+					Cells: []xlsx.Cell{
+						{Ref: "A1", Value: "4", Number: true},
+						{Ref: "B1", Formula: "A1*2"},
+						{Ref: "C1", Formula: "NPV(0.1, A1:B1)"},
+						{Ref: "D1", Value: "say \"hi\""},
+					},
+				},
+			},
+		}
+
+		buffer := bytes.Buffer{}
+		if err := xlsx.Write(&buffer, workbook); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		resp, err := http.Post(fmt.Sprintf("%s/api/v1/import.xlsx", ts.URL), "application/octet-stream", &buffer)
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("want (%v) got (%v)", http.StatusOK, resp.StatusCode)
+		}
+
+		report := struct {
+			Sheets map[string]struct {
+				Imported int `json:"imported"`
+				Errors   []struct {
+					CellID string `json:"cell_id"`
+				} `json:"errors"`
+			} `json:"sheets"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		sheetReport := report.Sheets["sheet_xlsx"]
+		if sheetReport.Imported != 3 || len(sheetReport.Errors) != 1 || sheetReport.Errors[0].CellID != "c1" {
+			t.Fatalf("unexpected import report (%+v)", report)
+		}
+
+		resp, err = http.Get(fmt.Sprintf("%s/api/v1/sheet_xlsx/d1", ts.URL))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		cellBody := struct {
+			Value  string `json:"value"`
+			Result string `json:"result"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&cellBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if cellBody.Value != "=\"say \"\"hi\"\"\"" || cellBody.Result != "say \"hi\"" {
+			t.Fatalf("unexpected cell (%+v)", cellBody)
+		}
+
+		resp, err = http.Get(fmt.Sprintf("%s/api/v1/sheet_xlsx/export.xlsx", ts.URL))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		exported, err := xlsx.Read(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		cells := exported.Sheets[0].Cells
+		if len(cells) != 3 || cells[1].Formula != "A1*2" || cells[1].Value != "8" {
+			t.Fatalf("unexpected exported cells (%+v)", cells)
+		}
+	})
+
+	t.Run("snapshot and restore", func(t *testing.T) {
+		sourceURL := fmt.Sprintf("%s/api/v1/%s", ts.URL, "sheet_snapshot_source")
+		targetURL := fmt.Sprintf("%s/api/v1/%s", ts.URL, "sheet_snapshot_target")
+
+		if _, err := http.Post(sourceURL+"/a1", "application/json", bytes.NewBufferString("{\"value\": \"3\"}")); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+		if _, err := http.Post(sourceURL+"/b1", "application/json", bytes.NewBufferString("{\"value\": \"=A1*3\"}")); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		resp, err := http.Get(sourceURL + "/snapshot")
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("want (%v) got (%v)", http.StatusOK, resp.StatusCode)
+		}
+
+		snapshot, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		req, err := http.NewRequest(http.MethodPut, targetURL+"/snapshot", bytes.NewReader(snapshot))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("want (%v) got (%v)", http.StatusOK, resp.StatusCode)
+		}
+
+		resp, err = http.Get(targetURL + "/b1")
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		respBody := struct {
+			Result string `json:"result"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if respBody.Result != "9" {
+			t.Fatalf("want (9) got (%v)", respBody.Result)
+		}
+	})
+
+	t.Run("cross-sheet references", func(t *testing.T) {
+		budgetURL := fmt.Sprintf("%s/api/v1/%s", ts.URL, "sheet_budget")
+		reportURL := fmt.Sprintf("%s/api/v1/%s", ts.URL, "sheet_report")
+
+		if _, err := http.Post(budgetURL+"/total", "application/json", bytes.NewBufferString("{\"value\": \"100\"}")); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+		if _, err := http.Post(reportURL+"/tax", "application/json", bytes.NewBufferString("{\"value\": \"=sheet_budget!total * 0.2\"}")); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		// an edit in the budget recalculates the report
+		if _, err := http.Post(budgetURL+"/total", "application/json", bytes.NewBufferString("{\"value\": \"200\"}")); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		resp, err := http.Get(reportURL + "/tax")
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		respBody := struct {
+			Result string `json:"result"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if respBody.Result != "40" {
+			t.Fatalf("want (40) got (%v)", respBody.Result)
+		}
+	})
+
+	t.Run("external references", func(t *testing.T) {
+		remoteURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_remote", "rate")
+		localURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_local", "price")
+
+		if _, err := http.Post(remoteURL, "application/json", bytes.NewBufferString("{\"value\": \"2\"}")); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		body, _ := json.Marshal(map[string]string{"value": fmt.Sprintf("=EXTERNAL_REF(\"%s\") * 10", remoteURL)})
+		resp, err := http.Post(localURL, "application/json", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("want (%d) got (%d)", http.StatusCreated, resp.StatusCode)
+		}
+
+		// notifications which are not signed for a subscription are refused
+		notification, _ := json.Marshal(map[string]string{"url": remoteURL})
+		resp, err = http.Post(ts.URL+"/api/v1/external/webhook", "application/json", bytes.NewBuffer(notification))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("want (%d) got (%d)", http.StatusForbidden, resp.StatusCode)
+		}
+
+		if _, err := http.Post(remoteURL, "application/json", bytes.NewBufferString("{\"value\": \"3\"}")); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		// the app has subscribed to the remote cell and is notified with its webhook
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			resp, err = http.Get(localURL)
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			respBody := struct {
+				Result string `json:"result"`
+			}{}
+
+			if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+				t.Fatalf("could not decode a response body: %v", err)
+			}
+
+			if respBody.Result == "30" {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("want (30) got (%v)", respBody.Result)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	})
+
+	t.Run("named definitions", func(t *testing.T) {
+		sheetURL := fmt.Sprintf("%s/api/v1/%s", ts.URL, "sheet_names")
+
+		requests := []struct {
+			path  string
+			value string
+		}{
+			{path: "/a1", value: "10"},
+			{path: "/a2", value: "20"},
+			{path: "/names/tax_rate", value: "0.5"},
+			{path: "/names/sales", value: "A1:A2"},
+			{path: "/total", value: "=SUM(sales) * (1 + tax_rate)"},
+		}
+
+		for _, r := range requests {
+			resp, err := http.Post(sheetURL+r.path, "application/json", bytes.NewBufferString(fmt.Sprintf("{\"value\": \"%s\"}", r.value)))
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("%s: want (%d) got (%d)", r.path, http.StatusCreated, resp.StatusCode)
+			}
+		}
+
+		// a change of the definition recalculates cells using the name
+		if _, err := http.Post(sheetURL+"/names/tax_rate", "application/json", bytes.NewBufferString("{\"value\": \"1\"}")); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		resp, err := http.Get(sheetURL + "/total")
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		respBody := struct {
+			Result string `json:"result"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if respBody.Result != "60" {
+			t.Fatalf("want (60) got (%v)", respBody.Result)
+		}
+
+		req, _ := http.NewRequest(http.MethodDelete, sheetURL+"/names/tax_rate", nil)
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("want (%d) got (%d)", http.StatusNoContent, resp.StatusCode)
+		}
+	})
+
+	t.Run("user-defined functions", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/api/v1/functions", "application/json", bytes.NewBufferString("{\"definition\": \"MARGIN(cost, price) = (price - cost) / price\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("want (%d) got (%d)", http.StatusCreated, resp.StatusCode)
+		}
+
+		cellURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_functions", "margin")
+		resp, err = http.Post(cellURL, "application/json", bytes.NewBufferString("{\"value\": \"=MARGIN(50, 200) * 100\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		respBody := struct {
+			Result string `json:"result"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if respBody.Result != "75" {
+			t.Fatalf("want (75) got (%v)", respBody.Result)
+		}
+
+		resp, err = http.Post(ts.URL+"/api/v1/functions", "application/json", bytes.NewBufferString("{\"definition\": \"SUM(x) = x\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Fatalf("want (%d) got (%d)", http.StatusUnprocessableEntity, resp.StatusCode)
+		}
+
+		resp, err = http.Post(ts.URL+"/api/v1/functions", "application/json", bytes.NewBufferString("{\"definition\": \"MARGIN(cost, price) = (price - cost) / cost\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("want (%d) got (%d)", http.StatusCreated, resp.StatusCode)
+		}
+
+		// cells calling the redefined function are recalculated
+		resp, err = http.Get(cellURL)
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if respBody.Result != "300" {
+			t.Fatalf("want (300) got (%v)", respBody.Result)
+		}
+
+		req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/api/v1/functions/margin", nil)
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("want (%d) got (%d)", http.StatusNoContent, resp.StatusCode)
+		}
+
+		resp, err = http.Post(ts.URL+"/api/v1/functions", "application/json", bytes.NewBufferString("{\"definition\": \"MARGIN(cost, price) = (price - cost) / price\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("want (%d) got (%d)", http.StatusCreated, resp.StatusCode)
+		}
+
+		// cells calling a deleted function are recalculated once it is defined again
+		resp, err = http.Get(cellURL)
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if respBody.Result != "75" {
+			t.Fatalf("want (75) got (%v)", respBody.Result)
+		}
+	})
+
+	t.Run("text results", func(t *testing.T) {
+		cellURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_text", "greeting")
+		resp, err := http.Post(cellURL, "application/json", bytes.NewBufferString("{\"value\": \"=UPPER(CONCAT(\\\"héllo \\\", LEFT(\\\"wörld\\\", 3)))\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		respBody := struct {
+			Result string `json:"result"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if respBody.Result != "HÉLLO WÖR" {
+			t.Fatalf("want (HÉLLO WÖR) got (%v)", respBody.Result)
+		}
+	})
+
+	t.Run("dates", func(t *testing.T) {
+		cellURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_dates", "due")
+		resp, err := http.Post(cellURL, "application/json", bytes.NewBufferString("{\"value\": \"=EDATE(DATE(2024, 1, 31), 1) + 1\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		respBody := struct {
+			Result string `json:"result"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if respBody.Result != "2024-03-01" {
+			t.Fatalf("want (2024-03-01) got (%v)", respBody.Result)
+		}
+	})
+
+	t.Run("lookups", func(t *testing.T) {
+		values := map[string]string{
+			"a1": "=\\\"apple\\\"", "b1": "1.2",
+			"a2": "=\\\"banana\\\"", "b2": "0.5",
+		}
+		for cellID, value := range values {
+			cellURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_lookups", cellID)
+			resp, err := http.Post(cellURL, "application/json", bytes.NewBufferString(fmt.Sprintf("{\"value\": \"%s\"}", value)))
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("want (%d) got (%d)", http.StatusCreated, resp.StatusCode)
+			}
+		}
+
+		cellURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_lookups", "price")
+		resp, err := http.Post(cellURL, "application/json", bytes.NewBufferString("{\"value\": \"=VLOOKUP(\\\"banana\\\", a1:b2, 2, 0)\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		respBody := struct {
+			Result string `json:"result"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if respBody.Result != "0.5" {
+			t.Fatalf("want (0.5) got (%v)", respBody.Result)
+		}
+
+		cellURL = fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_lookups", "missing")
+		resp, err = http.Post(cellURL, "application/json", bytes.NewBufferString("{\"value\": \"=VLOOKUP(\\\"kiwi\\\", a1:b2, 2, 0)\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Fatalf("want (%d) got (%d)", http.StatusUnprocessableEntity, resp.StatusCode)
+		}
+	})
+
+	t.Run("conditional aggregates", func(t *testing.T) {
+		for i, amount := range []string{"50", "150", "250"} {
+			cellURL := fmt.Sprintf("%s/api/v1/%s/a%d", ts.URL, "sheet_conditional", i+1)
+			resp, err := http.Post(cellURL, "application/json", bytes.NewBufferString(fmt.Sprintf("{\"value\": \"%s\"}", amount)))
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("want (%d) got (%d)", http.StatusCreated, resp.StatusCode)
+			}
+		}
+
+		cellURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_conditional", "large")
+		resp, err := http.Post(cellURL, "application/json", bytes.NewBufferString("{\"value\": \"=SUMIF(a1:a3, \\\">100\\\")\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		respBody := struct {
+			Result string `json:"result"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if respBody.Result != "400" {
+			t.Fatalf("want (400) got (%v)", respBody.Result)
+		}
+	})
+
+	t.Run("spill", func(t *testing.T) {
+		values := []struct{ cellID, value string }{
+			{"a1", "3"}, {"a2", "1"}, {"a3", "2"}, {"b1", "=SORT(a1:a3) * 2"}, {"c2", "1"},
+		}
+		for _, v := range values {
+			cellURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_spill", v.cellID)
+			resp, err := http.Post(cellURL, "application/json", bytes.NewBufferString(fmt.Sprintf("{\"value\": \"%s\"}", v.value)))
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("want (%d) got (%d)", http.StatusCreated, resp.StatusCode)
+			}
+		}
+
+		resp, err := http.Get(fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_spill", "b3"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		respBody := struct {
+			Result string `json:"result"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if respBody.Result != "6" {
+			t.Fatalf("want (6) got (%v)", respBody.Result)
+		}
+
+		// a blocked array is stored with the error result, like on recalculation
+		cellURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_spill", "c1")
+		resp, err = http.Post(cellURL, "application/json", bytes.NewBufferString("{\"value\": \"=SEQUENCE(2)\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("want (%d) got (%d)", http.StatusCreated, resp.StatusCode)
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if respBody.Result != "ERROR" {
+			t.Fatalf("want (ERROR) got (%v)", respBody.Result)
+		}
+
+		// so is an array which would spill beyond the last column
+		cellURL = fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_spill", "xfd1")
+		resp, err = http.Post(cellURL, "application/json", bytes.NewBufferString("{\"value\": \"=SEQUENCE(1, 2)\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if respBody.Result != "ERROR" {
+			t.Fatalf("want (ERROR) got (%v)", respBody.Result)
+		}
+	})
+
+	t.Run("explain", func(t *testing.T) {
+		values := []struct{ cellID, value string }{
+			{"a1", "2"}, {"b1", "=a1*(a1+1)"}, {"c1", "=b1+1"},
+		}
+		for _, v := range values {
+			cellURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_explain", v.cellID)
+			resp, err := http.Post(cellURL, "application/json", bytes.NewBufferString(fmt.Sprintf("{\"value\": \"%s\"}", v.value)))
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("want (%d) got (%d)", http.StatusCreated, resp.StatusCode)
+			}
+		}
+
+		resp, err := http.Get(fmt.Sprintf("%s/api/v1/%s/%s/explain", ts.URL, "sheet_explain", "b1"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("want (%d) got (%d)", http.StatusOK, resp.StatusCode)
+		}
+
+		respBody := struct {
+			Result     string   `json:"result"`
+			Precedents []string `json:"precedents"`
+			Dependents []string `json:"dependents"`
+			Trace      struct {
+				Steps []struct {
+					Expression string `json:"expression"`
+					Value      string `json:"value"`
+				} `json:"steps"`
+			} `json:"trace"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if respBody.Result != "6" {
+			t.Fatalf("want (6) got (%v)", respBody.Result)
+		}
+		if len(respBody.Precedents) != 1 || respBody.Precedents[0] != "a1" {
+			t.Fatalf("want ([a1]) got (%v)", respBody.Precedents)
+		}
+		if len(respBody.Dependents) != 1 || respBody.Dependents[0] != "c1" {
+			t.Fatalf("want ([c1]) got (%v)", respBody.Dependents)
+		}
+
+		steps := respBody.Trace.Steps
+		if len(steps) == 0 || steps[len(steps)-1].Expression != "2 * 3" || steps[len(steps)-1].Value != "6" {
+			t.Fatalf("want (2 * 3 = 6) as the last step got (%v)", steps)
+		}
+
+		resp, err = http.Get(fmt.Sprintf("%s/api/v1/%s/%s/explain", ts.URL, "sheet_explain", "z9"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("want (%d) got (%d)", http.StatusNotFound, resp.StatusCode)
+		}
+	})
+
+	t.Run("evaluate", func(t *testing.T) {
+		cellURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_evaluate", "a1")
+		resp, err := http.Post(cellURL, "application/json", bytes.NewBufferString("{\"value\": \"2\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("want (%d) got (%d)", http.StatusCreated, resp.StatusCode)
+		}
+
+		testCases := []struct {
+			value  string
+			status int
+			result string
+			stage  string
+			code   string
+		}{
+			{value: "=a1*3", status: http.StatusOK, result: "6"},
+			{value: "=(a1", status: http.StatusUnprocessableEntity, result: "ERROR", stage: "parse"},
+			{value: "=a1/0", status: http.StatusUnprocessableEntity, result: "ERROR", stage: "evaluation", code: "#DIV/0!"},
+		}
+
+		evaluateURL := fmt.Sprintf("%s/api/v1/%s/evaluate", ts.URL, "sheet_evaluate")
+		for _, test := range testCases {
+			body, _ := json.Marshal(map[string]string{"value": test.value})
+			resp, err := http.Post(evaluateURL, "application/json", bytes.NewBuffer(body))
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			if resp.StatusCode != test.status {
+				t.Fatalf("%s: want (%d) got (%d)", test.value, test.status, resp.StatusCode)
+			}
+
+			respBody := struct {
+				Result string `json:"result"`
+				Error  struct {
+					Stage string `json:"stage"`
+					Code  string `json:"code"`
+				} `json:"error"`
+			}{}
+
+			if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+				t.Fatalf("could not decode a response body: %v", err)
+			}
+
+			if respBody.Result != test.result || respBody.Error.Stage != test.stage || respBody.Error.Code != test.code {
+				t.Fatalf("%s: want (%s %s %s) got (%+v)", test.value, test.result, test.stage, test.code, respBody)
+			}
+		}
+
+		resp, err = http.Get(fmt.Sprintf("%s/api/v1/%s", ts.URL, "sheet_evaluate"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		sheet := []map[string]string{}
+		if err := json.NewDecoder(resp.Body).Decode(&sheet); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if len(sheet) != 1 {
+			t.Fatalf("want (1) cell got (%d)", len(sheet))
+		}
+	})
+
+	t.Run("normalized value", func(t *testing.T) {
+		cellURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_normalized", "a1")
+		resp, err := http.Post(cellURL, "application/json", bytes.NewBufferString("{\"value\": \"=sum( 1,2 )*(3)\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("want (%d) got (%d)", http.StatusCreated, resp.StatusCode)
+		}
+
+		resp, err = http.Get(cellURL)
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		respBody := struct {
+			Value      string `json:"value"`
+			Result     string `json:"result"`
+			Normalized string `json:"normalized"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if respBody.Value != "=sum( 1,2 )*(3)" || respBody.Result != "9" || respBody.Normalized != "=SUM(1, 2) * 3" {
+			t.Fatalf("unexpected cell (%+v)", respBody)
+		}
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		values := []struct{ cellID, value string }{
+			{"total", "10"}, {"tax", "=total*0.2"}, {"other", "3"},
+		}
+		for _, v := range values {
+			cellURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_rename", v.cellID)
+			resp, err := http.Post(cellURL, "application/json", bytes.NewBufferString(fmt.Sprintf("{\"value\": \"%s\"}", v.value)))
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("want (%d) got (%d)", http.StatusCreated, resp.StatusCode)
+			}
+		}
+
+		renameURL := fmt.Sprintf("%s/api/v1/%s/%s/rename", ts.URL, "sheet_rename", "total")
+		resp, err := http.Post(renameURL, "application/json", bytes.NewBufferString("{\"cell_id\": \"grand_total\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("want (%d) got (%d)", http.StatusOK, resp.StatusCode)
+		}
+
+		resp, err = http.Get(fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_rename", "tax"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		respBody := struct {
+			Value  string `json:"value"`
+			Result string `json:"result"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if respBody.Value != "=grand_total * 0.2" || respBody.Result != "2" {
+			t.Fatalf("unexpected cell (%+v)", respBody)
+		}
+
+		renameURL = fmt.Sprintf("%s/api/v1/%s/%s/rename", ts.URL, "sheet_rename", "grand_total")
+		resp, err = http.Post(renameURL, "application/json", bytes.NewBufferString("{\"cell_id\": \"other\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusConflict {
+			t.Fatalf("want (%d) got (%d)", http.StatusConflict, resp.StatusCode)
+		}
+
+		// ids which could not be requested afterwards
+		for _, cellID := range []string{"events", "snapshot", "tötal"} {
+			resp, err = http.Post(renameURL, "application/json", bytes.NewBufferString(fmt.Sprintf("{\"cell_id\": \"%s\"}", cellID)))
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			if resp.StatusCode != http.StatusUnprocessableEntity {
+				t.Fatalf("%s: want (%d) got (%d)", cellID, http.StatusUnprocessableEntity, resp.StatusCode)
+			}
+		}
+	})
+
+	t.Run("rows and columns", func(t *testing.T) {
+		values := []struct{ cellID, value string }{
+			{"a1", "1"}, {"a2", "2"}, {"b1", "=SUM(a1:a2)"}, {"b2", "=a2+$a$1"},
+		}
+		for _, v := range values {
+			cellURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_rows", v.cellID)
+			resp, err := http.Post(cellURL, "application/json", bytes.NewBufferString(fmt.Sprintf("{\"value\": \"%s\"}", v.value)))
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("want (%d) got (%d)", http.StatusCreated, resp.StatusCode)
+			}
+		}
+
+		insertURL := fmt.Sprintf("%s/api/v1/%s/rows/insert", ts.URL, "sheet_rows")
+		resp, err := http.Post(insertURL, "application/json", bytes.NewBufferString("{\"at\": 2}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("want (%d) got (%d)", http.StatusOK, resp.StatusCode)
+		}
+
+		resp, err = http.Get(fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_rows", "b3"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		respBody := struct {
+			Value  string `json:"value"`
+			Result string `json:"result"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if respBody.Value != "=a3 + $a$1" || respBody.Result != "3" {
+			t.Fatalf("unexpected cell (%+v)", respBody)
+		}
+
+		deleteURL := fmt.Sprintf("%s/api/v1/%s/columns/delete", ts.URL, "sheet_rows")
+		resp, err = http.Post(deleteURL, "application/json", bytes.NewBufferString("{\"at\": \"a\", \"count\": 0}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Fatalf("want (%d) got (%d)", http.StatusUnprocessableEntity, resp.StatusCode)
+		}
+
+		lastURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_rows", "a1048576")
+		resp, err = http.Post(lastURL, "application/json", bytes.NewBufferString("{\"value\": \"1\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("want (%d) got (%d)", http.StatusCreated, resp.StatusCode)
+		}
+
+		// neither the last row nor coordinates which would overflow can be pushed beyond the sheet
+		for _, body := range []string{
+			"{\"at\": 2}",
+			"{\"at\": 1048577}",
+			"{\"at\": 1, \"count\": 9223372036854775807}",
+			"{\"at\": 9223372036854775807, \"count\": 9223372036854775807}",
+		} {
+			resp, err = http.Post(insertURL, "application/json", bytes.NewBufferString(body))
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			if resp.StatusCode != http.StatusUnprocessableEntity {
+				t.Fatalf("%s: want (%d) got (%d)", body, http.StatusUnprocessableEntity, resp.StatusCode)
+			}
+		}
+	})
+
+	t.Run("copy and fill", func(t *testing.T) {
+		values := []struct{ cellID, value string }{
+			{"a1", "1"}, {"a2", "2"}, {"a3", "3"}, {"b1", "=a1*$a$1+10"}, {"e1", "1"}, {"d1", "=e1+1"},
+		}
+		for _, v := range values {
+			cellURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_copy", v.cellID)
+			resp, err := http.Post(cellURL, "application/json", bytes.NewBufferString(fmt.Sprintf("{\"value\": \"%s\"}", v.value)))
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("want (%d) got (%d)", http.StatusCreated, resp.StatusCode)
+			}
+		}
+
+		fillURL := fmt.Sprintf("%s/api/v1/%s/fill", ts.URL, "sheet_copy")
+		resp, err := http.Post(fillURL, "application/json", bytes.NewBufferString("{\"range\": \"b1:b3\", \"direction\": \"down\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("want (%d) got (%d)", http.StatusOK, resp.StatusCode)
+		}
+
+		respBody := struct {
+			Cells []struct {
+				CellID string `json:"cell_id"`
+				Value  string `json:"value"`
+				Result string `json:"result"`
+			} `json:"cells"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if len(respBody.Cells) != 2 || respBody.Cells[1].Value != "=a3 * $a$1 + 10" || respBody.Cells[1].Result != "13" {
+			t.Fatalf("unexpected cells (%+v)", respBody.Cells)
+		}
+
+		copyURL := fmt.Sprintf("%s/api/v1/%s/copy", ts.URL, "sheet_copy")
+		resp, err = http.Post(copyURL, "application/json", bytes.NewBufferString("{\"source\": \"b2\", \"destination\": \"c1\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("want (%d) got (%d)", http.StatusOK, resp.StatusCode)
+		}
+
+		resp, err = http.Get(fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_copy", "c1"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		cellBody := struct {
+			Value  string `json:"value"`
+			Result string `json:"result"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&cellBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if cellBody.Value != "=b1 * $a$1 + 10" || cellBody.Result != "21" {
+			t.Fatalf("unexpected cell (%+v)", cellBody)
+		}
+
+		resp, err = http.Post(copyURL, "application/json", bytes.NewBufferString("{\"source\": \"a1:b2\", \"destination\": \"xfd1\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Fatalf("want (%d) got (%d)", http.StatusUnprocessableEntity, resp.StatusCode)
+		}
+
+		// d1 references e1, which would be moved beyond the last column
+		resp, err = http.Post(copyURL, "application/json", bytes.NewBufferString("{\"source\": \"d1\", \"destination\": \"xfd1\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Fatalf("want (%d) got (%d)", http.StatusUnprocessableEntity, resp.StatusCode)
+		}
+
+		failuresBody := struct {
+			Errors []struct {
+				CellID string `json:"cell_id"`
+				Value  string `json:"value"`
+			} `json:"errors"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&failuresBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if len(failuresBody.Errors) != 1 || failuresBody.Errors[0].Value != "=#REF! + 1" {
+			t.Fatalf("unexpected errors (%+v)", failuresBody.Errors)
+		}
+	})
+
+	t.Run("grid view", func(t *testing.T) {
+		values := []struct{ cellID, value string }{
+			{"b2", "1"}, {"c3", "=b2*2"}, {"total", "=c3"},
+		}
+		for _, v := range values {
+			cellURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_grid", v.cellID)
+			resp, err := http.Post(cellURL, "application/json", bytes.NewBufferString(fmt.Sprintf("{\"value\": \"%s\"}", v.value)))
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("want (%d) got (%d)", http.StatusCreated, resp.StatusCode)
+			}
+		}
+
+		resp, err := http.Get(fmt.Sprintf("%s/api/v1/%s?view=grid", ts.URL, "sheet_grid"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("want (%d) got (%d)", http.StatusOK, resp.StatusCode)
+		}
+
+		respBody := struct {
+			Range   string      `json:"range"`
+			Columns []string    `json:"columns"`
+			Rows    []int       `json:"rows"`
+			Results [][]*string `json:"results"`
+		}{}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if respBody.Range != "b2:c3" || len(respBody.Results) != 2 || len(respBody.Results[1]) != 2 {
+			t.Fatalf("unexpected grid (%+v)", respBody)
+		}
+
+		if respBody.Results[0][1] != nil || respBody.Results[1][1] == nil || *respBody.Results[1][1] != "2" {
+			t.Fatalf("unexpected results (%+v)", respBody.Results)
+		}
+
+		resp, err = http.Get(fmt.Sprintf("%s/api/v1/%s?view=grid&range=A1:F50", ts.URL, "sheet_grid"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if respBody.Range != "a1:f50" || len(respBody.Rows) != 50 || len(respBody.Columns) != 6 {
+			t.Fatalf("unexpected grid (%+v)", respBody)
+		}
+
+		for _, area := range []string{"a1", "a1:b4611686018427387905"} {
+			resp, err = http.Get(fmt.Sprintf("%s/api/v1/%s?view=grid&range=%s", ts.URL, "sheet_grid", area))
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Fatalf("want (%d) got (%d)", http.StatusBadRequest, resp.StatusCode)
+			}
+		}
+	})
+
+	t.Run("sheet pages", func(t *testing.T) {
+		values := []struct{ cellID, value string }{
+			{"a1", "1"}, {"a2", "1"}, {"b1", "=a1*2"}, {"b2", "=a1/a2"}, {"total", "=b1"},
+		}
+		for _, v := range values {
+			cellURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_pages", v.cellID)
+			resp, err := http.Post(cellURL, "application/json", bytes.NewBufferString(fmt.Sprintf("{\"value\": \"%s\"}", v.value)))
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("want (%d) got (%d)", http.StatusCreated, resp.StatusCode)
+			}
+		}
+
+		// b2 gets the error result
+		resp, err := http.Post(fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_pages", "a2"), "application/json", bytes.NewBufferString("{\"value\": \"0\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+		resp.Body.Close()
+
+		type pageBody struct {
+			Cells []struct {
+				CellID string  `json:"cell_id"`
+				Value  *string `json:"value"`
+				Result *string `json:"result"`
+			} `json:"cells"`
+			NextCursor string `json:"next_cursor"`
+		}
+
+		cellIDs := make([]string, 0)
+		cursor := ""
+		for i := 0; i < 5; i++ {
+			resp, err := http.Get(fmt.Sprintf("%s/api/v1/%s?limit=2&fields=result&cursor=%s", ts.URL, "sheet_pages", cursor))
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("want (%d) got (%d)", http.StatusOK, resp.StatusCode)
+			}
+
+			respBody := pageBody{}
+			if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+				t.Fatalf("could not decode a response body: %v", err)
+			}
+
+			for _, c := range respBody.Cells {
+				if c.Value != nil || c.Result == nil {
+					t.Fatalf("unexpected fields of a cell (%+v)", c)
+				}
+				cellIDs = append(cellIDs, c.CellID)
+			}
+
+			if cursor = respBody.NextCursor; cursor == "" {
+				break
+			}
+		}
+
+		if strings.Join(cellIDs, ",") != "a1,a2,b1,b2,total" {
+			t.Fatalf("unexpected cells (%v)", cellIDs)
+		}
+
+		resp, err = http.Get(fmt.Sprintf("%s/api/v1/%s?prefix=b&has_formula=true&error=false", ts.URL, "sheet_pages"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		respBody := pageBody{}
+		if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+			t.Fatalf("could not decode a response body: %v", err)
+		}
+
+		if len(respBody.Cells) != 1 || respBody.Cells[0].CellID != "b1" || respBody.NextCursor != "" {
+			t.Fatalf("unexpected page (%+v)", respBody)
+		}
+
+		// only values starting with "=" are formulas, even if others are computed too
+		resp, err = http.Post(fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_pages", "c1"), "application/json", bytes.NewBufferString("{\"value\": \"2+2\"}"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+		resp.Body.Close()
+
+		for hasFormula, want := range map[string]int{"true": 0, "false": 1} {
+			resp, err = http.Get(fmt.Sprintf("%s/api/v1/%s?prefix=c&has_formula=%s", ts.URL, "sheet_pages", hasFormula))
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			respBody := pageBody{}
+			if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+				t.Fatalf("could not decode a response body: %v", err)
+			}
+
+			if len(respBody.Cells) != want {
+				t.Fatalf("has_formula=%s: want (%d) cells got (%+v)", hasFormula, want, respBody.Cells)
+			}
+		}
+
+		resp, err = http.Get(fmt.Sprintf("%s/api/v1/%s?fields=id", ts.URL, "sheet_pages"))
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("want (%d) got (%d)", http.StatusBadRequest, resp.StatusCode)
+		}
+	})
+
+	t.Run("sheet as ndjson", func(t *testing.T) {
+		for _, cellID := range []string{"a1", "a2"} {
+			cellURL := fmt.Sprintf("%s/api/v1/%s/%s", ts.URL, "sheet_ndjson", cellID)
+			resp, err := http.Post(cellURL, "application/json", bytes.NewBufferString("{\"value\": \"1\"}"))
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("want (%d) got (%d)", http.StatusCreated, resp.StatusCode)
+			}
+		}
+
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/%s", ts.URL, "sheet_ndjson"), nil)
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+		req.Header.Set("Accept", "application/x-ndjson")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if resp.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Fatalf("unexpected content type (%s)", resp.Header.Get("Content-Type"))
+		}
+
+		decoder := json.NewDecoder(resp.Body)
+		cellIDs := make([]string, 0)
+		for decoder.More() {
+			line := struct {
+				CellID string `json:"cell_id"`
+				Result string `json:"result"`
+			}{}
+			if err := decoder.Decode(&line); err != nil {
+				t.Fatalf("could not decode a response body: %v", err)
+			}
+			cellIDs = append(cellIDs, line.CellID)
+		}
+
+		if len(cellIDs) != 2 {
+			t.Fatalf("unexpected cells (%v)", cellIDs)
+		}
+	})
 }
@@ -0,0 +1,208 @@
+package a1
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A sheet has at most MaxRow rows and MaxCol columns, "xfd1048576" is its last
+// cell, as in spreadsheet applications. Ids beyond them are not A1-style, so
+// that no range, grid or shift has to deal with sizes which overflow.
+const (
+	MaxRow = 1048576
+	MaxCol = 16384
+)
+
+// Ref is a position of an A1-style cell id, both indexes start from 1.
+type Ref struct {
+	Col int
+	Row int
+}
+
+// Parse splits an A1-style cell id such as "b12" into its column and row.
+// Ids which do not follow the notation are reported with ok set to false.
+func Parse(cellID string) (Ref, bool) {
+	i := 0
+	for i < len(cellID) && isASCIILetter(cellID[i]) {
+		i++
+	}
+
+	if i == 0 || i == len(cellID) {
+		return Ref{}, false
+	}
+
+	for _, char := range cellID[i:] {
+		if char < '0' || char > '9' {
+			return Ref{}, false
+		}
+	}
+
+	row, err := strconv.Atoi(cellID[i:])
+	if err != nil || row < 1 || row > MaxRow || cellID[i] == '0' {
+		return Ref{}, false
+	}
+
+	col, ok := ColumnIndex(cellID[:i])
+	if !ok {
+		return Ref{}, false
+	}
+
+	return Ref{Col: col, Row: row}, true
+}
+
+// String returns a lowercase cell id of the position, e.g. "b12".
+func (r Ref) String() string {
+	return ColumnName(r.Col) + strconv.Itoa(r.Row)
+}
+
+// InSheet tells if the position is a cell of a sheet, i.e. between "a1" and "xfd1048576".
+func (r Ref) InSheet() bool {
+	return r.Col >= 1 && r.Row >= 1 && r.Col <= MaxCol && r.Row <= MaxRow
+}
+
+// Absolute marks the column and the row of a cell id written with
+// a dollar sign, e.g. "$b12" has an absolute column and "$b$12" both.
+// Absolute parts keep referring to the same column or row when
+// formulas are copied or rows and columns are inserted.
+type Absolute struct {
+	Col bool `json:"col"`
+	Row bool `json:"row"`
+}
+
+// ParseAbsolute is like Parse but accepts a dollar sign before the column and the row.
+func ParseAbsolute(cellID string) (Ref, Absolute, bool) {
+	absolute := Absolute{}
+
+	if rest, ok := strings.CutPrefix(cellID, "$"); ok {
+		absolute.Col = true
+		cellID = rest
+	}
+
+	if i := strings.IndexByte(cellID, '$'); i >= 0 {
+		absolute.Row = true
+		cellID = cellID[:i] + cellID[i+1:]
+
+		// the dollar sign must separate the column from the row
+		if i == 0 || !isASCIILetter(cellID[i-1]) || isASCIILetter(cellID[i]) {
+			return Ref{}, Absolute{}, false
+		}
+	}
+
+	ref, ok := Parse(cellID)
+	if !ok {
+		return Ref{}, Absolute{}, false
+	}
+	return ref, absolute, true
+}
+
+// Format returns a lowercase cell id of the position with
+// dollar signs before its absolute parts, e.g. "$b$12".
+func (r Ref) Format(absolute Absolute) string {
+	col, row := ColumnName(r.Col), strconv.Itoa(r.Row)
+	if absolute.Col {
+		col = "$" + col
+	}
+	if absolute.Row {
+		row = "$" + row
+	}
+	return col + row
+}
+
+// ColumnIndex converts column letters into a column number: "a" is 1, "z" is 26, "aa" is 27.
+// Columns after MaxCol ("xfd") are reported with ok set to false.
+func ColumnIndex(letters string) (int, bool) {
+	// the last column has 3 letters, longer ones would overflow the index
+	if letters == "" || len(letters) > 3 {
+		return 0, false
+	}
+
+	index := 0
+	for _, char := range strings.ToLower(letters) {
+		if char < 'a' || char > 'z' {
+			return 0, false
+		}
+		index = index*26 + int(char-'a') + 1
+	}
+	return index, index <= MaxCol
+}
+
+// ColumnName converts a column number into lowercase column letters.
+func ColumnName(index int) string {
+	name := make([]byte, 0, 3)
+	for index > 0 {
+		index--
+		name = append([]byte{byte('a' + index%26)}, name...)
+		index /= 26
+	}
+	return string(name)
+}
+
+func isASCIILetter(char byte) bool {
+	return char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z'
+}
+
+// Range is a rectangle of cells, From is its top left and To its bottom right corner.
+type Range struct {
+	From Ref
+	To   Ref
+}
+
+// ParseRange parses a range such as "a1:b12". Corners may be given
+// in any order, the range is normalised to start at the top left one.
+func ParseRange(value string) (Range, bool) {
+	from, to, found := strings.Cut(value, ":")
+	if !found {
+		return Range{}, false
+	}
+
+	a, ok := Parse(from)
+	if !ok {
+		return Range{}, false
+	}
+	b, ok := Parse(to)
+	if !ok {
+		return Range{}, false
+	}
+
+	r := Range{From: a, To: b}
+	if r.From.Col > r.To.Col {
+		r.From.Col, r.To.Col = r.To.Col, r.From.Col
+	}
+	if r.From.Row > r.To.Row {
+		r.From.Row, r.To.Row = r.To.Row, r.From.Row
+	}
+	return r, true
+}
+
+// String returns a lowercase range, e.g. "a1:b12".
+func (r Range) String() string {
+	return r.From.String() + ":" + r.To.String()
+}
+
+func (r Range) Rows() int {
+	return r.To.Row - r.From.Row + 1
+}
+
+func (r Range) Cols() int {
+	return r.To.Col - r.From.Col + 1
+}
+
+// Size returns the number of cells of the range.
+func (r Range) Size() int {
+	return r.Rows() * r.Cols()
+}
+
+func (r Range) Contains(ref Ref) bool {
+	return ref.Col >= r.From.Col && ref.Col <= r.To.Col && ref.Row >= r.From.Row && ref.Row <= r.To.Row
+}
+
+// Refs returns every cell of the range row by row.
+func (r Range) Refs() []Ref {
+	refs := make([]Ref, 0, r.Size())
+	for row := r.From.Row; row <= r.To.Row; row++ {
+		for col := r.From.Col; col <= r.To.Col; col++ {
+			refs = append(refs, Ref{Col: col, Row: row})
+		}
+	}
+	return refs
+}
@@ -0,0 +1,149 @@
+package a1_test
+
+import (
+	"dev-challenge/internal/a1"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		cellID string
+		want   a1.Ref
+		ok     bool
+	}{
+		{cellID: "a1", want: a1.Ref{Col: 1, Row: 1}, ok: true},
+		{cellID: "B12", want: a1.Ref{Col: 2, Row: 12}, ok: true},
+		{cellID: "aa3", want: a1.Ref{Col: 27, Row: 3}, ok: true},
+		{cellID: "zz100", want: a1.Ref{Col: 702, Row: 100}, ok: true},
+		{cellID: "total", ok: false},
+		{cellID: "a0", ok: false},
+		{cellID: "a01", ok: false},
+		{cellID: "12", ok: false},
+		{cellID: "a1b", ok: false},
+		{cellID: "cell_3", ok: false},
+		{cellID: "xfd1048576", want: a1.Ref{Col: a1.MaxCol, Row: a1.MaxRow}, ok: true},
+		{cellID: "xfe1", ok: false},
+		{cellID: "a1048577", ok: false},
+		{cellID: "zzzzzz1", ok: false},
+		{cellID: "b4611686018427387905", ok: false},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.cellID, func(t *testing.T) {
+			got, ok := a1.Parse(test.cellID)
+			if ok != test.ok || got != test.want {
+				t.Fatalf("want (%v, %v) got (%v, %v)", test.want, test.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestRef_String(t *testing.T) {
+	for _, cellID := range []string{"a1", "z9", "aa10", "az1", "ba1", "zz100", "aaa1"} {
+		ref, ok := a1.Parse(cellID)
+		if !ok {
+			t.Fatalf("expected %s to be a valid cell id", cellID)
+		}
+
+		if got := ref.String(); got != cellID {
+			t.Fatalf("want (%s) got (%s)", cellID, got)
+		}
+	}
+}
+
+func TestRef_InSheet(t *testing.T) {
+	testCases := []struct {
+		ref  a1.Ref
+		want bool
+	}{
+		{ref: a1.Ref{Col: 1, Row: 1}, want: true},
+		{ref: a1.Ref{Col: a1.MaxCol, Row: a1.MaxRow}, want: true},
+		{ref: a1.Ref{Col: 0, Row: 1}, want: false},
+		{ref: a1.Ref{Col: 1, Row: 0}, want: false},
+		{ref: a1.Ref{Col: a1.MaxCol + 1, Row: 1}, want: false},
+		{ref: a1.Ref{Col: 1, Row: a1.MaxRow + 1}, want: false},
+	}
+
+	for _, test := range testCases {
+		if got := test.ref.InSheet(); got != test.want {
+			t.Fatalf("%+v: want (%v) got (%v)", test.ref, test.want, got)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	testCases := []struct {
+		value string
+		want  string
+		size  int
+		ok    bool
+	}{
+		{value: "a1:b3", want: "a1:b3", size: 6, ok: true},
+		{value: "B3:A1", want: "a1:b3", size: 6, ok: true},
+		{value: "b1:a3", want: "a1:b3", size: 6, ok: true},
+		{value: "c5:c5", want: "c5:c5", size: 1, ok: true},
+		{value: "a1", ok: false},
+		{value: "a1:total", ok: false},
+		{value: "a1:b2:c3", ok: false},
+		{value: "a1:xfd1048576", want: "a1:xfd1048576", size: a1.MaxCol * a1.MaxRow, ok: true},
+		{value: "a1:b4611686018427387905", ok: false},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.value, func(t *testing.T) {
+			got, ok := a1.ParseRange(test.value)
+			if ok != test.ok {
+				t.Fatalf("want (%v) got (%v)", test.ok, ok)
+			}
+			if !ok {
+				return
+			}
+
+			if got.String() != test.want || got.Size() != test.size {
+				t.Fatalf("want (%s, %d) got (%s, %d)", test.want, test.size, got, got.Size())
+			}
+
+			// the whole sheet is too large to list its cells
+			if test.size < a1.MaxRow && len(got.Refs()) != test.size {
+				t.Fatalf("want (%s, %d) got (%s, %d)", test.want, test.size, got, got.Size())
+			}
+
+			if !got.Contains(got.To) || got.Contains(a1.Ref{Col: got.To.Col + 1, Row: got.To.Row}) {
+				t.Fatalf("unexpected cells contained by %s", got)
+			}
+		})
+	}
+}
+
+func TestParseAbsolute(t *testing.T) {
+	testCases := []struct {
+		cellID   string
+		want     a1.Ref
+		absolute a1.Absolute
+		ok       bool
+	}{
+		{cellID: "a1", want: a1.Ref{Col: 1, Row: 1}, ok: true},
+		{cellID: "$a1", want: a1.Ref{Col: 1, Row: 1}, absolute: a1.Absolute{Col: true}, ok: true},
+		{cellID: "B$12", want: a1.Ref{Col: 2, Row: 12}, absolute: a1.Absolute{Row: true}, ok: true},
+		{cellID: "$aa$3", want: a1.Ref{Col: 27, Row: 3}, absolute: a1.Absolute{Col: true, Row: true}, ok: true},
+		{cellID: "$", ok: false},
+		{cellID: "$$a1", ok: false},
+		{cellID: "a$$1", ok: false},
+		{cellID: "$1", ok: false},
+		{cellID: "a1$", ok: false},
+		{cellID: "$total", ok: false},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.cellID, func(t *testing.T) {
+			got, absolute, ok := a1.ParseAbsolute(test.cellID)
+			if ok != test.ok || got != test.want || absolute != test.absolute {
+				t.Fatalf("want (%v, %v, %v) got (%v, %v, %v)", test.want, test.absolute, test.ok, got, absolute, ok)
+			}
+			if ok && got.Format(absolute) != strings.ToLower(test.cellID) {
+				t.Fatalf("want (%s) got (%s)", strings.ToLower(test.cellID), got.Format(absolute))
+			}
+		})
+	}
+}
@@ -5,4 +5,25 @@ type Cell struct {
 	SheetID string `json:"-"`
 	Value   string `json:"value"`
 	Result  string `json:"result"`
+
+	// Normalized is the value as a canonical formula, see parser.Print.
+	Normalized string `json:"normalized,omitempty"`
+
+	// Version is incremented on every change of the cell's value or result.
+	Version int `json:"-"`
+}
+
+// Failure describes why a cell could not be written.
+type Failure struct {
+	CellID  string `json:"cell_id"`
+	Value   string `json:"value"`
+	Message string `json:"message"`
+}
+
+// Name is a sheet-level definition, a constant or a formula such as
+// a range, which formulas of the sheet may use instead of cell ids.
+type Name struct {
+	SheetID string `json:"-"`
+	Name    string `json:"name"`
+	Value   string `json:"value"`
 }
@@ -0,0 +1,305 @@
+package cell
+
+import (
+	"dev-challenge/internal/a1"
+	"dev-challenge/internal/evaluator"
+	"dev-challenge/internal/events"
+	"dev-challenge/internal/parser"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+const (
+	DirectionDown  = "down"
+	DirectionRight = "right"
+)
+
+var ErrInvalidCopy = errors.New("invalid copy")
+
+// Pasted describes the cells written by copying or filling a range.
+type Pasted struct {
+	Cells []Cell `json:"cells"`
+	// Cleared are the cells of the destination whose source cells are empty.
+	Cleared []string `json:"cleared"`
+}
+
+// Copy copies the cells of the source range of the sheet, e.g. "a1:b3" or "a1",
+// to the destination, a cell at which the top left cell of the source is pasted
+// or a range. A range whose rows and columns are multiples of the source's is
+// filled with copies of the source, otherwise the source is pasted at its top
+// left cell. Relative references and ranges of the formulas move along with the
+// cells, parts of them marked with "$" do not. Cells of the destination whose
+// source cells are empty are deleted. If any of the pasted cells cannot be
+// evaluated nothing is written and the failures are returned.
+func (s *Service) Copy(sheetID, source, destination string) (Pasted, []Failure, error) {
+	from, ok := parseArea(source)
+	if !ok {
+		return Pasted{}, nil, fmt.Errorf("%w: %s is not an A1-style cell or range", ErrInvalidCopy, source)
+	}
+	to, ok := parseArea(destination)
+	if !ok {
+		return Pasted{}, nil, fmt.Errorf("%w: %s is not an A1-style cell or range", ErrInvalidCopy, destination)
+	}
+
+	if to.Rows()%from.Rows() != 0 || to.Cols()%from.Cols() != 0 {
+		to.To = a1.Ref{Col: to.From.Col + from.Cols() - 1, Row: to.From.Row + from.Rows() - 1}
+	}
+	if !to.To.InSheet() {
+		return Pasted{}, nil, fmt.Errorf("%w: %s does not fit into the sheet at %s", ErrInvalidCopy, from, to.From)
+	}
+
+	return s.paste(sheetID, from, to)
+}
+
+// Fill extends the first row of the range down, or its first column to the
+// right, over the rest of the range, like copying it there.
+func (s *Service) Fill(sheetID, cells, direction string) (Pasted, []Failure, error) {
+	r, ok := a1.ParseRange(cells)
+	if !ok {
+		return Pasted{}, nil, fmt.Errorf("%w: %s is not an A1-style range", ErrInvalidCopy, cells)
+	}
+
+	from, to := r, r
+	switch direction {
+	case DirectionDown:
+		from.To.Row = r.From.Row
+		to.From.Row = r.From.Row + 1
+	case DirectionRight:
+		from.To.Col = r.From.Col
+		to.From.Col = r.From.Col + 1
+	default:
+		return Pasted{}, nil, fmt.Errorf("%w: unknown direction %s", ErrInvalidCopy, direction)
+	}
+
+	if to.From.Row > to.To.Row || to.From.Col > to.To.Col {
+		return Pasted{}, nil, fmt.Errorf("%w: %s has nothing to fill %s", ErrInvalidCopy, cells, direction)
+	}
+
+	return s.paste(sheetID, from, to)
+}
+
+// parseArea parses a range or a single cell, which is a range of one cell.
+func parseArea(value string) (a1.Range, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if ref, ok := a1.Parse(value); ok {
+		return a1.Range{From: ref, To: ref}, true
+	}
+	return a1.ParseRange(value)
+}
+
+// paste fills the destination with copies of the source range.
+func (s *Service) paste(sheetID string, source, destination a1.Range) (Pasted, []Failure, error) {
+	if destination.Size() > evaluator.MaxRangeSize {
+		return Pasted{}, nil, fmt.Errorf("%w: %s spans more than %d cells", ErrInvalidCopy, destination, evaluator.MaxRangeSize)
+	}
+
+	cells, err := s.cellRepo.GetManyBySheetID(sheetID)
+	if err != nil {
+		return Pasted{}, nil, err
+	}
+
+	// cells of spill ranges are not copied, their anchors spill again once pasted
+	sources := make(map[a1.Ref]Cell)
+	existing := make(map[string]Cell, len(cells))
+	for _, c := range cells {
+		existing[c.CellID] = c
+		if ref, ok := a1.Parse(c.CellID); ok && source.Contains(ref) {
+			if _, ok := spillAnchor(c); !ok {
+				sources[ref] = c
+			}
+		}
+	}
+
+	pasted := make([]Cell, 0)
+	values := make(map[string]string)
+	cleared := make([]Cell, 0)
+	for _, ref := range destination.Refs() {
+		from := a1.Ref{
+			Col: source.From.Col + (ref.Col-destination.From.Col)%source.Cols(),
+			Row: source.From.Row + (ref.Row-destination.From.Row)%source.Rows(),
+		}
+
+		c, ok := sources[from]
+		if !ok {
+			if current, ok := existing[ref.String()]; ok {
+				cleared = append(cleared, current)
+			}
+			continue
+		}
+
+		value := offsetReferences(c.Value, ref.Row-from.Row, ref.Col-from.Col)
+		pasted = append(pasted, Cell{SheetID: sheetID, CellID: ref.String(), Value: value, Normalized: normalize(value)})
+		values[ref.String()] = value
+	}
+
+	failures := make([]Failure, 0)
+	loadRange := s.rangeLoader()
+	for i, c := range pasted {
+		result, err := formatResult(evaluateWith(resolver{
+			cell: c,
+			getValue: func(ref Ref) (string, error) {
+				if ref.SheetID != sheetID {
+					return s.lookup(ref)
+				}
+
+				if name, err := s.nameRepo.GetOne(ref.SheetID, ref.CellID); err == nil {
+					return name.Value, nil
+				}
+
+				if value, ok := values[ref.CellID]; ok {
+					return value, nil
+				}
+				if cellRef, ok := a1.Parse(ref.CellID); ok && destination.Contains(cellRef) {
+					return "", ErrNotFound
+				}
+				return s.lookup(ref)
+			},
+			getRange: func(rangeSheetID string, r a1.Range) (map[a1.Ref]string, error) {
+				formulas, err := loadRange(rangeSheetID, r)
+				if err != nil || rangeSheetID != sheetID {
+					return formulas, err
+				}
+
+				// the destination is replaced by the pasted cells
+				for ref := range formulas {
+					if destination.Contains(ref) {
+						delete(formulas, ref)
+					}
+				}
+				for cellID, value := range values {
+					if ref, ok := a1.Parse(cellID); ok && r.Contains(ref) {
+						formulas[ref] = value
+					}
+				}
+				return formulas, nil
+			},
+		}))
+		if err != nil {
+			failures = append(failures, Failure{
+				CellID:  c.CellID,
+				Value:   c.Value,
+				Message: err.Error(),
+			})
+			continue
+		}
+
+		pasted[i].Result = result
+	}
+
+	if len(failures) > 0 {
+		return Pasted{}, failures, nil
+	}
+
+	clearedIDs := make([]string, 0, len(cleared))
+	for _, c := range cleared {
+		clearedIDs = append(clearedIDs, c.CellID)
+	}
+
+	written, err := s.cellRepo.Paste(sheetID, pasted, clearedIDs)
+	if err != nil {
+		return Pasted{}, nil, err
+	}
+
+	changed := make([]Ref, 0, len(cleared))
+	overwritten := make([]Cell, 0, len(cleared)+len(written))
+	for _, c := range cleared {
+		s.publish(events.TypeCellDeleted, c)
+		changed = append(changed, Ref{SheetID: sheetID, CellID: c.CellID})
+		overwritten = append(overwritten, c)
+	}
+	for _, c := range written {
+		current, ok := existing[c.CellID]
+		if !ok {
+			s.publish(events.TypeCellCreated, c)
+			continue
+		}
+		s.publish(events.TypeCellUpdated, c)
+		overwritten = append(overwritten, current)
+	}
+
+	if err := s.recalculateAll(written); err != nil {
+		log.Println(err)
+	}
+	if err := s.recalculateDependents(changed...); err != nil {
+		log.Println(err)
+	}
+
+	// cells written over spilled ones block the anchors' spill ranges
+	anchors := make([]Cell, 0)
+	for _, c := range overwritten {
+		anchorID, ok := spillAnchor(c)
+		if !ok {
+			continue
+		}
+		anchor, err := s.cellRepo.GetOne(sheetID, anchorID)
+		if err == nil {
+			anchors = append(anchors, anchor)
+		} else if !errors.Is(err, ErrNotFound) {
+			log.Println(err)
+		}
+	}
+	if err := s.recalculateAll(anchors); err != nil {
+		log.Println(err)
+	}
+
+	// results may have changed while the spill ranges were updated
+	for i, c := range written {
+		if current, err := s.cellRepo.GetOne(sheetID, c.CellID); err == nil {
+			written[i] = current
+		}
+	}
+
+	return Pasted{Cells: written, Cleared: clearedIDs}, nil, nil
+}
+
+// offsetReferences moves the relative parts of A1-style references and ranges
+// of the formula by the rows and columns, references moved out of the sheet
+// become #REF!. Values which are not formulas are returned as they are.
+func offsetReferences(value string, rows, cols int) string {
+	tree, err := parser.Parse(value)
+	if err != nil {
+		return value
+	}
+
+	changed := false
+	rewritten := tree.Rewrite(func(node parser.Node) parser.Node {
+		corners := strings.Split(node.Value, string(parser.RangeSeparator))
+		moved := make([]string, 0, len(corners))
+		for i, corner := range corners {
+			ref, ok := a1.Parse(corner)
+			if !ok {
+				return node
+			}
+
+			absolute := a1.Absolute{}
+			if i < len(node.Absolute) {
+				absolute = node.Absolute[i]
+			}
+			if !absolute.Row {
+				ref.Row += rows
+			}
+			if !absolute.Col {
+				ref.Col += cols
+			}
+
+			if !ref.InSheet() {
+				changed = true
+				return parser.Node{Kind: parser.KindError, Value: parser.ErrorRef}
+			}
+			moved = append(moved, ref.String())
+		}
+
+		if value := strings.Join(moved, string(parser.RangeSeparator)); value != strings.ToLower(node.Value) {
+			node.Value = value
+			changed = true
+		}
+		return node
+	})
+	if !changed {
+		return value
+	}
+
+	return parser.Print(rewritten)
+}
@@ -0,0 +1,246 @@
+package cell
+
+import (
+	"dev-challenge/internal/a1"
+	"dev-challenge/internal/evaluator"
+	"dev-challenge/internal/parser"
+	"strings"
+)
+
+// Ref identifies a cell across sheets.
+type Ref struct {
+	SheetID string
+	CellID  string
+}
+
+// newRef resolves a variable name of a formula which belongs to the sheet.
+// Sheet and cell ids are case-insensitive, so both are lowercased.
+func newRef(name, sheetID string) Ref {
+	refSheetID, cellID := parser.SplitRef(name)
+	if refSheetID == "" {
+		refSheetID = sheetID
+	}
+
+	return Ref{
+		SheetID: strings.ToLower(refSheetID),
+		CellID:  strings.ToLower(cellID),
+	}
+}
+
+// Dependency is a cell or a name a formula refers to, or an A1-style range
+// of cells, whose CellID is then the range, e.g. "a1:b3".
+type Dependency struct {
+	Ref
+	Range   a1.Range
+	IsRange bool
+}
+
+// Dependencies returns the cells, names and ranges the value's formula refers to.
+// Repositories index them, so that the dependents of a cell can be looked up
+// without parsing the formulas of every cell.
+func Dependencies(value, sheetID string) []Dependency {
+	tree, err := parser.Parse(value)
+	if err != nil {
+		return nil
+	}
+
+	vars := tree.Vars()
+	dependencies := make([]Dependency, 0, len(vars))
+	for _, name := range vars {
+		dependencies = append(dependencies, Dependency{Ref: newRef(name, sheetID)})
+	}
+
+	for _, qualified := range tree.Ranges() {
+		rangeRef := newRef(qualified, sheetID)
+		r, ok := a1.ParseRange(rangeRef.CellID)
+		// such ranges cannot be evaluated anyway
+		if !ok || r.Size() > evaluator.MaxRangeSize {
+			continue
+		}
+
+		dependencies = append(dependencies, Dependency{Ref: rangeRef, Range: r, IsRange: true})
+	}
+
+	return dependencies
+}
+
+// references returns cells and names the value's formula refers to,
+// including every cell of the ranges it uses.
+func references(value, sheetID string) []Ref {
+	dependencies := Dependencies(value, sheetID)
+
+	refs := make([]Ref, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		if !dependency.IsRange {
+			refs = append(refs, dependency.Ref)
+			continue
+		}
+
+		for _, cellRef := range dependency.Range.Refs() {
+			refs = append(refs, Ref{SheetID: dependency.SheetID, CellID: cellRef.String()})
+		}
+	}
+
+	return refs
+}
+
+// dependencyGraph maps cells and names to the cells and names referencing them.
+// It is loaded lazily with the indexed dependents of the cells and names a
+// recalculation reaches.
+type dependencyGraph struct {
+	repo       Repository
+	nameRepo   NameRepository
+	cells      map[Ref]Cell
+	names      map[Ref]bool
+	dependents map[Ref][]Ref
+	loaded     map[Ref]bool
+}
+
+func newDependencyGraph(repo Repository, nameRepo NameRepository) *dependencyGraph {
+	return &dependencyGraph{
+		repo:       repo,
+		nameRepo:   nameRepo,
+		cells:      make(map[Ref]Cell),
+		names:      make(map[Ref]bool),
+		dependents: make(map[Ref][]Ref),
+		loaded:     make(map[Ref]bool),
+	}
+}
+
+func (g *dependencyGraph) dependentsOf(ref Ref) ([]Ref, error) {
+	if !g.loaded[ref] {
+		if err := g.load(ref); err != nil {
+			return nil, err
+		}
+	}
+
+	return g.dependents[ref], nil
+}
+
+// hasSpilled is like Service.hasSpilled but finds the spilled cells among
+// the anchor's dependents, it must be called after dependentsOf(anchor).
+func (g *dependencyGraph) hasSpilled(anchor Ref) bool {
+	for _, ref := range g.dependents[anchor] {
+		if c, ok := g.cells[ref]; ok && ref.SheetID == anchor.SheetID && spilledFrom(c, anchor.CellID) {
+			return true
+		}
+	}
+	return false
+}
+
+// load adds the cells and names referencing any of the refs to the
+// dependents of the refs they reference, and marks the refs as loaded.
+func (g *dependencyGraph) load(refs ...Ref) error {
+	queried := make(map[Ref]bool, len(refs))
+	for _, ref := range refs {
+		queried[ref] = true
+	}
+
+	cells, err := g.repo.GetManyReferencing(refs)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range cells {
+		ref := Ref{SheetID: c.SheetID, CellID: c.CellID}
+		g.cells[ref] = c
+		g.link(ref, Dependencies(c.Value, c.SheetID), queried)
+	}
+
+	names, err := g.nameRepo.GetManyReferencing(refs)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range names {
+		ref := Ref{SheetID: n.SheetID, CellID: n.Name}
+		g.names[ref] = true
+		g.link(ref, Dependencies(n.Value, n.SheetID), queried)
+	}
+
+	for ref := range queried {
+		g.loaded[ref] = true
+	}
+	return nil
+}
+
+// link adds the dependent once to each of the queried refs it depends on. Ranges
+// are matched against the queried refs, so that they are never expanded.
+func (g *dependencyGraph) link(dependent Ref, dependencies []Dependency, queried map[Ref]bool) {
+	linked := make(map[Ref]bool)
+	add := func(ref Ref) {
+		if queried[ref] && !linked[ref] {
+			linked[ref] = true
+			g.dependents[ref] = append(g.dependents[ref], dependent)
+		}
+	}
+
+	for _, dependency := range dependencies {
+		if !dependency.IsRange {
+			add(dependency.Ref)
+			continue
+		}
+
+		for ref := range queried {
+			if cellRef, ok := a1.Parse(ref.CellID); ok && ref.SheetID == dependency.SheetID && dependency.Range.Contains(cellRef) {
+				add(ref)
+			}
+		}
+	}
+}
+
+// DependencyOrder sorts cells of a sheet so that every cell comes after the
+// cells of the same slice it references. Cells which are part of a reference
+// cycle (or depend on one) cannot be ordered and are returned separately.
+func DependencyOrder(cells []Cell) ([]Cell, []Cell) {
+	index := make(map[Ref]int, len(cells))
+	for i, c := range cells {
+		index[Ref{SheetID: c.SheetID, CellID: c.CellID}] = i
+	}
+
+	// number of not yet ordered cells of the slice each cell depends on
+	pending := make([]int, len(cells))
+	dependents := make(map[int][]int)
+	for i, c := range cells {
+		seen := make(map[int]bool)
+		for _, ref := range references(c.Value, c.SheetID) {
+			j, ok := index[ref]
+			if !ok || seen[j] {
+				continue
+			}
+			seen[j] = true
+			pending[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	queue := make([]int, 0, len(cells))
+	for i := range cells {
+		if pending[i] == 0 {
+			queue = append(queue, i)
+		}
+	}
+
+	ordered := make([]Cell, 0, len(cells))
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		ordered = append(ordered, cells[i])
+
+		for _, j := range dependents[i] {
+			pending[j]--
+			if pending[j] == 0 {
+				queue = append(queue, j)
+			}
+		}
+	}
+
+	cyclic := make([]Cell, 0)
+	for i, c := range cells {
+		if pending[i] > 0 {
+			cyclic = append(cyclic, c)
+		}
+	}
+
+	return ordered, cyclic
+}
@@ -0,0 +1,78 @@
+package cell_test
+
+import (
+	"dev-challenge/internal/cell"
+	"testing"
+)
+
+func TestDependencyOrder(t *testing.T) {
+	cells := []cell.Cell{
+		{CellID: "a1", Value: "=B1+C1"},
+		{CellID: "b1", Value: "=C1*2"},
+		{CellID: "c1", Value: "1"},
+		{CellID: "d1", Value: "=E1"},
+		{CellID: "e1", Value: "=D1"},
+		{CellID: "f1", Value: "=D1+missing"},
+	}
+
+	ordered, cyclic := cell.DependencyOrder(cells)
+
+	position := make(map[string]int)
+	for i, c := range ordered {
+		position[c.CellID] = i
+	}
+
+	if len(ordered) != 3 {
+		t.Fatalf("want (3) ordered cells got (%d)", len(ordered))
+	}
+
+	if !(position["c1"] < position["b1"] && position["b1"] < position["a1"]) {
+		t.Fatalf("cells are not in dependency order: %v", ordered)
+	}
+
+	if len(cyclic) != 3 {
+		t.Fatalf("want (3) cyclic cells got (%d)", len(cyclic))
+	}
+}
+
+func TestDependencyOrder_Ranges(t *testing.T) {
+	cells := []cell.Cell{
+		{CellID: "a3", Value: "=SUM(A1:A2)"},
+		{CellID: "a2", Value: "=A1*2"},
+		{CellID: "a1", Value: "1"},
+		{CellID: "b1", Value: "=SUM(B1:B2)"},
+	}
+
+	ordered, cyclic := cell.DependencyOrder(cells)
+
+	if len(ordered) != 3 || ordered[0].CellID != "a1" || ordered[1].CellID != "a2" || ordered[2].CellID != "a3" {
+		t.Fatalf("cells are not in dependency order: %v", ordered)
+	}
+
+	if len(cyclic) != 1 || cyclic[0].CellID != "b1" {
+		t.Fatalf("want (b1) to be cyclic got (%v)", cyclic)
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	dependencies := cell.Dependencies("=SUM(A1:B2) + other!C3 * tax_rate + SUM(a1:a200000)", "sheet")
+
+	want := []string{"sheet!a1:b2 range", "other!c3", "sheet!tax_rate"}
+	got := make(map[string]bool, len(dependencies))
+	for _, d := range dependencies {
+		key := d.SheetID + "!" + d.CellID
+		if d.IsRange {
+			key += " range"
+		}
+		got[key] = true
+	}
+
+	if len(dependencies) != len(want) {
+		t.Fatalf("want (%v) got (%v)", want, dependencies)
+	}
+	for _, key := range want {
+		if !got[key] {
+			t.Fatalf("want (%s) in (%v)", key, dependencies)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package cell
+
+import (
+	"dev-challenge/internal/evaluator"
+	"dev-challenge/internal/parser"
+	"errors"
+)
+
+const (
+	StageParse      = "parse"
+	StageEvaluation = "evaluation"
+)
+
+// ExpressionError tells why an expression cannot be evaluated: whether it is
+// not a valid formula or its evaluation fails, e.g. with the code #DIV/0!.
+type ExpressionError struct {
+	Stage   string `json:"stage"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *ExpressionError) Error() string {
+	return e.Message
+}
+
+// Evaluate computes the value against the current cells and names of the sheet
+// without writing anything. Failures are returned as an *ExpressionError.
+func (s *Service) Evaluate(sheetID, value string) (Cell, error) {
+	c := Cell{SheetID: sheetID, Value: value}
+
+	tree, err := parser.Parse(value)
+	if err != nil {
+		return Cell{}, &ExpressionError{Stage: StageParse, Message: err.Error()}
+	}
+
+	result, err := formatResult(evaluator.EvaluateValue(tree, resolver{
+		cell:     c,
+		getValue: s.lookup,
+		getRange: s.rangeLoader(),
+	}))
+	if err != nil {
+		expressionErr := &ExpressionError{Stage: StageEvaluation, Message: err.Error()}
+
+		var formulaErr *evaluator.Error
+		if errors.As(err, &formulaErr) {
+			expressionErr.Code = formulaErr.Code
+		}
+		return Cell{}, expressionErr
+	}
+
+	c.Result = result
+	c.Normalized = parser.Print(tree)
+	return c, nil
+}
@@ -0,0 +1,90 @@
+package cell
+
+import (
+	"dev-challenge/internal/evaluator"
+	"dev-challenge/internal/parser"
+	"sort"
+)
+
+// Explanation describes how the result of a cell is computed.
+// References of other sheets are qualified, e.g. "budget!a1".
+type Explanation struct {
+	Value  string      `json:"value"`
+	Result string      `json:"result"`
+	AST    parser.Tree `json:"ast"`
+	// Precedents are the cells, names and ranges the formula refers to directly.
+	Precedents []string `json:"precedents"`
+	// Dependents are the cells and names which refer to the cell directly.
+	Dependents []string        `json:"dependents"`
+	Trace      evaluator.Trace `json:"trace"`
+	// Error tells why the formula cannot be evaluated anymore.
+	Error string `json:"error,omitempty"`
+}
+
+// Explain parses and re-evaluates the cell's formula, recording every step.
+func (s *Service) Explain(sheetID, cellID string) (Explanation, error) {
+	c, err := s.cellRepo.GetOne(sheetID, cellID)
+	if err != nil {
+		return Explanation{}, err
+	}
+
+	explanation := Explanation{
+		Value:      c.Value,
+		Result:     c.Result,
+		Precedents: make([]string, 0),
+		Dependents: make([]string, 0),
+		Trace:      evaluator.Trace{Steps: make([]evaluator.Step, 0)},
+	}
+
+	graph := newDependencyGraph(s.cellRepo, s.nameRepo)
+	dependents, err := graph.dependentsOf(Ref{SheetID: c.SheetID, CellID: c.CellID})
+	if err != nil {
+		return Explanation{}, err
+	}
+	explanation.Dependents = describeRefs(dependents, c.SheetID)
+	sort.Strings(explanation.Dependents)
+
+	tree, err := parser.Parse(c.Value)
+	if err != nil {
+		explanation.Error = err.Error()
+		return explanation, nil
+	}
+	explanation.AST = tree
+
+	precedents := make([]Ref, 0)
+	for _, name := range append(tree.Vars(), tree.Ranges()...) {
+		precedents = append(precedents, newRef(name, c.SheetID))
+	}
+	explanation.Precedents = describeRefs(precedents, c.SheetID)
+
+	_, trace, err := evaluator.Explain(tree, resolver{
+		cell:     c,
+		getValue: s.lookup,
+		getRange: s.rangeLoader(),
+	})
+	explanation.Trace = trace
+	if err != nil {
+		explanation.Error = err.Error()
+	}
+
+	return explanation, nil
+}
+
+// describeRefs returns distinct refs, qualifying the ones which do not belong to the sheet.
+func describeRefs(refs []Ref, sheetID string) []string {
+	seen := make(map[Ref]bool, len(refs))
+	described := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+
+		node := parser.Node{Value: ref.CellID}
+		if ref.SheetID != sheetID {
+			node.Sheet = ref.SheetID
+		}
+		described = append(described, node.Ref())
+	}
+	return described
+}
@@ -0,0 +1,42 @@
+package cell
+
+import (
+	"dev-challenge/internal/parser"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+var ErrInvalidCellID = errors.New("invalid cell id")
+
+// cellIDPattern matches the cell ids of the routes, a cell with another id could not be requested.
+var cellIDPattern = regexp.MustCompile(`^[\w-]+$`)
+
+// reservedCellIDs are paths of sheet routes, which take precedence over the cell routes.
+var reservedCellIDs = map[string]bool{
+	"names":    true,
+	"events":   true,
+	"ws":       true,
+	"snapshot": true,
+	"import":   true,
+	"evaluate": true,
+	"copy":     true,
+	"fill":     true,
+}
+
+// validateCellID checks that the routes can serve and formulas can reference
+// a cell with the id, every new cell and new id of a renamed cell must pass it.
+func validateCellID(cellID string) error {
+	if !cellIDPattern.MatchString(cellID) {
+		return fmt.Errorf("%w: %s", ErrInvalidCellID, cellID)
+	}
+	if reservedCellIDs[cellID] {
+		return fmt.Errorf("%w: %s is reserved", ErrInvalidCellID, cellID)
+	}
+
+	tree, err := parser.Parse(cellID)
+	if err != nil || len(tree) != 1 || !tree[0].IsVar() || tree[0].Sheet != "" || tree[0].Value != cellID {
+		return fmt.Errorf("%w: %s", ErrInvalidCellID, cellID)
+	}
+	return nil
+}
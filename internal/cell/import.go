@@ -0,0 +1,158 @@
+package cell
+
+import (
+	"dev-challenge/internal/a1"
+	"dev-challenge/internal/evaluator"
+	"dev-challenge/internal/events"
+	"errors"
+	"log"
+)
+
+// Import evaluates the cells, possibly of several sheets, in dependency order against
+// each other and the stored cells, and writes the ones which can be evaluated in a
+// single transaction, creating the missing cells and updating the others. Unlike a
+// paste, cells which cannot be evaluated, including the ones of reference cycles,
+// are reported per sheet and left out while the rest is imported. Cells referencing
+// a cell which has been left out are evaluated against the stored one instead.
+func (s *Service) Import(cells []Cell) ([]Cell, map[string][]Failure, error) {
+	failures := make(map[string][]Failure)
+	fail := func(c Cell, err error) {
+		failures[c.SheetID] = append(failures[c.SheetID], Failure{
+			CellID:  c.CellID,
+			Value:   c.Value,
+			Message: err.Error(),
+		})
+	}
+
+	valid := make([]Cell, 0, len(cells))
+	for _, c := range cells {
+		if err := validateCellID(c.CellID); err != nil {
+			fail(c, err)
+			continue
+		}
+		valid = append(valid, c)
+	}
+
+	ordered, cyclic := DependencyOrder(valid)
+
+	// values of the imported cells which have not failed, by sheet
+	pending := make(map[string]map[string]string)
+	for _, c := range ordered {
+		if _, ok := pending[c.SheetID]; !ok {
+			pending[c.SheetID] = make(map[string]string)
+		}
+		pending[c.SheetID][c.CellID] = c.Value
+	}
+
+	evaluated := make([]Cell, 0, len(ordered))
+	loadRange := s.rangeLoader()
+	for _, c := range ordered {
+		result, err := formatResult(evaluateWith(resolver{
+			cell: c,
+			getValue: func(ref Ref) (string, error) {
+				if name, err := s.nameRepo.GetOne(ref.SheetID, ref.CellID); err == nil {
+					return name.Value, nil
+				}
+
+				if value, ok := pending[ref.SheetID][ref.CellID]; ok {
+					return value, nil
+				}
+				return s.lookup(ref)
+			},
+			getRange: func(rangeSheetID string, r a1.Range) (map[a1.Ref]string, error) {
+				formulas, err := loadRange(rangeSheetID, r)
+				if err != nil {
+					return nil, err
+				}
+
+				for cellID, value := range pending[rangeSheetID] {
+					if ref, ok := a1.Parse(cellID); ok && r.Contains(ref) {
+						formulas[ref] = value
+					}
+				}
+				return formulas, nil
+			},
+		}))
+		if err != nil {
+			fail(c, err)
+			delete(pending[c.SheetID], c.CellID)
+			continue
+		}
+
+		c.Result = result
+		c.Normalized = normalize(c.Value)
+		evaluated = append(evaluated, c)
+	}
+
+	for _, c := range cyclic {
+		fail(c, evaluator.ErrCircularReference)
+	}
+
+	existing, err := s.existing(evaluated)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	written, err := s.cellRepo.Import(evaluated)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	anchors := make([]Cell, 0)
+	for _, c := range written {
+		current, ok := existing[Ref{SheetID: c.SheetID, CellID: c.CellID}]
+		if !ok {
+			s.publish(events.TypeCellCreated, c)
+			continue
+		}
+		s.publish(events.TypeCellUpdated, c)
+
+		// cells written over spilled ones block the anchors' spill ranges
+		if anchorID, ok := spillAnchor(current); ok && c.Value != current.Value {
+			anchor, err := s.cellRepo.GetOne(c.SheetID, anchorID)
+			if err == nil {
+				anchors = append(anchors, anchor)
+			} else if !errors.Is(err, ErrNotFound) {
+				log.Println(err)
+			}
+		}
+	}
+
+	if err := s.recalculateAll(written); err != nil {
+		log.Println(err)
+	}
+	if err := s.recalculateAll(anchors); err != nil {
+		log.Println(err)
+	}
+
+	// results may have changed while the spill ranges were updated
+	for i, c := range written {
+		if current, err := s.cellRepo.GetOne(c.SheetID, c.CellID); err == nil {
+			written[i] = current
+		}
+	}
+
+	return written, failures, nil
+}
+
+// existing returns the stored cells of the sheets of the cells.
+func (s *Service) existing(cells []Cell) (map[Ref]Cell, error) {
+	existing := make(map[Ref]Cell)
+	loaded := make(map[string]bool)
+	for _, c := range cells {
+		if loaded[c.SheetID] {
+			continue
+		}
+		loaded[c.SheetID] = true
+
+		stored, err := s.cellRepo.GetManyBySheetID(c.SheetID)
+		if err != nil {
+			return nil, err
+		}
+		for _, sc := range stored {
+			existing[Ref{SheetID: sc.SheetID, CellID: sc.CellID}] = sc
+		}
+	}
+
+	return existing, nil
+}
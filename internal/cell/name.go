@@ -0,0 +1,78 @@
+package cell
+
+import (
+	"dev-challenge/internal/a1"
+	"dev-challenge/internal/parser"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+var ErrInvalidName = errors.New("invalid name")
+
+func (s *Service) GetNames(sheetID string) ([]Name, error) {
+	return s.nameRepo.GetManyBySheetID(sheetID)
+}
+
+func (s *Service) GetName(sheetID, name string) (Name, error) {
+	return s.nameRepo.GetOne(sheetID, strings.ToLower(name))
+}
+
+// UpsertName defines the name or changes its definition, which must be possible
+// to evaluate. Cells using the name are recalculated.
+func (s *Service) UpsertName(n Name) (Name, error) {
+	n.SheetID = strings.ToLower(n.SheetID)
+	n.Name = strings.ToLower(n.Name)
+
+	if err := validateName(n.Name); err != nil {
+		return Name{}, err
+	}
+
+	// a definition is evaluated like a cell of the sheet, so that
+	// definitions referencing themselves are caught
+	if _, err := s.evaluateValue(Cell{SheetID: n.SheetID, CellID: n.Name, Value: n.Value}); err != nil {
+		return Name{}, err
+	}
+
+	if err := s.nameRepo.Upsert(n); err != nil {
+		return Name{}, err
+	}
+
+	if err := s.recalculateDependents(Ref{SheetID: n.SheetID, CellID: n.Name}); err != nil {
+		log.Println(err)
+	}
+
+	return n, nil
+}
+
+// DeleteName removes the definition, cells using the name get the error result.
+func (s *Service) DeleteName(sheetID, name string) error {
+	sheetID = strings.ToLower(sheetID)
+	name = strings.ToLower(name)
+
+	if err := s.nameRepo.Delete(sheetID, name); err != nil {
+		return err
+	}
+
+	if err := s.recalculateDependents(Ref{SheetID: sheetID, CellID: name}); err != nil {
+		log.Println(err)
+	}
+
+	return nil
+}
+
+// validateName accepts identifiers which the parser reads as a single variable
+// and which cannot be confused with A1-style cell ids.
+func validateName(name string) error {
+	tree, err := parser.Parse(name)
+	if err != nil || len(tree) != 1 || !tree[0].IsVar() || tree[0].Sheet != "" || tree[0].Value != name {
+		return fmt.Errorf("%w: %s", ErrInvalidName, name)
+	}
+
+	if _, ok := a1.Parse(name); ok {
+		return fmt.Errorf("%w: %s is a cell id", ErrInvalidName, name)
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package cell
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	FieldValue      = "value"
+	FieldResult     = "result"
+	FieldNormalized = "normalized"
+)
+
+const (
+	DefaultPageSize = 1000
+	MaxPageSize     = 10000
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Query selects cells of a sheet ordered by their ids, a page at a time.
+type Query struct {
+	// Cursor is the id of the last cell of the previous page, empty for the first page.
+	Cursor string
+	// Limit is the maximum number of cells of the page.
+	Limit int
+	// Prefix selects the cells whose ids start with it.
+	Prefix string
+	// HasFormula selects either formulas or constants, both if it is nil, see IsFormula.
+	HasFormula *bool
+	// Error selects either cells with the error result or the others, both if it is nil.
+	Error *bool
+	// Fields are the fields of the cells to load besides their ids, all of them if empty.
+	Fields []string
+}
+
+// Page is a part of a sheet, NextCursor is the cursor of the next page, empty for the last one.
+type Page struct {
+	Cells      []Cell
+	NextCursor string
+}
+
+// IsFormula tells if the value is written as a formula, starting with "=" after any
+// leading spaces. The evaluator also computes values written without it, such as
+// "2+2", but those are constants for filtering, like in spreadsheet applications.
+func IsFormula(value string) bool {
+	return strings.HasPrefix(strings.TrimLeft(value, " "), "=")
+}
+
+// GetPage returns the cells of the sheet the query selects. Filters are
+// applied by the repository, which loads only the selected fields.
+func (s *Service) GetPage(sheetID string, query Query) (Page, error) {
+	if query.Limit == 0 {
+		query.Limit = DefaultPageSize
+	}
+	if query.Limit < 1 || query.Limit > MaxPageSize {
+		return Page{}, fmt.Errorf("%w: the limit must be between 1 and %d", ErrInvalidQuery, MaxPageSize)
+	}
+
+	for _, field := range query.Fields {
+		if field != FieldValue && field != FieldResult && field != FieldNormalized {
+			return Page{}, fmt.Errorf("%w: unknown field %s", ErrInvalidQuery, field)
+		}
+	}
+
+	// one more cell tells if there is a next page
+	limit := query.Limit
+	query.Limit++
+
+	cells, err := s.cellRepo.GetPage(sheetID, query)
+	if err != nil {
+		return Page{}, err
+	}
+
+	page := Page{Cells: cells}
+	if len(cells) > limit {
+		page.Cells = cells[:limit]
+		page.NextCursor = page.Cells[limit-1].CellID
+	}
+
+	return page, nil
+}
@@ -0,0 +1,28 @@
+package cell_test
+
+import (
+	"dev-challenge/internal/cell"
+	"testing"
+)
+
+func TestIsFormula(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{value: "=a1*2", want: true},
+		{value: "  =SUM(a1:a3)", want: true},
+		{value: "=5", want: true},
+		{value: "5", want: false},
+		{value: "2+2", want: false},
+		{value: "a1", want: false},
+		{value: "x=1", want: false},
+		{value: "", want: false},
+	}
+
+	for _, test := range tests {
+		if got := cell.IsFormula(test.value); got != test.want {
+			t.Fatalf("%q: want (%v) got (%v)", test.value, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package cell
+
+import (
+	"dev-challenge/internal/events"
+	"dev-challenge/internal/parser"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+var (
+	ErrInvalidRename = errors.New("cell cannot be renamed")
+	ErrCellExists    = errors.New("cell already exists")
+)
+
+// Renamed describes a renamed (or moved) cell and the cells and names
+// whose formulas have been rewritten to reference it by its new id.
+type Renamed struct {
+	CellID    string   `json:"cell_id"`
+	Value     string   `json:"value"`
+	Result    string   `json:"result"`
+	Rewritten []string `json:"rewritten"`
+}
+
+// Rename changes the id of the cell, which moves it if both ids are A1-style,
+// and rewrites the formulas of every cell and name, in any sheet, which
+// references it directly. Ranges keep their bounds even if the cell moves out
+// of them. If a name of the sheet has the cell's id the references resolve to
+// that name and are not rewritten.
+func (s *Service) Rename(sheetID, cellID, newCellID string) (Renamed, error) {
+	newCellID = strings.ToLower(newCellID)
+
+	c, err := s.cellRepo.GetOne(sheetID, cellID)
+	if err != nil {
+		return Renamed{}, err
+	}
+
+	if err := validateCellID(newCellID); err != nil {
+		return Renamed{}, fmt.Errorf("%w: %v", ErrInvalidRename, err)
+	}
+	if _, ok := spillAnchor(c); ok || s.hasSpilled(c) {
+		return Renamed{}, fmt.Errorf("%w: %s is a part of a spill range", ErrInvalidRename, cellID)
+	}
+
+	renamed := Renamed{CellID: newCellID, Value: c.Value, Result: c.Result, Rewritten: make([]string, 0)}
+	if newCellID == cellID {
+		return renamed, nil
+	}
+
+	if _, err := s.cellRepo.GetOne(sheetID, newCellID); !errors.Is(err, ErrNotFound) {
+		if err != nil {
+			return Renamed{}, err
+		}
+		return Renamed{}, fmt.Errorf("%w: %s", ErrCellExists, newCellID)
+	}
+	if _, err := s.nameRepo.GetOne(sheetID, newCellID); !errors.Is(err, ErrNotFound) {
+		if err != nil {
+			return Renamed{}, err
+		}
+		return Renamed{}, fmt.Errorf("%w: %s is a name", ErrCellExists, newCellID)
+	}
+
+	from := Ref{SheetID: sheetID, CellID: cellID}
+	cells, names, err := s.referencing(from, newCellID)
+	if err != nil {
+		return Renamed{}, err
+	}
+
+	if err := s.cellRepo.Rename(sheetID, cellID, newCellID, cells, names); err != nil {
+		return Renamed{}, err
+	}
+
+	moved := c
+	moved.CellID = newCellID
+	moved.Version++
+
+	s.publish(events.TypeCellDeleted, c)
+	s.publish(events.TypeCellCreated, moved)
+
+	rewritten := make([]Ref, 0, len(cells)+len(names))
+	for _, rc := range cells {
+		rc.Version++
+		s.publish(events.TypeCellUpdated, rc)
+		rewritten = append(rewritten, Ref{SheetID: rc.SheetID, CellID: rc.CellID})
+	}
+	for _, n := range names {
+		rewritten = append(rewritten, Ref{SheetID: n.SheetID, CellID: n.Name})
+	}
+	renamed.Rewritten = describeRefs(rewritten, sheetID)
+
+	// the cell may reference its new position and formulas may have referenced
+	// the new id before, ranges may not contain the cell anymore or contain it now
+	if err := s.recalculateAll([]Cell{moved}); err != nil {
+		log.Println(err)
+	}
+	if err := s.recalculateDependents(from); err != nil {
+		log.Println(err)
+	}
+
+	if current, err := s.cellRepo.GetOne(sheetID, newCellID); err == nil {
+		renamed.Result = current.Result
+	}
+
+	return renamed, nil
+}
+
+// referencing returns the cells and names which reference the cell directly
+// with their formulas rewritten to reference the new id instead.
+func (s *Service) referencing(from Ref, newCellID string) ([]Cell, []Name, error) {
+	cells := make([]Cell, 0)
+	names := make([]Name, 0)
+
+	// a name with the cell's id shadows the cell
+	if _, err := s.nameRepo.GetOne(from.SheetID, from.CellID); !errors.Is(err, ErrNotFound) {
+		return cells, names, err
+	}
+
+	graph := newDependencyGraph(s.cellRepo, s.nameRepo)
+	dependents, err := graph.dependentsOf(from)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seen := make(map[Ref]bool, len(dependents))
+	for _, ref := range dependents {
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+
+		if c, ok := graph.cells[ref]; ok {
+			if value, ok := rewriteReference(c.Value, c.SheetID, from, newCellID); ok {
+				c.Value = value
+				c.Normalized = normalize(value)
+				cells = append(cells, c)
+			}
+			continue
+		}
+
+		n, err := s.nameRepo.GetOne(ref.SheetID, ref.CellID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if value, ok := rewriteReference(n.Value, n.SheetID, from, newCellID); ok {
+			n.Value = value
+			names = append(names, n)
+		}
+	}
+
+	return cells, names, nil
+}
+
+// rewriteReference replaces the variables of the formula, which belongs to the sheet,
+// referencing the cell with its new id. It tells if any variable has been replaced.
+func rewriteReference(value, sheetID string, from Ref, newCellID string) (string, bool) {
+	tree, err := parser.Parse(value)
+	if err != nil {
+		return value, false
+	}
+
+	replaced := false
+	rewritten := tree.Rewrite(func(node parser.Node) parser.Node {
+		if node.IsVar() && newRef(node.Ref(), sheetID) == from {
+			node.Value = newCellID
+			replaced = true
+		}
+		return node
+	})
+	if !replaced {
+		return value, false
+	}
+
+	return parser.Print(rewritten), true
+}
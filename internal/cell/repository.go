@@ -3,12 +3,73 @@ package cell
 import "errors"
 
 var (
-	ErrNotFound = errors.New("entity not found")
+	ErrNotFound        = errors.New("entity not found")
+	ErrVersionConflict = errors.New("cell has been modified concurrently")
 )
 
 type Repository interface {
 	GetOne(sheetID, cellID string) (Cell, error)
 	GetManyBySheetID(sheetID string) ([]Cell, error)
+	// GetMany returns the existing cells of the sheet with the ids.
+	GetMany(sheetID string, cellIDs []string) ([]Cell, error)
+	// ForEachBySheetID calls fn for every cell of the sheet as it is read, without
+	// loading the whole sheet into memory. An error of fn stops the iteration and is returned.
+	ForEachBySheetID(sheetID string, fn func(Cell) error) error
+	// GetPage returns at most query.Limit cells of the sheet, which the query
+	// selects, ordered by their ids. Only the ids and query.Fields are loaded.
+	GetPage(sheetID string, query Query) ([]Cell, error)
+	// GetManyReferencingSheet returns cells of other sheets which may
+	// reference cells of the sheet. It is allowed to return false positives.
+	GetManyReferencingSheet(sheetID string) ([]Cell, error)
+	// GetManyReferencing returns cells of all sheets whose formulas reference any
+	// of the cells or names, directly or through a range, see Dependencies.
+	GetManyReferencing(refs []Ref) ([]Cell, error)
+	// GetManyContaining returns cells of all sheets whose value contains
+	// the text, case-insensitively.
+	GetManyContaining(text string) ([]Cell, error)
+	// GetSheetRevision returns a string which changes whenever any cell
+	// of the sheet is created or updated, or an empty string for an empty sheet.
+	GetSheetRevision(sheetID string) (string, error)
 	Insert(cell Cell) error
+	// Update stores the cell only if its version in the storage still equals
+	// cell.Version and increments it, otherwise ErrVersionConflict is returned.
 	Update(cell Cell) error
+	// ReplaceSheet deletes all cells of the sheet and inserts the given ones
+	// in a single transaction. Versions continue from the deleted cells with
+	// the same ids, so that stale ETags do not match the new cells.
+	ReplaceSheet(sheetID string, cells []Cell) ([]Cell, error)
+	// Rename changes the id of the cell and stores the rewritten values of the
+	// cells and names referencing it in a single transaction. The versions of
+	// the renamed and rewritten cells are incremented, if any of the rewritten
+	// cells has been modified in the meantime ErrVersionConflict is returned.
+	Rename(sheetID, cellID, newCellID string, cells []Cell, names []Name) error
+	// Restructure replaces the cells of the sheet like ReplaceSheet and stores the
+	// rewritten values of cells of other sheets, like Rename, and of names,
+	// all in a single transaction.
+	Restructure(sheetID string, cells []Cell, rewritten []Cell, names []Name) ([]Cell, error)
+	// Paste stores the cells of the sheet, creating the missing ones and incrementing
+	// the versions of the others, and deletes the cleared ones in a single transaction.
+	Paste(sheetID string, cells []Cell, cleared []string) ([]Cell, error)
+	// Import stores the cells of any sheets like Paste, in a single transaction.
+	Import(cells []Cell) ([]Cell, error)
+	// Spill creates the inserted cells, stores the results of the updated ones and
+	// deletes the removed ones of the sheet in a single transaction. If an updated
+	// or removed cell has been modified in the meantime ErrVersionConflict is
+	// returned, if an inserted one has been created ErrPreconditionFailed.
+	Spill(sheetID string, inserted, updated, removed []Cell) error
+}
+
+type NameRepository interface {
+	GetOne(sheetID, name string) (Name, error)
+	GetManyBySheetID(sheetID string) ([]Name, error)
+	// GetManyReferencingSheet returns names of other sheets which may
+	// reference cells of the sheet. It is allowed to return false positives.
+	GetManyReferencingSheet(sheetID string) ([]Name, error)
+	// GetManyReferencing returns names of all sheets whose definitions
+	// reference any of the cells or names, like Repository.GetManyReferencing.
+	GetManyReferencing(refs []Ref) ([]Name, error)
+	// Upsert creates the name or replaces its definition.
+	Upsert(name Name) error
+	// Delete returns ErrNotFound if the name is not defined.
+	Delete(sheetID, name string) error
 }
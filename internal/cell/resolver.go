@@ -0,0 +1,88 @@
+package cell
+
+import (
+	"dev-challenge/internal/a1"
+	"errors"
+	"strings"
+)
+
+// resolver provides formulas referenced while the cell is evaluated.
+// The cell itself resolves to its new value so that circular references are caught.
+type resolver struct {
+	cell     Cell
+	getValue func(ref Ref) (string, error)
+	getRange func(sheetID string, r a1.Range) (map[a1.Ref]string, error)
+}
+
+func (r resolver) Formula(id string) (string, error) {
+	ref := newRef(id, r.cell.SheetID)
+	if ref == (Ref{SheetID: r.cell.SheetID, CellID: r.cell.CellID}) {
+		return r.cell.Value, nil
+	}
+	return r.getValue(ref)
+}
+
+func (r resolver) Range(sheet string, cells a1.Range) (map[a1.Ref]string, error) {
+	sheetID := r.cell.SheetID
+	if sheet != "" {
+		sheetID = strings.ToLower(sheet)
+	}
+
+	formulas, err := r.getRange(sheetID, cells)
+	if err != nil {
+		return nil, err
+	}
+
+	if self, ok := a1.Parse(r.cell.CellID); ok && sheetID == r.cell.SheetID && cells.Contains(self) {
+		formulas[self] = r.cell.Value
+	}
+
+	return formulas, nil
+}
+
+// lookup returns the definition of a name or, if there is no such name,
+// the value of a cell. Names take precedence over cells with the same id.
+func (s *Service) lookup(ref Ref) (string, error) {
+	name, err := s.nameRepo.GetOne(ref.SheetID, ref.CellID)
+	if err == nil {
+		return name.Value, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return "", err
+	}
+
+	cell, err := s.cellRepo.GetOne(ref.SheetID, ref.CellID)
+	if err != nil {
+		return "", err
+	}
+	return cell.Value, nil
+}
+
+// rangeLoader returns a lookup of ranges for a single evaluation. Each sheet
+// is loaded in a single query, which the other ranges of the sheet reuse.
+func (s *Service) rangeLoader() func(sheetID string, r a1.Range) (map[a1.Ref]string, error) {
+	sheets := make(map[string][]Cell)
+
+	return func(sheetID string, r a1.Range) (map[a1.Ref]string, error) {
+		cells, ok := sheets[sheetID]
+		if !ok {
+			var err error
+			if cells, err = s.cellRepo.GetManyBySheetID(sheetID); err != nil {
+				return nil, err
+			}
+			sheets[sheetID] = cells
+		}
+
+		return cellsInRange(cells, r), nil
+	}
+}
+
+func cellsInRange(cells []Cell, r a1.Range) map[a1.Ref]string {
+	formulas := make(map[a1.Ref]string)
+	for _, c := range cells {
+		if ref, ok := a1.Parse(c.CellID); ok && r.Contains(ref) {
+			formulas[ref] = c.Value
+		}
+	}
+	return formulas
+}
@@ -1,19 +1,41 @@
 package cell
 
 import (
+	"dev-challenge/internal/a1"
 	"dev-challenge/internal/evaluator"
+	"dev-challenge/internal/events"
 	"dev-challenge/internal/parser"
 	"errors"
+	"log"
 	"strconv"
+	"strings"
 )
 
+const ResultError = "ERROR"
+
+var (
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+// Precondition decides whether a write may proceed given
+// the current state of the cell, exists is false for a new cell.
+type Precondition func(current Cell, exists bool) bool
+
+type Publisher interface {
+	Publish(e events.Event)
+}
+
 type Service struct {
-	cellRepo Repository
+	cellRepo  Repository
+	nameRepo  NameRepository
+	publisher Publisher
 }
 
-func NewService(cellRepo Repository) *Service {
+func NewService(cellRepo Repository, nameRepo NameRepository, publisher Publisher) *Service {
 	return &Service{
-		cellRepo: cellRepo,
+		cellRepo:  cellRepo,
+		nameRepo:  nameRepo,
+		publisher: publisher,
 	}
 }
 
@@ -35,35 +57,440 @@ func (s *Service) GetCellsBySheetID(sheetID string) ([]Cell, error) {
 	return cells, nil
 }
 
+// ForEachCell calls fn for every cell of the sheet without loading the whole sheet into memory.
+func (s *Service) ForEachCell(sheetID string, fn func(Cell) error) error {
+	return s.cellRepo.ForEachBySheetID(sheetID, fn)
+}
+
+func (s *Service) GetSheetRevision(sheetID string) (string, error) {
+	return s.cellRepo.GetSheetRevision(sheetID)
+}
+
 func (s *Service) UpsertCell(c Cell) (Cell, error) {
-	formulaTree, err := parser.Parse(c.Value)
-	if err != nil {
+	return s.UpsertCellIf(c, nil)
+}
+
+// UpsertCellIf creates or updates the cell only if the precondition holds,
+// otherwise ErrPreconditionFailed is returned. A nil precondition always holds.
+func (s *Service) UpsertCellIf(c Cell, precondition Precondition) (Cell, error) {
+	current, err := s.cellRepo.GetOne(c.SheetID, c.CellID)
+	exists := !errors.Is(err, ErrNotFound)
+	if err != nil && exists {
 		return Cell{}, err
 	}
 
-	result, err := evaluator.Evaluate(formulaTree, func(cellID string) (string, error) {
-		cell, err := s.cellRepo.GetOne(c.SheetID, cellID)
-		if err != nil {
-			return "", err
+	if precondition != nil && !precondition(current, exists) {
+		return Cell{}, ErrPreconditionFailed
+	}
+
+	if !exists {
+		if err := validateCellID(c.CellID); err != nil {
+			return Cell{}, err
 		}
-		return cell.Value, nil
-	})
+	}
+
+	value, err := s.evaluateValue(c)
+	result, err := formatResult(value, err)
 	if err != nil {
 		return Cell{}, err
 	}
 
-	c.Result = strconv.FormatFloat(result, 'f', -1, 32)
+	spills := spilling(value) || exists && s.hasSpilled(current)
+	plan := spillPlan{}
+	if spills {
+		// like on recalculation, a blocked array is stored with the error
+		// result and the previous spill range is cleared
+		plan, err = s.planSpill(c, value)
+		if errors.Is(err, ErrSpill) {
+			result = ResultError
+		} else if err != nil {
+			return Cell{}, err
+		}
+	}
+
+	c.Result = result
+	c.Normalized = normalize(c.Value)
 
-	_, err = s.cellRepo.GetOne(c.SheetID, c.CellID)
-	if errors.Is(err, ErrNotFound) {
+	eventType := events.TypeCellUpdated
+	if !exists {
 		if err := s.cellRepo.Insert(c); err != nil {
 			return Cell{}, err
 		}
+		c.Version = 1
+		eventType = events.TypeCellCreated
 	} else {
+		c.Version = current.Version
 		if err := s.cellRepo.Update(c); err != nil {
 			return Cell{}, err
 		}
+		c.Version++
+	}
+
+	s.publish(eventType, c)
+
+	changed := []Ref{{SheetID: c.SheetID, CellID: c.CellID}}
+	if spills {
+		refs, err := s.applySpill(c.SheetID, plan)
+		if err != nil {
+			return Cell{}, err
+		}
+		changed = append(changed, refs...)
+	}
+
+	if err := s.recalculateDependents(changed...); err != nil {
+		log.Println(err)
+	}
+
+	// a value written over a spilled one blocks the anchor's spill range
+	if anchorID, ok := spillAnchor(current); exists && ok && c.Value != current.Value {
+		anchor, err := s.cellRepo.GetOne(c.SheetID, anchorID)
+		if err == nil {
+			err = s.recalculateAll([]Cell{anchor})
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			log.Println(err)
+		}
 	}
 
 	return c, nil
 }
+
+// evaluateValue computes the cell's value against the stored cells and names.
+func (s *Service) evaluateValue(c Cell) (evaluator.Value, error) {
+	return evaluateWith(resolver{
+		cell:     c,
+		getValue: s.lookup,
+		getRange: s.rangeLoader(),
+	})
+}
+
+// evaluateWith computes the value of the resolver's cell.
+func evaluateWith(r resolver) (evaluator.Value, error) {
+	formulaTree, err := parser.Parse(r.cell.Value)
+	if err != nil {
+		return evaluator.Value{}, err
+	}
+
+	return evaluator.EvaluateValue(formulaTree, r)
+}
+
+// formatResult converts a value into a result of a cell, which must be a number, a text or a date.
+// The result of an array is its first value, the others spill into neighbouring cells.
+func formatResult(value evaluator.Value, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+
+	if value.IsArray() {
+		value = value.Array[0][0]
+	}
+
+	if value.IsText || value.IsDate {
+		return value.AsText()
+	}
+
+	result, err := value.Float()
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatFloat(result, 'f', -1, 32), nil
+}
+
+// normalize returns the value as a canonical formula, a value which cannot be parsed is kept as it is.
+func normalize(value string) string {
+	normalized, err := parser.Canonical(value)
+	if err != nil {
+		return value
+	}
+	return normalized
+}
+
+// ReplaceSheet atomically replaces all cells of the sheet with the given ones.
+// Results are evaluated against the new cells only, and if any of them has an
+// invalid id or cannot be evaluated nothing is written and the failures are returned.
+func (s *Service) ReplaceSheet(sheetID string, cells []Cell) ([]Cell, []Failure, error) {
+	values := make(map[string]string, len(cells))
+	for _, c := range cells {
+		values[c.CellID] = c.Value
+	}
+
+	failures := make([]Failure, 0)
+	evaluated := make([]Cell, 0, len(cells))
+	loadRange := s.rangeLoader()
+	for _, c := range cells {
+		c.SheetID = sheetID
+
+		if err := validateCellID(c.CellID); err != nil {
+			failures = append(failures, Failure{
+				CellID:  c.CellID,
+				Value:   c.Value,
+				Message: err.Error(),
+			})
+			continue
+		}
+
+		result, err := formatResult(evaluateWith(resolver{
+			cell: c,
+			getValue: func(ref Ref) (string, error) {
+				if ref.SheetID != sheetID {
+					return s.lookup(ref)
+				}
+
+				if name, err := s.nameRepo.GetOne(ref.SheetID, ref.CellID); err == nil {
+					return name.Value, nil
+				}
+
+				value, ok := values[ref.CellID]
+				if !ok {
+					return "", ErrNotFound
+				}
+				return value, nil
+			},
+			getRange: func(rangeSheetID string, r a1.Range) (map[a1.Ref]string, error) {
+				if rangeSheetID != sheetID {
+					return loadRange(rangeSheetID, r)
+				}
+				return cellsInRange(cells, r), nil
+			},
+		}))
+		if err != nil {
+			failures = append(failures, Failure{
+				CellID:  c.CellID,
+				Value:   c.Value,
+				Message: err.Error(),
+			})
+			continue
+		}
+
+		c.Result = result
+		c.Normalized = normalize(c.Value)
+		evaluated = append(evaluated, c)
+	}
+
+	if len(failures) > 0 {
+		return nil, failures, nil
+	}
+
+	previous, err := s.cellRepo.GetManyBySheetID(sheetID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	replaced, err := s.cellRepo.ReplaceSheet(sheetID, evaluated)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if s.publisher != nil {
+		s.publisher.Publish(events.Event{
+			Type:    events.TypeSheetReplaced,
+			SheetID: sheetID,
+		})
+	}
+
+	// cells of other sheets may reference both removed and new cells
+	changed := make([]Ref, 0, len(previous)+len(replaced))
+	for _, c := range append(previous, replaced...) {
+		changed = append(changed, Ref{SheetID: sheetID, CellID: c.CellID})
+	}
+
+	if err := s.recalculateDependents(changed...); err != nil {
+		log.Println(err)
+	}
+
+	return replaced, nil, nil
+}
+
+// recalculateDependents re-evaluates every cell, in any sheet, which directly
+// or transitively references the changed cells and stores the new results.
+// The cells referencing each cell are looked up in the repository's index.
+func (s *Service) recalculateDependents(changed ...Ref) error {
+	graph := newDependencyGraph(s.cellRepo, s.nameRepo)
+	if err := graph.load(changed...); err != nil {
+		return err
+	}
+
+	visited := make(map[Ref]bool)
+	queue := make([]Ref, 0)
+	spills := make([]pendingSpill, 0)
+	for _, ref := range changed {
+		visited[ref] = true
+
+		dependents, err := graph.dependentsOf(ref)
+		if err != nil {
+			return err
+		}
+		queue = append(queue, dependents...)
+	}
+
+	for len(queue) > 0 {
+		ref := queue[0]
+		queue = queue[1:]
+
+		if visited[ref] {
+			continue
+		}
+		visited[ref] = true
+
+		dependents, err := graph.dependentsOf(ref)
+		if err != nil {
+			return err
+		}
+		queue = append(queue, dependents...)
+
+		// names have no results, only their dependents are recalculated
+		c, ok := graph.cells[ref]
+		if !ok {
+			continue
+		}
+
+		spill, ok, err := s.recalculate(c, graph.hasSpilled(ref))
+		if err != nil {
+			return err
+		}
+		if ok {
+			spills = append(spills, spill)
+		}
+	}
+
+	// spill ranges change only once the graph is not used anymore
+	return s.respill(spills...)
+}
+
+// RecalculateCallingWith re-evaluates cells calling the function with the text
+// constant as its first argument, e.g. EXTERNAL_REF with the url of a remote
+// cell which has changed, and their dependents.
+func (s *Service) RecalculateCallingWith(name, text string) error {
+	// a quote is doubled within a text constant
+	containing, err := s.cellRepo.GetManyContaining(strings.ReplaceAll(text, `"`, `""`))
+	if err != nil {
+		return err
+	}
+
+	cells := make([]Cell, 0, len(containing))
+	for _, c := range containing {
+		tree, err := parser.Parse(c.Value)
+		if err == nil && tree.CallsWith(name, text) {
+			cells = append(cells, c)
+		}
+	}
+
+	return s.recalculateAll(cells)
+}
+
+// RecalculateCalling re-evaluates cells calling the function, e.g. one
+// which has been redefined, and their dependents.
+func (s *Service) RecalculateCalling(name string) error {
+	cells, err := s.calling(name)
+	if err != nil {
+		return err
+	}
+
+	return s.recalculateAll(cells)
+}
+
+// calling returns cells of all sheets whose formulas call the function. Cells containing
+// the name are filtered by their formulas, so that neither a function whose name ends
+// with it, e.g. MYSUM for SUM, nor a text containing it match. The name is matched
+// alone since spaces may precede the parenthesis of a call, e.g. =MYFN (1).
+func (s *Service) calling(name string) ([]Cell, error) {
+	containing, err := s.cellRepo.GetManyContaining(name)
+	if err != nil {
+		return nil, err
+	}
+
+	cells := make([]Cell, 0, len(containing))
+	for _, c := range containing {
+		tree, err := parser.Parse(c.Value)
+		if err != nil {
+			continue
+		}
+		for _, called := range tree.Funcs() {
+			if strings.EqualFold(called, name) {
+				cells = append(cells, c)
+				break
+			}
+		}
+	}
+
+	return cells, nil
+}
+
+// recalculateAll re-evaluates the cells and then their dependents.
+func (s *Service) recalculateAll(cells []Cell) error {
+	changed := make([]Ref, 0, len(cells))
+	spills := make([]pendingSpill, 0)
+	for _, c := range cells {
+		spill, ok, err := s.recalculate(c, s.hasSpilled(c))
+		if err != nil {
+			return err
+		}
+		if ok {
+			spills = append(spills, spill)
+		}
+		changed = append(changed, Ref{SheetID: c.SheetID, CellID: c.CellID})
+	}
+
+	if err := s.recalculateDependents(changed...); err != nil {
+		return err
+	}
+	return s.respill(spills...)
+}
+
+// recalculate stores and publishes the cell's result if it has changed.
+// Formulas which cannot be evaluated anymore, or whose array cannot spill,
+// get the error result. If the cell spills, or may have spilled before, its
+// value is returned to update the spill range. Spilled cells are skipped,
+// their results are written when their anchor spills.
+func (s *Service) recalculate(c Cell, spilled bool) (pendingSpill, bool, error) {
+	if _, ok := spillAnchor(c); ok {
+		return pendingSpill{}, false, nil
+	}
+
+	value, err := s.evaluateValue(c)
+	result, err := formatResult(value, err)
+	if err != nil {
+		result = ResultError
+	}
+
+	if spilling(value) {
+		if _, err := s.planSpill(c, value); errors.Is(err, ErrSpill) {
+			result = ResultError
+		} else if err != nil {
+			return pendingSpill{}, false, err
+		}
+	}
+
+	spill := pendingSpill{anchor: Ref{SheetID: c.SheetID, CellID: c.CellID}, value: value}
+	spills := spilled || spilling(value)
+
+	if result == c.Result {
+		return spill, spills, nil
+	}
+
+	c.Result = result
+	c.Normalized = normalize(c.Value)
+	if err := s.cellRepo.Update(c); err != nil {
+		return pendingSpill{}, false, err
+	}
+	c.Version++
+	s.publish(events.TypeResultRecalculated, c)
+
+	return spill, spills, nil
+}
+
+func (s *Service) publish(eventType string, c Cell) {
+	if s.publisher == nil {
+		return
+	}
+
+	s.publisher.Publish(events.Event{
+		Type:    eventType,
+		SheetID: c.SheetID,
+		CellID:  c.CellID,
+		Value:   c.Value,
+		Result:  c.Result,
+		Version: c.Version,
+	})
+}
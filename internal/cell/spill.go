@@ -0,0 +1,233 @@
+package cell
+
+import (
+	"dev-challenge/internal/a1"
+	"dev-challenge/internal/evaluator"
+	"dev-challenge/internal/events"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// ErrSpill is returned when an array result cannot spill into neighbouring cells.
+var ErrSpill = &evaluator.Error{Code: "#SPILL!", Message: "array result cannot spill"}
+
+// An array result of a formula spills from its anchor cell, which gets the first
+// value, into the neighbouring cells to the right and below. Those cells are
+// stored with a formula picking their value out of the anchor's array, which
+// formulas referencing them evaluate, and with the value as their result, which
+// is written whenever the anchor is recalculated.
+var spillPattern = regexp.MustCompile(`^=INDEX\(([a-z]+[0-9]+), ([0-9]+), ([0-9]+)\)$`)
+
+// spillValue is the formula of the cell at the one-based row and column of the anchor's array.
+func spillValue(anchorID string, row, col int) string {
+	return fmt.Sprintf("=INDEX(%s, %d, %d)", anchorID, row, col)
+}
+
+// spilledFrom tells if the anchor's array has spilled into the cell.
+func spilledFrom(c Cell, anchorID string) bool {
+	anchor, ok := a1.Parse(anchorID)
+	if !ok {
+		return false
+	}
+
+	ref, ok := a1.Parse(c.CellID)
+	if !ok || ref.Row < anchor.Row || ref.Col < anchor.Col {
+		return false
+	}
+
+	return c.Value == spillValue(anchorID, ref.Row-anchor.Row+1, ref.Col-anchor.Col+1)
+}
+
+// spillAnchor returns the id of the cell whose array has spilled into the cell.
+func spillAnchor(c Cell) (string, bool) {
+	match := spillPattern.FindStringSubmatch(c.Value)
+	if match == nil || !spilledFrom(c, match[1]) {
+		return "", false
+	}
+	return match[1], true
+}
+
+// spilling tells if the value is an array of more than one value.
+func spilling(value evaluator.Value) bool {
+	return value.IsArray() && (len(value.Array) > 1 || len(value.Array[0]) > 1)
+}
+
+// hasSpilled tells if the anchor's array has spilled into neighbouring cells.
+func (s *Service) hasSpilled(anchor Cell) bool {
+	ref, ok := a1.Parse(anchor.CellID)
+	if !ok {
+		return false
+	}
+
+	// an array of more than one value spills at least to the right or below
+	for _, neighbour := range []a1.Ref{{Col: ref.Col + 1, Row: ref.Row}, {Col: ref.Col, Row: ref.Row + 1}} {
+		c, err := s.cellRepo.GetOne(anchor.SheetID, neighbour.String())
+		if err == nil && spilledFrom(c, anchor.CellID) {
+			return true
+		}
+	}
+	return false
+}
+
+// spillPlan lists cells to create, update and delete so that the anchor's array fills its spill range.
+type spillPlan struct {
+	insert []Cell
+	update []Cell
+	remove []Cell
+}
+
+// planSpill returns the changes of the anchor's spill range. Spilled cells get
+// the values of the array as their results, they are never evaluated on their
+// own. If the array cannot spill, since the anchor is not an A1-style cell or
+// any of the cells is beyond the sheet or not empty, the error is returned
+// along with a plan which clears the previous spill range.
+func (s *Service) planSpill(anchor Cell, value evaluator.Value) (spillPlan, error) {
+	// spilled cells reference the anchor, so the index of references finds them
+	referencing, err := s.cellRepo.GetManyReferencing([]Ref{{SheetID: anchor.SheetID, CellID: anchor.CellID}})
+	if err != nil {
+		return spillPlan{}, err
+	}
+
+	previous := make(map[string]Cell)
+	for _, c := range referencing {
+		if c.SheetID == anchor.SheetID && spilledFrom(c, anchor.CellID) {
+			previous[c.CellID] = c
+		}
+	}
+
+	cleared := spillPlan{remove: make([]Cell, 0, len(previous))}
+	for _, c := range previous {
+		cleared.remove = append(cleared.remove, c)
+	}
+
+	if !value.IsArray() {
+		return cleared, nil
+	}
+
+	ref, ok := a1.Parse(anchor.CellID)
+	if !ok {
+		return cleared, fmt.Errorf("%w: %s is not an A1-style cell id", ErrSpill, anchor.CellID)
+	}
+
+	targets := make([]string, 0)
+	for row, values := range value.Array {
+		for col := range values {
+			target := a1.Ref{Col: ref.Col + col, Row: ref.Row + row}
+			if !target.InSheet() {
+				return cleared, fmt.Errorf("%w: the array does not fit into the sheet", ErrSpill)
+			}
+			if _, ok := previous[target.String()]; !ok && (row > 0 || col > 0) {
+				targets = append(targets, target.String())
+			}
+		}
+	}
+
+	occupied, err := s.cellRepo.GetMany(anchor.SheetID, targets)
+	if err != nil {
+		return spillPlan{}, err
+	}
+	if len(occupied) > 0 {
+		return cleared, fmt.Errorf("%w: cell %s is not empty", ErrSpill, occupied[0].CellID)
+	}
+
+	plan := spillPlan{insert: make([]Cell, 0), update: make([]Cell, 0)}
+	for row, values := range value.Array {
+		for col, v := range values {
+			if row == 0 && col == 0 {
+				continue
+			}
+
+			result, err := formatResult(v, nil)
+			if err != nil {
+				result = ResultError
+			}
+
+			cellID := a1.Ref{Col: ref.Col + col, Row: ref.Row + row}.String()
+			if c, ok := previous[cellID]; ok {
+				delete(previous, cellID)
+				if c.Result != result {
+					c.Result = result
+					plan.update = append(plan.update, c)
+				}
+				continue
+			}
+
+			value := spillValue(anchor.CellID, row+1, col+1)
+			plan.insert = append(plan.insert, Cell{
+				SheetID:    anchor.SheetID,
+				CellID:     cellID,
+				Value:      value,
+				Result:     result,
+				Normalized: value,
+			})
+		}
+	}
+
+	plan.remove = make([]Cell, 0, len(previous))
+	for _, c := range previous {
+		plan.remove = append(plan.remove, c)
+	}
+	return plan, nil
+}
+
+// applySpill writes the planned changes in a single transaction and returns the changed cells.
+func (s *Service) applySpill(sheetID string, plan spillPlan) ([]Ref, error) {
+	if len(plan.insert) == 0 && len(plan.update) == 0 && len(plan.remove) == 0 {
+		return nil, nil
+	}
+
+	if err := s.cellRepo.Spill(sheetID, plan.insert, plan.update, plan.remove); err != nil {
+		return nil, err
+	}
+
+	changed := make([]Ref, 0, len(plan.insert)+len(plan.update)+len(plan.remove))
+	for _, c := range plan.insert {
+		c.Version = 1
+		s.publish(events.TypeCellCreated, c)
+		changed = append(changed, Ref{SheetID: c.SheetID, CellID: c.CellID})
+	}
+	for _, c := range plan.update {
+		c.Version++
+		s.publish(events.TypeResultRecalculated, c)
+		changed = append(changed, Ref{SheetID: c.SheetID, CellID: c.CellID})
+	}
+	for _, c := range plan.remove {
+		s.publish(events.TypeCellDeleted, c)
+		changed = append(changed, Ref{SheetID: c.SheetID, CellID: c.CellID})
+	}
+
+	return changed, nil
+}
+
+// pendingSpill is an array of a recalculated anchor, which has to spill once the recalculation is done.
+type pendingSpill struct {
+	anchor Ref
+	value  evaluator.Value
+}
+
+// respill updates the spill ranges of the anchors, which have already been
+// recalculated, and recalculates the cells referencing the changed cells.
+func (s *Service) respill(spills ...pendingSpill) error {
+	changed := make([]Ref, 0)
+	for _, spill := range spills {
+		anchor := Cell{SheetID: spill.anchor.SheetID, CellID: spill.anchor.CellID}
+
+		// a blocked range is cleared, the anchor has got the error result
+		plan, err := s.planSpill(anchor, spill.value)
+		if err != nil && !errors.Is(err, ErrSpill) {
+			return err
+		}
+
+		refs, err := s.applySpill(anchor.SheetID, plan)
+		if err != nil {
+			return err
+		}
+		changed = append(changed, refs...)
+	}
+
+	if len(changed) == 0 {
+		return nil
+	}
+	return s.recalculateDependents(changed...)
+}
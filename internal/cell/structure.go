@@ -0,0 +1,323 @@
+package cell
+
+import (
+	"dev-challenge/internal/a1"
+	"dev-challenge/internal/events"
+	"dev-challenge/internal/parser"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+const (
+	DimensionRows    = "rows"
+	DimensionColumns = "columns"
+)
+
+var ErrInvalidShift = errors.New("invalid row or column operation")
+
+// Shift inserts Count rows or columns before the one at the one-based
+// index At, or deletes Count of them starting with it.
+type Shift struct {
+	Dimension string
+	At        int
+	Count     int
+	Delete    bool
+}
+
+// Restructured describes the cells changed by inserting or deleting rows or columns.
+type Restructured struct {
+	// Moved is the number of cells whose id has changed.
+	Moved int `json:"moved"`
+	// Deleted are the cells of the deleted rows or columns.
+	Deleted []string `json:"deleted"`
+	// Rewritten are the cells and names whose formulas have changed,
+	// cells of the sheet are listed with their new ids.
+	Rewritten []string `json:"rewritten"`
+}
+
+// Shift inserts or deletes rows or columns of the sheet the way spreadsheet
+// applications do: A1-style cells after them move, cells of deleted rows or
+// columns are deleted, and references and ranges of every formula, in any
+// sheet, are rewritten to keep referring to the same cells. References to
+// deleted cells become #REF!, ranges shrink or grow. Absolute parts of
+// references, such as the row of "a$1", are left as they are.
+func (s *Service) Shift(sheetID string, sh Shift) (Restructured, error) {
+	if sh.Dimension != DimensionRows && sh.Dimension != DimensionColumns {
+		return Restructured{}, fmt.Errorf("%w: unknown dimension %s", ErrInvalidShift, sh.Dimension)
+	}
+	if sh.At < 1 || sh.Count < 1 {
+		return Restructured{}, fmt.Errorf("%w: the position and the count must be positive", ErrInvalidShift)
+	}
+	// larger ones would make coordinates overflow
+	if sh.At > sh.last() || sh.Count > sh.last() {
+		return Restructured{}, fmt.Errorf("%w: the position and the count must be at most %d", ErrInvalidShift, sh.last())
+	}
+
+	own, err := s.cellRepo.GetManyBySheetID(sheetID)
+	if err != nil {
+		return Restructured{}, err
+	}
+	referencing, err := s.cellRepo.GetManyReferencingSheet(sheetID)
+	if err != nil {
+		return Restructured{}, err
+	}
+	ownNames, err := s.nameRepo.GetManyBySheetID(sheetID)
+	if err != nil {
+		return Restructured{}, err
+	}
+	referencingNames, err := s.nameRepo.GetManyReferencingSheet(sheetID)
+	if err != nil {
+		return Restructured{}, err
+	}
+
+	restructured := Restructured{Deleted: make([]string, 0)}
+	rewritten := make([]Ref, 0)
+	// the previous positions, formulas referencing them absolutely now reference other cells
+	changed := make([]Ref, 0, len(own))
+
+	cells := make([]Cell, 0, len(own))
+	for _, c := range own {
+		changed = append(changed, Ref{SheetID: sheetID, CellID: c.CellID})
+
+		if ref, ok := a1.Parse(c.CellID); ok {
+			moved, ok := sh.move(ref)
+			if !ok && !sh.Delete {
+				return Restructured{}, fmt.Errorf("%w: %s would move beyond the last %s", ErrInvalidShift, c.CellID, strings.TrimSuffix(sh.Dimension, "s"))
+			}
+			if !ok {
+				restructured.Deleted = append(restructured.Deleted, c.CellID)
+				continue
+			}
+			if moved != ref {
+				c.CellID = moved.String()
+				restructured.Moved++
+			}
+		}
+
+		if value, ok := sh.rewrite(c.Value, sheetID, sheetID); ok {
+			c.Value = value
+			c.Normalized = normalize(value)
+			rewritten = append(rewritten, Ref{SheetID: sheetID, CellID: c.CellID})
+		}
+		cells = append(cells, c)
+	}
+
+	others := make([]Cell, 0)
+	for _, c := range referencing {
+		if value, ok := sh.rewrite(c.Value, c.SheetID, sheetID); ok {
+			c.Value = value
+			c.Normalized = normalize(value)
+			others = append(others, c)
+			rewritten = append(rewritten, Ref{SheetID: c.SheetID, CellID: c.CellID})
+		}
+	}
+
+	names := make([]Name, 0)
+	for _, n := range append(ownNames, referencingNames...) {
+		if value, ok := sh.rewrite(n.Value, n.SheetID, sheetID); ok {
+			n.Value = value
+			names = append(names, n)
+			ref := Ref{SheetID: n.SheetID, CellID: n.Name}
+			rewritten = append(rewritten, ref)
+			changed = append(changed, ref)
+		}
+	}
+	restructured.Rewritten = describeRefs(rewritten, sheetID)
+
+	replaced, err := s.cellRepo.Restructure(sheetID, cells, others, names)
+	if err != nil {
+		return Restructured{}, err
+	}
+
+	if s.publisher != nil {
+		s.publisher.Publish(events.Event{
+			Type:    events.TypeSheetReplaced,
+			SheetID: sheetID,
+		})
+	}
+	for i := range others {
+		others[i].Version++
+		s.publish(events.TypeCellUpdated, others[i])
+	}
+
+	if err := s.recalculateAll(append(replaced, others...)); err != nil {
+		log.Println(err)
+	}
+	if err := s.recalculateDependents(changed...); err != nil {
+		log.Println(err)
+	}
+
+	return restructured, nil
+}
+
+// last returns the last row or column of a sheet, whichever the shift changes.
+func (sh Shift) last() int {
+	if sh.Dimension == DimensionRows {
+		return a1.MaxRow
+	}
+	return a1.MaxCol
+}
+
+// coordinate returns the row or the column of the position, whichever the shift changes.
+func (sh Shift) coordinate(ref a1.Ref) int {
+	if sh.Dimension == DimensionRows {
+		return ref.Row
+	}
+	return ref.Col
+}
+
+func (sh Shift) withCoordinate(ref a1.Ref, coordinate int) a1.Ref {
+	if sh.Dimension == DimensionRows {
+		ref.Row = coordinate
+	} else {
+		ref.Col = coordinate
+	}
+	return ref
+}
+
+func (sh Shift) absolute(absolute a1.Absolute) bool {
+	if sh.Dimension == DimensionRows {
+		return absolute.Row
+	}
+	return absolute.Col
+}
+
+// shift returns the new row or column of a cell, ok is false if it is deleted
+// or, when inserting, if it would move beyond the last row or column.
+func (sh Shift) shift(coordinate int) (int, bool) {
+	switch {
+	case coordinate < sh.At:
+		return coordinate, true
+	case !sh.Delete:
+		return coordinate + sh.Count, coordinate <= sh.last()-sh.Count
+	case coordinate >= sh.At+sh.Count:
+		return coordinate - sh.Count, true
+	}
+	return 0, false
+}
+
+// move returns the new position of a cell, ok is false if it is deleted.
+func (sh Shift) move(ref a1.Ref) (a1.Ref, bool) {
+	coordinate, ok := sh.shift(sh.coordinate(ref))
+	if !ok {
+		return a1.Ref{}, false
+	}
+	return sh.withCoordinate(ref, coordinate), true
+}
+
+// bounds returns the new first and last row or column of a range, ok is false if all of them are deleted
+// or moved beyond the sheet. An absolute bound does not change, a deleted one moves to the closest row or
+// column which remains, and one moved beyond the sheet to its last row or column.
+func (sh Shift) bounds(first, last int, absoluteFirst, absoluteLast bool) (int, int, bool) {
+	if !absoluteFirst {
+		shifted, ok := sh.shift(first)
+		switch {
+		case ok:
+			first = shifted
+		case sh.Delete:
+			first = sh.At
+		default:
+			return 0, 0, false
+		}
+	}
+
+	if !absoluteLast {
+		shifted, ok := sh.shift(last)
+		switch {
+		case ok:
+			last = shifted
+		case sh.Delete:
+			last = sh.At - 1
+		default:
+			last = sh.last()
+		}
+	}
+
+	return first, last, first <= last
+}
+
+// rewrite rewrites references of the formula, which belongs to the formula's sheet,
+// to cells of the shifted sheet. It tells if the formula has changed.
+func (sh Shift) rewrite(value, formulaSheetID, sheetID string) (string, bool) {
+	tree, err := parser.Parse(value)
+	if err != nil {
+		return value, false
+	}
+
+	changed := false
+	rewritten := tree.Rewrite(func(node parser.Node) parser.Node {
+		refSheetID := formulaSheetID
+		if node.Sheet != "" {
+			refSheetID = strings.ToLower(node.Sheet)
+		}
+		if refSheetID != sheetID {
+			return node
+		}
+
+		shifted := sh.rewriteNode(node)
+		if shifted.Kind != node.Kind || !strings.EqualFold(shifted.Value, node.Value) {
+			changed = true
+		}
+		return shifted
+	})
+	if !changed {
+		return value, false
+	}
+
+	return parser.Print(rewritten), true
+}
+
+// rewriteNode shifts an A1-style variable or range, other variables are returned as they are.
+func (sh Shift) rewriteNode(node parser.Node) parser.Node {
+	corners := strings.Split(node.Value, string(parser.RangeSeparator))
+	refs := make([]a1.Ref, 0, len(corners))
+	for _, corner := range corners {
+		ref, ok := a1.Parse(corner)
+		if !ok {
+			return node
+		}
+		refs = append(refs, ref)
+	}
+
+	absolute := make([]a1.Absolute, len(refs))
+	copy(absolute, node.Absolute)
+
+	deleted := parser.Node{Kind: parser.KindError, Value: parser.ErrorRef}
+
+	if node.IsVar() {
+		if sh.absolute(absolute[0]) {
+			return node
+		}
+		moved, ok := sh.move(refs[0])
+		if !ok {
+			return deleted
+		}
+		node.Value = moved.String()
+		return node
+	}
+
+	if len(refs) != 2 {
+		return node
+	}
+
+	// corners may be given in any order
+	from, to := 0, 1
+	if sh.coordinate(refs[from]) > sh.coordinate(refs[to]) {
+		from, to = to, from
+	}
+
+	first, last, ok := sh.bounds(
+		sh.coordinate(refs[from]), sh.coordinate(refs[to]),
+		sh.absolute(absolute[from]), sh.absolute(absolute[to]),
+	)
+	if !ok {
+		return deleted
+	}
+
+	refs[from] = sh.withCoordinate(refs[from], first)
+	refs[to] = sh.withCoordinate(refs[to], last)
+	node.Value = refs[0].String() + string(parser.RangeSeparator) + refs[1].String()
+	return node
+}
@@ -0,0 +1,49 @@
+package cell
+
+import (
+	"dev-challenge/internal/evaluator"
+	"log"
+	"time"
+)
+
+// RecalculateVolatile re-evaluates cells calling volatile functions,
+// e.g. TODAY or NOW, and their dependents.
+func (s *Service) RecalculateVolatile() error {
+	seen := make(map[Ref]bool)
+	cells := make([]Cell, 0)
+	for _, name := range evaluator.VolatileFunctions() {
+		calling, err := s.calling(name)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range calling {
+			ref := Ref{SheetID: c.SheetID, CellID: c.CellID}
+			if seen[ref] {
+				continue
+			}
+			seen[ref] = true
+			cells = append(cells, c)
+		}
+	}
+
+	return s.recalculateAll(cells)
+}
+
+// RefreshVolatile recalculates cells calling volatile functions
+// every interval until stop is closed.
+func (s *Service) RefreshVolatile(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.RecalculateVolatile(); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
@@ -4,7 +4,12 @@ import (
 	"database/sql"
 	"dev-challenge/internal/cell"
 	"errors"
+	"fmt"
 	"log"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
 )
 
 type CellRepo struct {
@@ -18,10 +23,42 @@ func NewCellRepository(db *sql.DB) *CellRepo {
 }
 
 func (cr *CellRepo) CreateTableIfNotExists() {
-	_, err := cr.db.Exec("create table if not exists sheetcell (sheet_id text not null, cell_id text not null, value text not null, result text)")
+	_, err := cr.db.Exec("create table if not exists sheetcell (sheet_id text not null, cell_id text not null, value text not null, result text, version integer not null default 1, normalized text not null default '')")
+	if err != nil {
+		log.Println(err)
+	}
+
+	// tables created before cells were versioned
+	_, err = cr.db.Exec("alter table sheetcell add column if not exists version integer not null default 1")
+	if err != nil {
+		log.Println(err)
+	}
+
+	// tables created before values were normalized
+	_, err = cr.db.Exec("alter table sheetcell add column if not exists normalized text not null default ''")
+	if err != nil {
+		log.Println(err)
+	}
+
+	// a cell id is unique within its sheet, the index also serves pages read in the order of cell ids
+	_, err = cr.db.Exec("create unique index if not exists sheetcell_sheet_id_cell_id_key on sheetcell (sheet_id, cell_id)")
 	if err != nil {
 		log.Println(err)
 	}
+
+	cellRefs.createTableIfNotExists(cr.db, "select sheet_id, cell_id, value from sheetcell")
+}
+
+// uniqueViolation is the code of errors of statements which would store a cell id twice in a sheet.
+const uniqueViolation = "23505"
+
+// checkUnique reports a cell created concurrently with the same id as a failed precondition.
+func checkUnique(err error) error {
+	pqErr := &pq.Error{}
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return fmt.Errorf("%w: %s", cell.ErrPreconditionFailed, pqErr.Detail)
+	}
+	return err
 }
 
 func (cr *CellRepo) GetOne(sheetID, cellID string) (cell.Cell, error) {
@@ -30,8 +67,8 @@ func (cr *CellRepo) GetOne(sheetID, cellID string) (cell.Cell, error) {
 		SheetID: sheetID,
 	}
 
-	query := "select value, result from sheetcell where sheet_id = $1 and cell_id = $2"
-	if err := cr.db.QueryRow(query, sheetID, cellID).Scan(&c.Value, &c.Result); err != nil {
+	query := "select value, normalized, result, version from sheetcell where sheet_id = $1 and cell_id = $2"
+	if err := cr.db.QueryRow(query, sheetID, cellID).Scan(&c.Value, &c.Normalized, &c.Result, &c.Version); err != nil {
 		return cell.Cell{}, cell.ErrNotFound
 	}
 
@@ -39,7 +76,7 @@ func (cr *CellRepo) GetOne(sheetID, cellID string) (cell.Cell, error) {
 }
 
 func (cr *CellRepo) GetManyBySheetID(sheetID string) ([]cell.Cell, error) {
-	query := "select cell_id, value, result from sheetcell where sheet_id = $1"
+	query := "select cell_id, value, normalized, result, version from sheetcell where sheet_id = $1"
 	rows, err := cr.db.Query(query, sheetID)
 	if err != nil {
 		return nil, err
@@ -51,7 +88,7 @@ func (cr *CellRepo) GetManyBySheetID(sheetID string) ([]cell.Cell, error) {
 			SheetID: sheetID,
 		}
 
-		if err := rows.Scan(&c.CellID, &c.Value, &c.Result); err != nil {
+		if err := rows.Scan(&c.CellID, &c.Value, &c.Normalized, &c.Result, &c.Version); err != nil {
 			log.Println(err)
 		}
 
@@ -61,14 +98,252 @@ func (cr *CellRepo) GetManyBySheetID(sheetID string) ([]cell.Cell, error) {
 	return cells, nil
 }
 
+func (cr *CellRepo) GetMany(sheetID string, cellIDs []string) ([]cell.Cell, error) {
+	if len(cellIDs) == 0 {
+		return []cell.Cell{}, nil
+	}
+
+	query := "select sheet_id, cell_id, value, normalized, result, version from sheetcell where sheet_id = $1 and cell_id = any($2)"
+	rows, err := cr.db.Query(query, sheetID, pq.Array(cellIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cells := make([]cell.Cell, 0)
+	for rows.Next() {
+		c := cell.Cell{}
+
+		if err := rows.Scan(&c.SheetID, &c.CellID, &c.Value, &c.Normalized, &c.Result, &c.Version); err != nil {
+			return nil, err
+		}
+
+		cells = append(cells, c)
+	}
+
+	return cells, rows.Err()
+}
+
+func (cr *CellRepo) ForEachBySheetID(sheetID string, fn func(cell.Cell) error) error {
+	// rows are received from the connection as they are scanned
+	query := "select cell_id, value, normalized, result, version from sheetcell where sheet_id = $1"
+	rows, err := cr.db.Query(query, sheetID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c := cell.Cell{
+			SheetID: sheetID,
+		}
+
+		if err := rows.Scan(&c.CellID, &c.Value, &c.Normalized, &c.Result, &c.Version); err != nil {
+			return err
+		}
+
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (cr *CellRepo) GetPage(sheetID string, q cell.Query) ([]cell.Cell, error) {
+	fields := q.Fields
+	if len(fields) == 0 {
+		fields = []string{cell.FieldValue, cell.FieldNormalized, cell.FieldResult}
+	}
+
+	columns := []string{"cell_id"}
+	for _, field := range fields {
+		switch field {
+		case cell.FieldValue:
+			columns = append(columns, "value")
+		case cell.FieldNormalized:
+			columns = append(columns, "normalized")
+		case cell.FieldResult:
+			columns = append(columns, "coalesce(result, '')")
+		default:
+			return nil, fmt.Errorf("unknown field %s", field)
+		}
+	}
+
+	args := []any{sheetID}
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	conditions := []string{"sheet_id = $1"}
+	if q.Cursor != "" {
+		conditions = append(conditions, "cell_id > "+arg(q.Cursor))
+	}
+	if q.Prefix != "" {
+		conditions = append(conditions, "cell_id like "+arg(escapeLike(q.Prefix)+"%")+" escape '\\'")
+	}
+	// the same rule as cell.IsFormula
+	if q.HasFormula != nil {
+		if *q.HasFormula {
+			conditions = append(conditions, "ltrim(value, ' ') like '=%'")
+		} else {
+			conditions = append(conditions, "ltrim(value, ' ') not like '=%'")
+		}
+	}
+	if q.Error != nil {
+		if *q.Error {
+			conditions = append(conditions, "result = "+arg(cell.ResultError))
+		} else {
+			conditions = append(conditions, "result is distinct from "+arg(cell.ResultError))
+		}
+	}
+
+	query := "select " + strings.Join(columns, ", ") + " from sheetcell where " + strings.Join(conditions, " and ") +
+		" order by cell_id limit " + arg(q.Limit)
+	rows, err := cr.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cells := make([]cell.Cell, 0)
+	for rows.Next() {
+		c := cell.Cell{
+			SheetID: sheetID,
+		}
+
+		destinations := []any{&c.CellID}
+		for _, field := range fields {
+			switch field {
+			case cell.FieldValue:
+				destinations = append(destinations, &c.Value)
+			case cell.FieldNormalized:
+				destinations = append(destinations, &c.Normalized)
+			case cell.FieldResult:
+				destinations = append(destinations, &c.Result)
+			}
+		}
+
+		if err := rows.Scan(destinations...); err != nil {
+			return nil, err
+		}
+
+		cells = append(cells, c)
+	}
+
+	return cells, rows.Err()
+}
+
+// escapeLike escapes the wildcards of a like pattern.
+func escapeLike(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(value)
+}
+
+func (cr *CellRepo) GetManyReferencingSheet(sheetID string) ([]cell.Cell, error) {
+	query := "select sheet_id, cell_id, value, normalized, result, version from sheetcell c where sheet_id <> $1 and exists " +
+		"(select from cell_refs r where r.ref_sheet_id = $1 and r.sheet_id = c.sheet_id and r.cell_id = c.cell_id)"
+	rows, err := cr.db.Query(query, sheetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cells := make([]cell.Cell, 0)
+	for rows.Next() {
+		c := cell.Cell{}
+
+		if err := rows.Scan(&c.SheetID, &c.CellID, &c.Value, &c.Normalized, &c.Result, &c.Version); err != nil {
+			return nil, err
+		}
+
+		cells = append(cells, c)
+	}
+
+	return cells, rows.Err()
+}
+
+func (cr *CellRepo) GetManyReferencing(refs []cell.Ref) ([]cell.Cell, error) {
+	if len(refs) == 0 {
+		return []cell.Cell{}, nil
+	}
+
+	query := "select c.sheet_id, c.cell_id, c.value, c.normalized, c.result, c.version from sheetcell c join (" +
+		cellRefs.dependents() + ") as d (sheet_id, cell_id) on c.sheet_id = d.sheet_id and c.cell_id = d.cell_id"
+	rows, err := cr.db.Query(query, dependentsArgs(refs)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cells := make([]cell.Cell, 0)
+	for rows.Next() {
+		c := cell.Cell{}
+
+		if err := rows.Scan(&c.SheetID, &c.CellID, &c.Value, &c.Normalized, &c.Result, &c.Version); err != nil {
+			return nil, err
+		}
+
+		cells = append(cells, c)
+	}
+
+	return cells, rows.Err()
+}
+
+func (cr *CellRepo) GetManyContaining(text string) ([]cell.Cell, error) {
+	query := "select sheet_id, cell_id, value, normalized, result, version from sheetcell where position(lower($1) in lower(value)) > 0"
+	rows, err := cr.db.Query(query, text)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cells := make([]cell.Cell, 0)
+	for rows.Next() {
+		c := cell.Cell{}
+
+		if err := rows.Scan(&c.SheetID, &c.CellID, &c.Value, &c.Normalized, &c.Result, &c.Version); err != nil {
+			return nil, err
+		}
+
+		cells = append(cells, c)
+	}
+
+	return cells, rows.Err()
+}
+
+func (cr *CellRepo) GetSheetRevision(sheetID string) (string, error) {
+	query := "select coalesce(md5(string_agg(cell_id || ':' || version, ',' order by cell_id)), '') from sheetcell where sheet_id = $1"
+
+	revision := ""
+	if err := cr.db.QueryRow(query, sheetID).Scan(&revision); err != nil {
+		return "", err
+	}
+
+	return revision, nil
+}
+
 func (cr *CellRepo) Insert(c cell.Cell) error {
 	if c.CellID == "" || c.SheetID == "" || c.Value == "" {
 		return errors.New("insertion error: invalid cell")
 	}
 
-	query := "insert into sheetcell (sheet_id, cell_id, value, result) values ($1, $2, $3, $4)"
-	_, err := cr.db.Exec(query, c.SheetID, c.CellID, c.Value, c.Result)
-	return err
+	tx, err := cr.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "insert into sheetcell (sheet_id, cell_id, value, normalized, result, version) values ($1, $2, $3, $4, $5, 1)"
+	if _, err := tx.Exec(query, c.SheetID, c.CellID, c.Value, c.Normalized, c.Result); err != nil {
+		return checkUnique(err)
+	}
+
+	if err := cellRefs.insert(tx, c.SheetID, c.CellID, c.Value); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (cr *CellRepo) Update(c cell.Cell) error {
@@ -76,7 +351,330 @@ func (cr *CellRepo) Update(c cell.Cell) error {
 		return errors.New("insertion error: invalid cell")
 	}
 
-	query := "update sheetcell set value = $1, result = $2 where sheet_id = $3 and cell_id = $4"
-	_, err := cr.db.Exec(query, c.Value, c.Result, c.SheetID, c.CellID)
-	return err
+	tx, err := cr.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// most updates store a recalculated result, the references change only with the value
+	previous := ""
+	query := "select value from sheetcell where sheet_id = $1 and cell_id = $2 and version = $3 for update"
+	err = tx.QueryRow(query, c.SheetID, c.CellID, c.Version).Scan(&previous)
+	if errors.Is(err, sql.ErrNoRows) {
+		return cell.ErrVersionConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	query = "update sheetcell set value = $1, normalized = $2, result = $3, version = version + 1 where sheet_id = $4 and cell_id = $5"
+	if _, err := tx.Exec(query, c.Value, c.Normalized, c.Result, c.SheetID, c.CellID); err != nil {
+		return err
+	}
+
+	if c.Value != previous {
+		if err := cellRefs.replace(tx, c.SheetID, c.CellID, c.Value); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (cr *CellRepo) Paste(sheetID string, cells []cell.Cell, cleared []string) ([]cell.Cell, error) {
+	tx, err := cr.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, cellID := range cleared {
+		if _, err := tx.Exec("delete from sheetcell where sheet_id = $1 and cell_id = $2", sheetID, cellID); err != nil {
+			return nil, err
+		}
+		if err := cellRefs.delete(tx, sheetID, cellID); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range cells {
+		cells[i].SheetID = sheetID
+	}
+
+	pasted, err := upsertCells(tx, cells)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return pasted, nil
+}
+
+func (cr *CellRepo) Import(cells []cell.Cell) ([]cell.Cell, error) {
+	tx, err := cr.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	imported, err := upsertCells(tx, cells)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return imported, nil
+}
+
+// upsertCells creates the missing cells and increments the versions of the others.
+func upsertCells(tx *sql.Tx, cells []cell.Cell) ([]cell.Cell, error) {
+	upserted := make([]cell.Cell, 0, len(cells))
+	for _, c := range cells {
+		if c.CellID == "" || c.SheetID == "" || c.Value == "" {
+			return nil, errors.New("insertion error: invalid cell")
+		}
+
+		query := "update sheetcell set value = $1, normalized = $2, result = $3, version = version + 1 where sheet_id = $4 and cell_id = $5 returning version"
+		err := tx.QueryRow(query, c.Value, c.Normalized, c.Result, c.SheetID, c.CellID).Scan(&c.Version)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.Version = 1
+			query = "insert into sheetcell (sheet_id, cell_id, value, normalized, result, version) values ($1, $2, $3, $4, $5, 1)"
+			_, err = tx.Exec(query, c.SheetID, c.CellID, c.Value, c.Normalized, c.Result)
+		}
+		if err != nil {
+			return nil, checkUnique(err)
+		}
+		if err := cellRefs.replace(tx, c.SheetID, c.CellID, c.Value); err != nil {
+			return nil, err
+		}
+		upserted = append(upserted, c)
+	}
+
+	return upserted, nil
+}
+
+func (cr *CellRepo) Spill(sheetID string, inserted, updated, removed []cell.Cell) error {
+	tx, err := cr.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, c := range removed {
+		res, err := tx.Exec("delete from sheetcell where sheet_id = $1 and cell_id = $2 and version = $3", sheetID, c.CellID, c.Version)
+		if err != nil {
+			return err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return cell.ErrVersionConflict
+		}
+		if err := cellRefs.delete(tx, sheetID, c.CellID); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range updated {
+		query := "update sheetcell set result = $1, version = version + 1 where sheet_id = $2 and cell_id = $3 and version = $4"
+		res, err := tx.Exec(query, c.Result, sheetID, c.CellID, c.Version)
+		if err != nil {
+			return err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return cell.ErrVersionConflict
+		}
+	}
+
+	for _, c := range inserted {
+		if c.CellID == "" || c.Value == "" {
+			return errors.New("insertion error: invalid cell")
+		}
+
+		query := "insert into sheetcell (sheet_id, cell_id, value, normalized, result, version) values ($1, $2, $3, $4, $5, 1)"
+		if _, err := tx.Exec(query, sheetID, c.CellID, c.Value, c.Normalized, c.Result); err != nil {
+			return checkUnique(err)
+		}
+		if err := cellRefs.insert(tx, sheetID, c.CellID, c.Value); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (cr *CellRepo) Rename(sheetID, cellID, newCellID string, cells []cell.Cell, names []cell.Name) error {
+	tx, err := cr.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "update sheetcell set cell_id = $1, version = version + 1 where sheet_id = $2 and cell_id = $3"
+	res, err := tx.Exec(query, newCellID, sheetID, cellID)
+	if err != nil {
+		return checkUnique(err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return cell.ErrNotFound
+	}
+
+	query = "update cell_refs set cell_id = $1 where sheet_id = $2 and cell_id = $3"
+	if _, err := tx.Exec(query, newCellID, sheetID, cellID); err != nil {
+		return err
+	}
+
+	if err := updateValues(tx, cells, names); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (cr *CellRepo) ReplaceSheet(sheetID string, cells []cell.Cell) ([]cell.Cell, error) {
+	tx, err := cr.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	replaced, err := replaceSheet(tx, sheetID, cells)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return replaced, nil
+}
+
+func (cr *CellRepo) Restructure(sheetID string, cells []cell.Cell, rewritten []cell.Cell, names []cell.Name) ([]cell.Cell, error) {
+	tx, err := cr.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	replaced, err := replaceSheet(tx, sheetID, cells)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := updateValues(tx, rewritten, names); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return replaced, nil
+}
+
+func replaceSheet(tx *sql.Tx, sheetID string, cells []cell.Cell) ([]cell.Cell, error) {
+	rows, err := tx.Query("delete from sheetcell where sheet_id = $1 returning cell_id, version", sheetID)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]int)
+	for rows.Next() {
+		cellID, version := "", 0
+		if err := rows.Scan(&cellID, &version); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		versions[cellID] = version
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("delete from cell_refs where sheet_id = $1", sheetID); err != nil {
+		return nil, err
+	}
+
+	stmt, err := tx.Prepare("insert into sheetcell (sheet_id, cell_id, value, normalized, result, version) values ($1, $2, $3, $4, $5, $6)")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	replaced := make([]cell.Cell, 0, len(cells))
+	for _, c := range cells {
+		if c.CellID == "" || c.Value == "" {
+			return nil, errors.New("insertion error: invalid cell")
+		}
+
+		c.SheetID = sheetID
+		c.Version = versions[c.CellID] + 1
+
+		if _, err := stmt.Exec(c.SheetID, c.CellID, c.Value, c.Normalized, c.Result, c.Version); err != nil {
+			return nil, checkUnique(err)
+		}
+		if err := cellRefs.insert(tx, c.SheetID, c.CellID, c.Value); err != nil {
+			return nil, err
+		}
+		replaced = append(replaced, c)
+	}
+
+	return replaced, nil
+}
+
+// updateValues stores the rewritten values of the cells, which must not have been
+// modified in the meantime, and of the names.
+func updateValues(tx *sql.Tx, cells []cell.Cell, names []cell.Name) error {
+	for _, c := range cells {
+		query := "update sheetcell set value = $1, normalized = $2, version = version + 1 where sheet_id = $3 and cell_id = $4 and version = $5"
+		res, err := tx.Exec(query, c.Value, c.Normalized, c.SheetID, c.CellID, c.Version)
+		if err != nil {
+			return err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return cell.ErrVersionConflict
+		}
+		if err := cellRefs.replace(tx, c.SheetID, c.CellID, c.Value); err != nil {
+			return err
+		}
+	}
+
+	for _, n := range names {
+		query := "update sheetname set value = $1 where sheet_id = $2 and name = $3"
+		if _, err := tx.Exec(query, n.Value, n.SheetID, n.Name); err != nil {
+			return err
+		}
+		if err := nameRefs.replace(tx, n.SheetID, n.Name, n.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"database/sql"
+	"dev-challenge/internal/function"
+	"errors"
+	"log"
+	"strings"
+)
+
+type FunctionRepo struct {
+	db *sql.DB
+}
+
+func NewFunctionRepository(db *sql.DB) *FunctionRepo {
+	return &FunctionRepo{
+		db: db,
+	}
+}
+
+func (fr *FunctionRepo) CreateTableIfNotExists() {
+	_, err := fr.db.Exec("create table if not exists userfunction (name text primary key, params text not null, body text not null)")
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func (fr *FunctionRepo) GetOne(name string) (function.Function, error) {
+	f := function.Function{
+		Name: name,
+	}
+
+	params := ""
+	err := fr.db.QueryRow("select params, body from userfunction where name = $1", name).Scan(&params, &f.Body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return function.Function{}, function.ErrNotFound
+	}
+	if err != nil {
+		return function.Function{}, err
+	}
+
+	f.Params = splitParams(params)
+	return f, nil
+}
+
+func (fr *FunctionRepo) GetMany() ([]function.Function, error) {
+	rows, err := fr.db.Query("select name, params, body from userfunction order by name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	functions := make([]function.Function, 0)
+	for rows.Next() {
+		f := function.Function{}
+		params := ""
+
+		if err := rows.Scan(&f.Name, &params, &f.Body); err != nil {
+			return nil, err
+		}
+
+		f.Params = splitParams(params)
+		functions = append(functions, f)
+	}
+
+	return functions, rows.Err()
+}
+
+func (fr *FunctionRepo) Upsert(f function.Function) error {
+	query := "insert into userfunction (name, params, body) values ($1, $2, $3) on conflict (name) do update set params = excluded.params, body = excluded.body"
+	_, err := fr.db.Exec(query, f.Name, strings.Join(f.Params, ","), f.Body)
+	return err
+}
+
+func (fr *FunctionRepo) Delete(name string) error {
+	res, err := fr.db.Exec("delete from userfunction where name = $1", name)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return function.ErrNotFound
+	}
+
+	return nil
+}
+
+// splitParams reads parameters stored as a comma separated list,
+// which is empty for functions without parameters.
+func splitParams(params string) []string {
+	if params == "" {
+		return make([]string, 0)
+	}
+	return strings.Split(params, ",")
+}
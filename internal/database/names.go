@@ -0,0 +1,133 @@
+package database
+
+import (
+	"database/sql"
+	"dev-challenge/internal/cell"
+	"errors"
+	"log"
+)
+
+type NameRepo struct {
+	db *sql.DB
+}
+
+func NewNameRepository(db *sql.DB) *NameRepo {
+	return &NameRepo{
+		db: db,
+	}
+}
+
+func (nr *NameRepo) CreateTableIfNotExists() {
+	_, err := nr.db.Exec("create table if not exists sheetname (sheet_id text not null, name text not null, value text not null, primary key (sheet_id, name))")
+	if err != nil {
+		log.Println(err)
+	}
+
+	nameRefs.createTableIfNotExists(nr.db, "select sheet_id, name, value from sheetname")
+}
+
+func (nr *NameRepo) GetOne(sheetID, name string) (cell.Name, error) {
+	n := cell.Name{
+		SheetID: sheetID,
+		Name:    name,
+	}
+
+	query := "select value from sheetname where sheet_id = $1 and name = $2"
+	err := nr.db.QueryRow(query, sheetID, name).Scan(&n.Value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return cell.Name{}, cell.ErrNotFound
+	}
+	if err != nil {
+		return cell.Name{}, err
+	}
+
+	return n, nil
+}
+
+func (nr *NameRepo) GetManyBySheetID(sheetID string) ([]cell.Name, error) {
+	query := "select sheet_id, name, value from sheetname where sheet_id = $1 order by name"
+	return nr.query(query, sheetID)
+}
+
+func (nr *NameRepo) GetManyReferencingSheet(sheetID string) ([]cell.Name, error) {
+	query := "select sheet_id, name, value from sheetname n where sheet_id <> $1 and exists " +
+		"(select from name_refs r where r.ref_sheet_id = $1 and r.sheet_id = n.sheet_id and r.name = n.name)"
+	return nr.query(query, sheetID)
+}
+
+func (nr *NameRepo) GetManyReferencing(refs []cell.Ref) ([]cell.Name, error) {
+	if len(refs) == 0 {
+		return []cell.Name{}, nil
+	}
+
+	query := "select n.sheet_id, n.name, n.value from sheetname n join (" +
+		nameRefs.dependents() + ") as d (sheet_id, name) on n.sheet_id = d.sheet_id and n.name = d.name"
+	return nr.query(query, dependentsArgs(refs)...)
+}
+
+func (nr *NameRepo) Upsert(n cell.Name) error {
+	tx, err := nr.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "insert into sheetname (sheet_id, name, value) values ($1, $2, $3) on conflict (sheet_id, name) do update set value = excluded.value"
+	if _, err := tx.Exec(query, n.SheetID, n.Name, n.Value); err != nil {
+		return err
+	}
+
+	if err := nameRefs.replace(tx, n.SheetID, n.Name, n.Value); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (nr *NameRepo) Delete(sheetID, name string) error {
+	tx, err := nr.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("delete from sheetname where sheet_id = $1 and name = $2", sheetID, name)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return cell.ErrNotFound
+	}
+
+	if err := nameRefs.delete(tx, sheetID, name); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (nr *NameRepo) query(query string, args ...any) ([]cell.Name, error) {
+	rows, err := nr.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make([]cell.Name, 0)
+	for rows.Next() {
+		n := cell.Name{}
+
+		if err := rows.Scan(&n.SheetID, &n.Name, &n.Value); err != nil {
+			return nil, err
+		}
+
+		names = append(names, n)
+	}
+
+	return names, rows.Err()
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"database/sql"
+	"dev-challenge/internal/a1"
+	"dev-challenge/internal/cell"
+	"log"
+
+	"github.com/lib/pq"
+)
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// refIndex is a table of the references of stored formulas, i.e. the reverse
+// dependencies of cells and names, so that the dependents of a cell are found
+// with an index instead of parsing every formula. A reference to a single cell
+// or name has no bounds, one to a range has the range's bounds, which are
+// matched against the position of an A1-style cell.
+type refIndex struct {
+	table string
+	// column holds the id of the dependent cell or name
+	column string
+}
+
+var (
+	cellRefs = refIndex{table: "cell_refs", column: "cell_id"}
+	nameRefs = refIndex{table: "name_refs", column: "name"}
+)
+
+// createTableIfNotExists creates the table and its indexes, and if the table
+// did not exist yet, indexes the formulas which the source query selects as
+// sheet ids, ids and values.
+func (ri refIndex) createTableIfNotExists(db *sql.DB, source string) {
+	exists := false
+	if err := db.QueryRow("select to_regclass($1) is not null", ri.table).Scan(&exists); err != nil {
+		log.Println(err)
+		return
+	}
+
+	statements := []string{
+		"create table if not exists " + ri.table + " (sheet_id text not null, " + ri.column + " text not null, ref_sheet_id text not null, ref_cell_id text not null, first_col integer, first_row integer, last_col integer, last_row integer)",
+		// tables created before ranges were indexed
+		"alter table " + ri.table + " add column if not exists first_col integer, add column if not exists first_row integer, add column if not exists last_col integer, add column if not exists last_row integer",
+		"create index if not exists " + ri.table + "_ref on " + ri.table + " (ref_sheet_id, ref_cell_id)",
+		"create index if not exists " + ri.table + "_range on " + ri.table + " (ref_sheet_id, first_col, last_col) where first_col is not null",
+		"create index if not exists " + ri.table + "_dependent on " + ri.table + " (sheet_id, " + ri.column + ")",
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+
+	// formulas stored before references were indexed
+	if !exists {
+		if err := ri.rebuild(db, source); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func (ri refIndex) rebuild(db *sql.DB, source string) error {
+	rows, err := db.Query(source)
+	if err != nil {
+		return err
+	}
+
+	type formula struct{ sheetID, id, value string }
+	formulas := make([]formula, 0)
+	for rows.Next() {
+		f := formula{}
+		if err := rows.Scan(&f.sheetID, &f.id, &f.value); err != nil {
+			rows.Close()
+			return err
+		}
+		formulas = append(formulas, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("delete from " + ri.table); err != nil {
+		return err
+	}
+	for _, f := range formulas {
+		if err := ri.insert(tx, f.sheetID, f.id, f.value); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// insert indexes the references of the value, the formula of a new cell or name.
+func (ri refIndex) insert(ex execer, sheetID, id, value string) error {
+	query := "insert into " + ri.table + " (sheet_id, " + ri.column + ", ref_sheet_id, ref_cell_id, first_col, first_row, last_col, last_row) values ($1, $2, $3, $4, $5, $6, $7, $8)"
+	for _, dependency := range cell.Dependencies(value, sheetID) {
+		bounds := []any{nil, nil, nil, nil}
+		if dependency.IsRange {
+			r := dependency.Range
+			bounds = []any{r.From.Col, r.From.Row, r.To.Col, r.To.Row}
+		}
+
+		args := append([]any{sheetID, id, dependency.SheetID, dependency.CellID}, bounds...)
+		if _, err := ex.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replace indexes the references of the cell's or name's new value instead of the old ones.
+func (ri refIndex) replace(ex execer, sheetID, id, value string) error {
+	if err := ri.delete(ex, sheetID, id); err != nil {
+		return err
+	}
+	return ri.insert(ex, sheetID, id, value)
+}
+
+func (ri refIndex) delete(ex execer, sheetID, id string) error {
+	_, err := ex.Exec("delete from "+ri.table+" where sheet_id = $1 and "+ri.column+" = $2", sheetID, id)
+	return err
+}
+
+// dependents is a query of the sheet ids and ids of the cells or names referencing
+// any of the refs, which are passed as arrays by dependentsArgs.
+func (ri refIndex) dependents() string {
+	return "select distinct r.sheet_id, r." + ri.column + " from unnest($1::text[], $2::text[], $3::integer[], $4::integer[]) as t (sheet_id, cell_id, ref_col, ref_row)" +
+		" join " + ri.table + " r on r.ref_sheet_id = t.sheet_id and (r.ref_cell_id = t.cell_id or" +
+		" r.first_col <= t.ref_col and r.last_col >= t.ref_col and r.first_row <= t.ref_row and r.last_row >= t.ref_row)"
+}
+
+// dependentsArgs returns the arguments of the dependents query, refs which
+// are not A1-style cells are at position 0 and so in no range.
+func dependentsArgs(refs []cell.Ref) []any {
+	sheetIDs := make([]string, 0, len(refs))
+	cellIDs := make([]string, 0, len(refs))
+	cols := make([]int64, 0, len(refs))
+	rows := make([]int64, 0, len(refs))
+	for _, ref := range refs {
+		position, _ := a1.Parse(ref.CellID)
+		sheetIDs = append(sheetIDs, ref.SheetID)
+		cellIDs = append(cellIDs, ref.CellID)
+		cols = append(cols, int64(position.Col))
+		rows = append(rows, int64(position.Row))
+	}
+
+	return []any{pq.Array(sheetIDs), pq.Array(cellIDs), pq.Array(cols), pq.Array(rows)}
+}
@@ -0,0 +1,111 @@
+package evaluator
+
+import "math"
+
+func init() {
+	RegisterFunction("SUM", Function{MinArgs: 1, MaxArgs: Variadic, Call: sum})
+	RegisterFunction("AVERAGE", Function{MinArgs: 1, MaxArgs: Variadic, Call: average})
+	RegisterFunction("MIN", Function{MinArgs: 1, MaxArgs: Variadic, Call: minimum})
+	RegisterFunction("MAX", Function{MinArgs: 1, MaxArgs: Variadic, Call: maximum})
+	RegisterFunction("COUNT", Function{MinArgs: 1, MaxArgs: Variadic, Call: count})
+}
+
+// numbers flattens arguments of an aggregate. Like in spreadsheets, empty
+// cells and texts of ranges are skipped while texts passed directly must
+// hold numbers.
+func numbers(args []Value) ([]float64, error) {
+	result := make([]float64, 0, len(args))
+	for _, arg := range args {
+		if !arg.IsArray() {
+			number, err := arg.Float()
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, number)
+			continue
+		}
+
+		for _, row := range arg.Array {
+			for _, value := range row {
+				if value.Empty || value.IsText || value.IsArray() {
+					continue
+				}
+				result = append(result, value.Number)
+			}
+		}
+	}
+	return result, nil
+}
+
+func sum(args []Value) (Value, error) {
+	values, err := numbers(args)
+	if err != nil {
+		return Value{}, err
+	}
+
+	total := 0.0
+	for _, value := range values {
+		total += value
+	}
+	return NumberValue(total), nil
+}
+
+func average(args []Value) (Value, error) {
+	values, err := numbers(args)
+	if err != nil {
+		return Value{}, err
+	}
+
+	if len(values) == 0 {
+		return Value{}, ErrDivisionByZero
+	}
+
+	total := 0.0
+	for _, value := range values {
+		total += value
+	}
+	return NumberValue(total / float64(len(values))), nil
+}
+
+func minimum(args []Value) (Value, error) {
+	values, err := numbers(args)
+	if err != nil || len(values) == 0 {
+		return NumberValue(0), err
+	}
+
+	result := math.Inf(1)
+	for _, value := range values {
+		result = math.Min(result, value)
+	}
+	return NumberValue(result), nil
+}
+
+func maximum(args []Value) (Value, error) {
+	values, err := numbers(args)
+	if err != nil || len(values) == 0 {
+		return NumberValue(0), err
+	}
+
+	result := math.Inf(-1)
+	for _, value := range values {
+		result = math.Max(result, value)
+	}
+	return NumberValue(result), nil
+}
+
+// count counts numbers only, texts which are not numbers are not an error.
+func count(args []Value) (Value, error) {
+	total := 0
+	for _, arg := range args {
+		if !arg.IsArray() {
+			if _, err := arg.Float(); err == nil {
+				total++
+			}
+			continue
+		}
+
+		values, _ := numbers([]Value{arg})
+		total += len(values)
+	}
+	return NumberValue(float64(total)), nil
+}
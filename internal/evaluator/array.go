@@ -0,0 +1,111 @@
+package evaluator
+
+import (
+	"math"
+	"sort"
+)
+
+func init() {
+	RegisterFunction("SORT", Function{MinArgs: 1, MaxArgs: 3, Call: sortArray})
+	RegisterFunction("SEQUENCE", Function{MinArgs: 1, MaxArgs: 4, Call: sequence})
+	RegisterFunction("TRANSPOSE", Function{MinArgs: 1, MaxArgs: 1, Call: transpose})
+}
+
+// kindRank orders values of different kinds: numbers, then texts, then empty cells.
+func kindRank(v Value) int {
+	switch {
+	case v.Empty:
+		return 2
+	case v.IsText:
+		return 1
+	}
+	return 0
+}
+
+// sortArray sorts rows of the array by the column given by the optional one-based
+// index, in ascending order unless the optional order is -1. Empty cells come last.
+func sortArray(args []Value) (Value, error) {
+	rows := table(args[0])
+
+	col := 1
+	if len(args) > 1 {
+		var err error
+		if col, err = positionArg(args[1], false); err != nil {
+			return Value{}, err
+		}
+		if col > len(rows[0]) {
+			return Value{}, ErrInvalidArgument
+		}
+	}
+
+	descending := false
+	if len(args) > 2 {
+		order, err := args[2].Float()
+		if err != nil {
+			return Value{}, err
+		}
+		if order != 1 && order != -1 {
+			return Value{}, ErrInvalidArgument
+		}
+		descending = order == -1
+	}
+
+	sorted := make([][]Value, len(rows))
+	copy(sorted, rows)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i][col-1], sorted[j][col-1]
+		if kindRank(a) != kindRank(b) {
+			return kindRank(a) < kindRank(b)
+		}
+
+		order, _ := compareValues(a, b)
+		if descending {
+			return order > 0
+		}
+		return order < 0
+	})
+
+	return Value{Array: sorted}, nil
+}
+
+// sequence returns an array of the given number of rows and optional number of columns
+// filled row by row with numbers from the optional start, 1 by default, increasing
+// by the optional step, 1 by default.
+func sequence(args []Value) (Value, error) {
+	values, err := floats(args)
+	if err != nil {
+		return Value{}, err
+	}
+
+	size := []float64{0, 1, 1, 1}
+	copy(size, values)
+	rows, cols, start, step := math.Trunc(size[0]), math.Trunc(size[1]), size[2], size[3]
+	if rows < 1 || cols < 1 || rows*cols > MaxRangeSize {
+		return Value{}, ErrInvalidArgument
+	}
+
+	result := make([][]Value, 0, int(rows))
+	next := start
+	for row := 0; row < int(rows); row++ {
+		values := make([]Value, 0, int(cols))
+		for col := 0; col < int(cols); col++ {
+			values = append(values, NumberValue(next))
+			next += step
+		}
+		result = append(result, values)
+	}
+
+	return Value{Array: result}, nil
+}
+
+// transpose turns rows of the array into columns.
+func transpose(args []Value) (Value, error) {
+	rows := table(args[0])
+
+	result := make([][]Value, 0, len(rows[0]))
+	for col := range rows[0] {
+		result = append(result, column(rows, col))
+	}
+
+	return Value{Array: result}, nil
+}
@@ -0,0 +1,202 @@
+package evaluator
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterFunction("SUMIF", Function{MinArgs: 2, MaxArgs: 3, Call: sumIf})
+	RegisterFunction("COUNTIF", Function{MinArgs: 2, MaxArgs: 2, Call: countIfs})
+	RegisterFunction("AVERAGEIF", Function{MinArgs: 2, MaxArgs: 3, Call: averageIf})
+	RegisterFunction("SUMIFS", Function{MinArgs: 3, MaxArgs: Variadic, Call: sumIfs})
+	RegisterFunction("COUNTIFS", Function{MinArgs: 2, MaxArgs: Variadic, Call: countIfs})
+	RegisterFunction("AVERAGEIFS", Function{MinArgs: 3, MaxArgs: Variadic, Call: averageIfs})
+}
+
+// criterion selects cells of a conditional aggregate. It is written as a number,
+// a text matched like the exact lookups, or a comparison such as ">100",
+// "<>done" or "<=2024-01-31". An empty text selects empty cells.
+type criterion struct {
+	operator string
+	number   float64
+	isNumber bool
+	text     string
+}
+
+func parseCriterion(v Value) (criterion, error) {
+	if v.IsArray() {
+		return criterion{}, ErrInvalidArgument
+	}
+	if !v.IsText {
+		return criterion{operator: "=", number: v.Number, isNumber: !v.Empty}, nil
+	}
+
+	c := criterion{operator: "=", text: v.Text}
+	for _, operator := range []string{"<=", ">=", "<>", "<", ">", "="} {
+		if operand, ok := strings.CutPrefix(v.Text, operator); ok {
+			c.operator, c.text = operator, operand
+			break
+		}
+	}
+
+	if number, err := strconv.ParseFloat(strings.TrimSpace(c.text), 64); err == nil {
+		c.number, c.isNumber = number, true
+	} else if t, err := time.Parse(DateLayout, strings.TrimSpace(c.text)); err == nil {
+		c.number, c.isNumber = DateValue(t).Number, true
+	}
+	return c, nil
+}
+
+func (c criterion) matches(v Value) bool {
+	var order int
+	var ok bool
+	switch {
+	case c.isNumber:
+		order, ok = compareValues(v, NumberValue(c.number))
+	case c.text == "":
+		// "=" and "" select empty cells, "<>" the other ones
+		return v.Empty == (c.operator == "=")
+	case c.operator == "=" || c.operator == "<>":
+		return equalValues(TextValue(c.text), v, wildcardMatch) == (c.operator == "=")
+	default:
+		order, ok = compareValues(v, TextValue(c.text))
+	}
+
+	if !ok {
+		// only values of the same kind are comparable, anything else differs
+		return c.operator == "<>"
+	}
+
+	switch c.operator {
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	case ">=":
+		return order >= 0
+	case "<>":
+		return order != 0
+	}
+	return order == 0
+}
+
+// selected returns the cells of the target range which are selected by all
+// pairs of a range and a criterion, ranges must have the same size as the target.
+func selected(target Value, pairs []Value) ([]Value, error) {
+	if len(pairs)%2 != 0 {
+		return nil, ErrArgumentCount
+	}
+
+	cells := table(target)
+	matching := make([]Value, 0)
+	criteria := make([]criterion, 0, len(pairs)/2)
+	ranges := make([][][]Value, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		rows := table(pairs[i])
+		if len(rows) != len(cells) || len(rows[0]) != len(cells[0]) {
+			return nil, ErrInvalidArgument
+		}
+
+		c, err := parseCriterion(pairs[i+1])
+		if err != nil {
+			return nil, err
+		}
+
+		ranges = append(ranges, rows)
+		criteria = append(criteria, c)
+	}
+
+	for row := range cells {
+	next:
+		for col := range cells[row] {
+			for i, c := range criteria {
+				if !c.matches(ranges[i][row][col]) {
+					continue next
+				}
+			}
+			matching = append(matching, cells[row][col])
+		}
+	}
+	return matching, nil
+}
+
+// numbersOf returns the values which are numbers, texts and empty cells are skipped.
+func numbersOf(values []Value) []float64 {
+	result := make([]float64, 0, len(values))
+	for _, v := range values {
+		if !v.IsText && !v.Empty && !v.IsArray() {
+			result = append(result, v.Number)
+		}
+	}
+	return result
+}
+
+func sumOf(values []Value) Value {
+	sum := 0.0
+	for _, number := range numbersOf(values) {
+		sum += number
+	}
+	return NumberValue(sum)
+}
+
+func averageOf(values []Value) (Value, error) {
+	numbers := numbersOf(values)
+	if len(numbers) == 0 {
+		return Value{}, ErrDivisionByZero
+	}
+
+	return NumberValue(sumOf(values).Number / float64(len(numbers))), nil
+}
+
+// target returns the range to aggregate, the optional third argument
+// of SUMIF and AVERAGEIF, which defaults to the range of the criterion.
+func target(args []Value) Value {
+	if len(args) > 2 {
+		return args[2]
+	}
+	return args[0]
+}
+
+func sumIf(args []Value) (Value, error) {
+	values, err := selected(target(args), args[:2])
+	if err != nil {
+		return Value{}, err
+	}
+	return sumOf(values), nil
+}
+
+func averageIf(args []Value) (Value, error) {
+	values, err := selected(target(args), args[:2])
+	if err != nil {
+		return Value{}, err
+	}
+	return averageOf(values)
+}
+
+func sumIfs(args []Value) (Value, error) {
+	values, err := selected(args[0], args[1:])
+	if err != nil {
+		return Value{}, err
+	}
+	return sumOf(values), nil
+}
+
+func countIfs(args []Value) (Value, error) {
+	values, err := selected(args[0], args)
+	if err != nil {
+		return Value{}, err
+	}
+	return NumberValue(float64(len(values))), nil
+}
+
+func averageIfs(args []Value) (Value, error) {
+	values, err := selected(args[0], args[1:])
+	if err != nil {
+		return Value{}, err
+	}
+	return averageOf(values)
+}
@@ -0,0 +1,321 @@
+package evaluator
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterFunction("DATE", Function{MinArgs: 3, MaxArgs: 3, Call: date})
+	RegisterFunction("TODAY", Function{MinArgs: 0, MaxArgs: 0, Call: today, Volatile: true})
+	RegisterFunction("NOW", Function{MinArgs: 0, MaxArgs: 0, Call: now, Volatile: true})
+	RegisterFunction("YEAR", Function{MinArgs: 1, MaxArgs: 1, Call: datePart(time.Time.Year)})
+	RegisterFunction("MONTH", Function{MinArgs: 1, MaxArgs: 1, Call: datePart(month)})
+	RegisterFunction("DAY", Function{MinArgs: 1, MaxArgs: 1, Call: datePart(time.Time.Day)})
+	RegisterFunction("WEEKDAY", Function{MinArgs: 1, MaxArgs: 2, Call: weekday})
+	RegisterFunction("EDATE", Function{MinArgs: 2, MaxArgs: 2, Call: edate})
+	RegisterFunction("DATEDIF", Function{MinArgs: 3, MaxArgs: 3, Call: datedif})
+	RegisterFunction("NETWORKDAYS", Function{MinArgs: 2, MaxArgs: 3, Call: networkdays})
+}
+
+const (
+	DateLayout     = "2006-01-02"
+	DateTimeLayout = "2006-01-02 15:04:05"
+
+	// maxSerial is the serial number of 9999-12-31
+	maxSerial = 2958465
+)
+
+// epoch is the day 0 of spreadsheet dates. It is 1899-12-30 rather than
+// 1899-12-31, since spreadsheets count 1900-02-29 which did not exist,
+// so that dates from March 1900 on have the same numbers.
+var epoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+var (
+	clockMu sync.RWMutex
+	clock   = time.Now
+)
+
+// SetClock replaces the current time TODAY and NOW return, e.g. in tests.
+func SetClock(now func() time.Time) {
+	clockMu.Lock()
+	defer clockMu.Unlock()
+
+	clock = now
+}
+
+func currentTime() time.Time {
+	clockMu.RLock()
+	defer clockMu.RUnlock()
+
+	return clock()
+}
+
+// DateValue returns a date, which is a number of days since 1899-12-30
+// like in spreadsheets, with the time of the day as the fraction.
+func DateValue(t time.Time) Value {
+	// the wall clock matters, not the time zone
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	// a time.Duration overflows after 292 years, seconds do not
+	seconds := float64(wall.Unix()-epoch.Unix()) + float64(wall.Nanosecond())/1e9
+	return Value{Number: seconds / (24 * 60 * 60), IsDate: true}
+}
+
+// Time converts a date or a number of days since 1899-12-30 into a time,
+// texts are accepted in the DateLayout and DateTimeLayout formats.
+func (v Value) Time() (time.Time, error) {
+	if v.IsText {
+		for _, layout := range []string{DateLayout, DateTimeLayout, time.RFC3339} {
+			if t, err := time.Parse(layout, strings.TrimSpace(v.Text)); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, ErrNotANumber
+	}
+
+	serial, err := v.Float()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if serial < 0 || serial >= maxSerial+1 {
+		return time.Time{}, ErrInvalidNumber
+	}
+
+	seconds := int64(math.Round(serial * 24 * 60 * 60))
+	return time.Unix(epoch.Unix()+seconds, 0).UTC(), nil
+}
+
+// formatTime writes the date with its time only if it has one.
+func formatTime(t time.Time) string {
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return t.Format(DateLayout)
+	}
+	return t.Format(DateTimeLayout)
+}
+
+// dateOf returns a date if the time is within the years 1900 to 9999.
+func dateOf(t time.Time) (Value, error) {
+	result := DateValue(t)
+	if result.Number < 1 || result.Number >= maxSerial+1 {
+		return Value{}, ErrInvalidNumber
+	}
+	return result, nil
+}
+
+// date builds a date from the year, month and day, months and days
+// out of range move the date, e.g. DATE(2024, 14, 1) is 2025-02-01.
+func date(args []Value) (Value, error) {
+	values, err := floats(args)
+	if err != nil {
+		return Value{}, err
+	}
+
+	year, month, day := math.Trunc(values[0]), math.Trunc(values[1]), math.Trunc(values[2])
+	if year < 1900 || year > 9999 || math.Abs(month) > 120000 || math.Abs(day) > maxSerial {
+		return Value{}, ErrInvalidNumber
+	}
+
+	return dateOf(time.Date(int(year), time.Month(month), int(day), 0, 0, 0, 0, time.UTC))
+}
+
+func today(args []Value) (Value, error) {
+	t := currentTime()
+	return DateValue(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)), nil
+}
+
+func now(args []Value) (Value, error) {
+	return DateValue(currentTime().Truncate(time.Second)), nil
+}
+
+func month(t time.Time) int {
+	return int(t.Month())
+}
+
+func datePart(part func(time.Time) int) func(args []Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		t, err := args[0].Time()
+		if err != nil {
+			return Value{}, err
+		}
+
+		return NumberValue(float64(part(t))), nil
+	}
+}
+
+// weekday numbers days from Sunday (1) to Saturday (7) by default, the
+// optional type 2 numbers them from Monday (1) and type 3 from Monday (0).
+func weekday(args []Value) (Value, error) {
+	t, err := args[0].Time()
+	if err != nil {
+		return Value{}, err
+	}
+
+	numbering := 1.0
+	if len(args) > 1 {
+		if numbering, err = args[1].Float(); err != nil {
+			return Value{}, err
+		}
+	}
+
+	day := int(t.Weekday())
+	switch numbering {
+	case 1:
+		return NumberValue(float64(day + 1)), nil
+	case 2:
+		return NumberValue(float64((day+6)%7 + 1)), nil
+	case 3:
+		return NumberValue(float64((day + 6) % 7)), nil
+	}
+	return Value{}, ErrInvalidNumber
+}
+
+// addMonths moves the date by the number of months, keeping the day unless
+// the month is shorter, e.g. a month after 2024-01-31 is 2024-02-29.
+func addMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+	lastDay := first.AddDate(0, 1, -1).Day()
+
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, time.UTC)
+}
+
+func edate(args []Value) (Value, error) {
+	t, err := args[0].Time()
+	if err != nil {
+		return Value{}, err
+	}
+
+	months, err := args[1].Float()
+	if err != nil {
+		return Value{}, err
+	}
+	if math.Abs(months) > 120000 {
+		return Value{}, ErrInvalidNumber
+	}
+
+	return dateOf(addMonths(t, int(months)))
+}
+
+// days returns the number of days between the dates ignoring their times.
+func days(from, to time.Time) int {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int((to.Unix() - from.Unix()) / (24 * 60 * 60))
+}
+
+// datedif returns the difference between dates in the unit: complete years (Y),
+// months (M) or days (D), or months ignoring years (YM), days ignoring
+// months and years (MD) or days ignoring years (YD).
+func datedif(args []Value) (Value, error) {
+	from, err := args[0].Time()
+	if err != nil {
+		return Value{}, err
+	}
+
+	to, err := args[1].Time()
+	if err != nil {
+		return Value{}, err
+	}
+
+	unit, err := args[2].AsText()
+	if err != nil {
+		return Value{}, err
+	}
+
+	if days(from, to) < 0 {
+		return Value{}, ErrInvalidNumber
+	}
+
+	months := (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+	if to.Day() < from.Day() {
+		months--
+	}
+
+	switch strings.ToUpper(unit) {
+	case "Y":
+		return NumberValue(float64(months / 12)), nil
+	case "M":
+		return NumberValue(float64(months)), nil
+	case "D":
+		return NumberValue(float64(days(from, to))), nil
+	case "YM":
+		return NumberValue(float64(months % 12)), nil
+	case "MD":
+		return NumberValue(float64(days(addMonths(from, months), to))), nil
+	case "YD":
+		return NumberValue(float64(days(addMonths(from, months/12*12), to))), nil
+	}
+	return Value{}, ErrInvalidArgument
+}
+
+// networkdays counts days from Monday to Friday between the dates, both
+// inclusive, which are not holidays. It is negative if the end is earlier.
+func networkdays(args []Value) (Value, error) {
+	from, err := args[0].Time()
+	if err != nil {
+		return Value{}, err
+	}
+
+	to, err := args[1].Time()
+	if err != nil {
+		return Value{}, err
+	}
+
+	sign := 1.0
+	if days(from, to) < 0 {
+		from, to = to, from
+		sign = -1
+	}
+
+	holidays := make(map[int]bool)
+	if len(args) > 2 {
+		values := []Value{args[2]}
+		if args[2].IsArray() {
+			values = values[:0]
+			for _, row := range args[2].Array {
+				values = append(values, row...)
+			}
+		}
+
+		for _, v := range values {
+			if v.Empty {
+				continue
+			}
+
+			holiday, err := v.Time()
+			if err != nil {
+				return Value{}, err
+			}
+			holidays[days(epoch, holiday)] = true
+		}
+	}
+
+	total := days(from, to) + 1
+	// whole weeks have 5 working days, the rest is counted day by day
+	count := total / 7 * 5
+	start := days(epoch, from)
+	for day := start + total/7*7; day < start+total; day++ {
+		if isWorkday(day) {
+			count++
+		}
+	}
+
+	for day := range holidays {
+		if day >= start && day < start+total && isWorkday(day) {
+			count--
+		}
+	}
+
+	return NumberValue(sign * float64(count)), nil
+}
+
+// isWorkday tells if the day counted from 1899-12-30, a Saturday, is not a weekend.
+func isWorkday(day int) bool {
+	weekday := (day + 6) % 7
+	return weekday != int(time.Saturday) && weekday != int(time.Sunday)
+}
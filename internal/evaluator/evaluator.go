@@ -1,21 +1,165 @@
 package evaluator
 
 import (
+	"dev-challenge/internal/a1"
 	"dev-challenge/internal/parser"
+	"errors"
+	"fmt"
 	"strconv"
+	"strings"
 )
 
+// MaxRangeSize limits the number of cells a single range may span.
+const MaxRangeSize = 100000
+
+var (
+	ErrCircularReference = errors.New("circular reference")
+	ErrInvalidRange      = errors.New("invalid range")
+
+	ErrNotANumber     = &Error{Code: "#VALUE!", Message: "value is not a number"}
+	ErrDivisionByZero = &Error{Code: "#DIV/0!", Message: "division by zero"}
+	ErrInvalidNumber  = &Error{Code: "#NUM!", Message: "invalid numeric value"}
+)
+
+// Error is an error of a formula which spreadsheet applications
+// display by its code, e.g. #DIV/0!.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Code + " " + e.Message
+}
+
+// Value is a result of an expression. Formulas evaluate to numbers, texts
+// or dates, arrays are values of ranges.
+type Value struct {
+	Number float64
+	Text   string
+	IsText bool
+	// IsDate marks a Number which is a date, see DateValue.
+	IsDate bool
+
+	// Array holds rows of a range's values, it is nil for a single value.
+	Array [][]Value
+	// Empty marks a cell of a range which does not exist.
+	Empty bool
+}
+
+func NumberValue(number float64) Value {
+	return Value{Number: number}
+}
+
+func TextValue(text string) Value {
+	return Value{Text: text, IsText: true}
+}
+
+func (v Value) IsArray() bool {
+	return v.Array != nil
+}
+
+// Float returns the number, a text is converted only if it holds a number
+// and an empty cell counts as zero.
+func (v Value) Float() (float64, error) {
+	switch {
+	case v.IsArray():
+		return 0, ErrNotANumber
+	case !v.IsText:
+		return v.Number, nil
+	}
+
+	number, err := strconv.ParseFloat(v.Text, 64)
+	if err != nil {
+		return 0, ErrNotANumber
+	}
+	return number, nil
+}
+
+// Resolver provides formulas of the cells (or definitions of the names)
+// referenced by a tree. Refs are qualified ("sheet!cell") for cells of other
+// sheets and the sheet is empty for ranges of the sheet being evaluated.
+type Resolver interface {
+	Formula(ref string) (string, error)
+	// Range returns formulas of the existing cells of the range.
+	Range(sheet string, r a1.Range) (map[a1.Ref]string, error)
+}
+
+// ResolverFunc resolves cells of ranges one by one, skipping those which cannot be resolved.
+type ResolverFunc func(string) (string, error)
+
+func (f ResolverFunc) Formula(ref string) (string, error) {
+	return f(ref)
+}
+
+func (f ResolverFunc) Range(sheet string, r a1.Range) (map[a1.Ref]string, error) {
+	formulas := make(map[a1.Ref]string)
+	for _, ref := range r.Refs() {
+		formula, err := f(parser.Node{Value: ref.String(), Sheet: sheet}.Ref())
+		if err != nil {
+			continue
+		}
+		formulas[ref] = formula
+	}
+	return formulas, nil
+}
+
+// Evaluate computes the tree's result. Variables are resolved with getFormulaByID
+// which receives qualified names ("sheet!cell") for cells of other sheets.
+// Unqualified variables of a formula which belongs to another sheet are
+// qualified with that sheet, so they do not resolve against the current one.
 func Evaluate(tree parser.Tree, getFormulaByID func(string) (string, error)) (float64, error) {
-	result := 0.0
-	bufferedValue := 0.0
+	result, err := EvaluateValue(tree, ResolverFunc(getFormulaByID))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.Float()
+}
+
+// EvaluateValue is like Evaluate but returns values which are not numbers as well.
+func EvaluateValue(tree parser.Tree, resolver Resolver) (Value, error) {
+	e := evaluation{
+		resolver: resolver,
+		visiting: make(map[string]bool),
+		values:   make(map[string]Value),
+	}
+	return e.evaluate(tree, "", nil)
+}
+
+// evaluation keeps track of the variables which are currently being
+// resolved to detect formulas that (indirectly) reference themselves.
+// If it has a trace, the steps of the evaluation are recorded in it.
+type evaluation struct {
+	resolver Resolver
+	visiting map[string]bool
+	// values of the referenced cells and names which have been evaluated, so that
+	// one referenced many times, e.g. an anchor by the cells spilled from it, is
+	// evaluated once. It is nil if the evaluation is traced, to record every step.
+	values map[string]Value
+
+	trace *Trace
+	depth int
+}
+
+// frame holds arguments of the user-defined function being evaluated,
+// formulas of cells are evaluated without one.
+type frame struct {
+	args  map[string]Value
+	depth int
+}
+
+func (e *evaluation) evaluate(tree parser.Tree, sheet string, f *frame) (Value, error) {
+	result := Value{}
+	bufferedValue := Value{}
 	operation := parser.Node{}
 
 	for _, node := range tree {
 		switch {
 		case node.IsParentheses():
-			res, err := Evaluate(node.Children, getFormulaByID)
+			res, err := e.evaluate(node.Children, sheet, f)
 			if err != nil {
-				return 0, err
+				return Value{}, err
 			}
 			bufferedValue = res
 
@@ -25,47 +169,259 @@ func Evaluate(tree parser.Tree, getFormulaByID func(string) (string, error)) (fl
 			}
 			continue
 
-		case node.IsVar():
-			formula, err := getFormulaByID(node.Value)
+		case node.IsFunc():
+			args := make([]Value, 0, len(node.Children))
+			for _, arg := range node.Children {
+				res, err := e.evaluate(arg.Children, sheet, f)
+				if err != nil {
+					return Value{}, err
+				}
+				args = append(args, res)
+			}
+
+			e.depth++
+			res, err := e.call(node.Value, args, sheet, f)
+			e.depth--
+			e.record(func() string { return describeCall(node.Value, args) }, res, err)
 			if err != nil {
-				return 0, err
+				return Value{}, err
+			}
+			bufferedValue = res
+
+		case node.IsString():
+			bufferedValue = TextValue(node.Value)
+
+		case node.IsError():
+			// a reference to a cell which has been deleted
+			e.record(func() string { return node.Value }, Value{}, ErrInvalidReference)
+			return Value{}, ErrInvalidReference
+
+		case node.IsRange():
+			rangeSheet := sheet
+			if node.Sheet != "" {
+				rangeSheet = node.Sheet
 			}
-			parsedFormula, err := parser.Parse(formula)
+
+			res, err := e.evaluateRange(node.Value, rangeSheet)
+			e.record(node.Ref, res, err)
 			if err != nil {
-				return 0, err
+				return Value{}, err
 			}
-			res, err := Evaluate(parsedFormula, getFormulaByID)
+			bufferedValue = res
+
+		case node.IsVar():
+			if arg, ok := f.arg(node); ok {
+				bufferedValue = arg
+				break
+			}
+
+			varSheet := sheet
+			if node.Sheet != "" {
+				varSheet = node.Sheet
+			}
+			ref := parser.Node{Value: node.Value, Sheet: varSheet}.Ref()
+
+			formula, err := e.resolver.Formula(ref)
 			if err != nil {
-				return 0, err
+				e.record(node.Ref, Value{}, err)
+				return Value{}, err
+			}
+			res, err := e.evaluateFormula(ref, formula, varSheet)
+			e.record(node.Ref, res, err)
+			if err != nil {
+				return Value{}, err
 			}
 			bufferedValue = res
 		case node.IsNumber():
 			val, err := strconv.ParseFloat(node.Value, 64)
 			if err != nil {
-				return 0, err
+				return Value{}, err
 			}
-			bufferedValue = val
+			bufferedValue = NumberValue(val)
 		}
 
 		if operation.Kind == "" {
 			result = bufferedValue
-		} else {
-			switch operation.Kind {
-			case parser.KindOpPlus:
-				result += bufferedValue
-			case parser.KindOpMinus:
-				result -= bufferedValue
-			case parser.KindOpMultiply:
-				result *= bufferedValue
-			case parser.KindOpDivide:
-				result /= bufferedValue
-			default:
-				return 0, parser.ErrInvalidOperation
+			continue
+		}
+
+		res, err := operate(operation.Kind, result, bufferedValue)
+		e.record(func() string { return describeOperation(operation.Kind, result, bufferedValue) }, res, err)
+		if err != nil {
+			return Value{}, err
+		}
+		result = res
+		operation = parser.Node{}
+	}
+
+	return result, nil
+}
+
+// operate applies the arithmetic operation. If an operand is an array the operation
+// is applied to each of its values and the result is an array, operands which are
+// both arrays must have the same size.
+func operate(kind string, left, right Value) (Value, error) {
+	if !left.IsArray() && !right.IsArray() {
+		return operateNumbers(kind, left, right)
+	}
+
+	rows, cols := arraySize(left, right)
+	if rows < 0 {
+		return Value{}, ErrInvalidArgument
+	}
+
+	result := make([][]Value, 0, rows)
+	for row := 0; row < rows; row++ {
+		values := make([]Value, 0, cols)
+		for col := 0; col < cols; col++ {
+			value, err := operateNumbers(kind, element(left, row, col), element(right, row, col))
+			if err != nil {
+				return Value{}, err
 			}
+			values = append(values, value)
+		}
+		result = append(result, values)
+	}
+	return Value{Array: result}, nil
+}
+
+// arraySize returns the size of the operands' array, or -1 if they are arrays of different sizes.
+func arraySize(left, right Value) (int, int) {
+	switch {
+	case !left.IsArray():
+		return len(right.Array), len(right.Array[0])
+	case !right.IsArray():
+		return len(left.Array), len(left.Array[0])
+	case len(left.Array) != len(right.Array) || len(left.Array[0]) != len(right.Array[0]):
+		return -1, -1
+	}
+	return len(left.Array), len(left.Array[0])
+}
+
+// element returns the value of an array at the position, a single value is at every position.
+func element(v Value, row, col int) Value {
+	if !v.IsArray() {
+		return v
+	}
+	return v.Array[row][col]
+}
+
+func operateNumbers(kind string, leftValue, rightValue Value) (Value, error) {
+	left, err := leftValue.Float()
+	if err != nil {
+		return Value{}, err
+	}
+	right, err := rightValue.Float()
+	if err != nil {
+		return Value{}, err
+	}
+
+	// a date moved by a number of days is a date, the difference of dates is a number
+	isDate := false
+	switch kind {
+	case parser.KindOpPlus:
+		isDate = leftValue.IsDate != rightValue.IsDate
+	case parser.KindOpMinus:
+		isDate = leftValue.IsDate && !rightValue.IsDate
+	}
 
-			operation = parser.Node{}
+	switch kind {
+	case parser.KindOpPlus:
+		left += right
+	case parser.KindOpMinus:
+		left -= right
+	case parser.KindOpMultiply:
+		left *= right
+	case parser.KindOpDivide:
+		if right == 0 {
+			return Value{}, ErrDivisionByZero
 		}
+		left /= right
+	default:
+		return Value{}, parser.ErrInvalidOperation
 	}
 
+	result := NumberValue(left)
+	result.IsDate = isDate
 	return result, nil
 }
+
+// arg returns the argument an unqualified variable of a function's body refers to.
+func (f *frame) arg(node parser.Node) (Value, bool) {
+	if f == nil || node.Sheet != "" {
+		return Value{}, false
+	}
+
+	arg, ok := f.args[strings.ToLower(node.Value)]
+	return arg, ok
+}
+
+// evaluateFormula computes a formula of the referenced cell
+// whose unqualified variables belong to the given sheet.
+func (e *evaluation) evaluateFormula(ref, formula string, sheet string) (Value, error) {
+	// ids are case-insensitive, "A1" and "a1" are the same cell
+	ref = strings.ToLower(ref)
+	if e.visiting[ref] {
+		return Value{}, ErrCircularReference
+	}
+	if value, ok := e.values[ref]; ok {
+		return value, nil
+	}
+
+	parsedFormula, err := parser.Parse(formula)
+	if err != nil {
+		return Value{}, err
+	}
+
+	e.visiting[ref] = true
+	e.depth++
+	res, err := e.evaluate(parsedFormula, sheet, nil)
+	e.depth--
+	delete(e.visiting, ref)
+
+	if err == nil && e.values != nil {
+		e.values[ref] = res
+	}
+	return res, err
+}
+
+// evaluateRange returns an array with a row of values for every row of the range.
+func (e *evaluation) evaluateRange(value string, sheet string) (Value, error) {
+	r, ok := a1.ParseRange(value)
+	if !ok {
+		return Value{}, fmt.Errorf("%w: %s", ErrInvalidRange, value)
+	}
+
+	if r.Size() > MaxRangeSize {
+		return Value{}, fmt.Errorf("%w: %s spans more than %d cells", ErrInvalidRange, value, MaxRangeSize)
+	}
+
+	formulas, err := e.resolver.Range(sheet, r)
+	if err != nil {
+		return Value{}, err
+	}
+
+	rows := make([][]Value, 0, r.Rows())
+	for row := r.From.Row; row <= r.To.Row; row++ {
+		values := make([]Value, 0, r.Cols())
+		for col := r.From.Col; col <= r.To.Col; col++ {
+			cellRef := a1.Ref{Col: col, Row: row}
+
+			formula, ok := formulas[cellRef]
+			if !ok {
+				values = append(values, Value{Empty: true})
+				continue
+			}
+
+			ref := parser.Node{Value: cellRef.String(), Sheet: sheet}.Ref()
+			res, err := e.evaluateFormula(ref, formula, sheet)
+			if err != nil {
+				return Value{}, err
+			}
+			values = append(values, res)
+		}
+		rows = append(rows, values)
+	}
+
+	return Value{Array: rows}, nil
+}
@@ -4,7 +4,10 @@ import (
 	"dev-challenge/internal/evaluator"
 	"dev-challenge/internal/parser"
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEvaluator_Evaluate(t *testing.T) {
@@ -94,3 +97,758 @@ func getFormulaByID(id string) (string, error) {
 		return "", errors.New("cell not found")
 	}
 }
+
+func TestEvaluator_CircularReference(t *testing.T) {
+	formulas := map[string]string{
+		"A1": "=B1+1",
+		"B1": "=C1*2",
+		"C1": "=A1",
+	}
+
+	tree, err := parser.Parse(formulas["A1"])
+	if err != nil {
+		t.Fatalf("want (<nil>) got (%v)", err)
+	}
+
+	_, err = evaluator.Evaluate(tree, func(id string) (string, error) {
+		formula, ok := formulas[id]
+		if !ok {
+			return "", errors.New("cell not found")
+		}
+		return formula, nil
+	})
+	if !errors.Is(err, evaluator.ErrCircularReference) {
+		t.Fatalf("want (%v) got (%v)", evaluator.ErrCircularReference, err)
+	}
+}
+
+func TestEvaluator_QualifiedVariables(t *testing.T) {
+	formulas := map[string]string{
+		"A1":        "10",
+		"budget!A1": "100",
+		"budget!B1": "=A1*2",
+	}
+
+	tree, err := parser.Parse("=budget!B1+A1")
+	if err != nil {
+		t.Fatalf("want (<nil>) got (%v)", err)
+	}
+
+	result, err := evaluator.Evaluate(tree, func(id string) (string, error) {
+		formula, ok := formulas[id]
+		if !ok {
+			return "", errors.New("cell not found")
+		}
+		return formula, nil
+	})
+	if err != nil {
+		t.Fatalf("want (<nil>) got (%v)", err)
+	}
+
+	// A1 of the budget formula refers to budget!A1
+	if result != 210 {
+		t.Fatalf("want (210) got (%v)", result)
+	}
+}
+
+func TestEvaluator_Functions(t *testing.T) {
+	evaluator.RegisterFunction("LENGTH", evaluator.Function{
+		MinArgs: 1,
+		MaxArgs: 1,
+		Call: func(args []evaluator.Value) (evaluator.Value, error) {
+			if !args[0].IsText {
+				return evaluator.Value{}, evaluator.ErrInvalidArgument
+			}
+			return evaluator.NumberValue(float64(len(args[0].Text))), nil
+		},
+	})
+
+	testCases := []struct {
+		input string
+		want  float64
+		err   error
+	}{
+		{input: `=length("abc")*2-1`, want: 5},
+		{input: `=LENGTH("a" )+A1`, want: 3},
+		{input: `=LENGTH(1)`, err: evaluator.ErrInvalidArgument},
+		{input: `=LENGTH("a", "b")`, err: evaluator.ErrArgumentCount},
+		{input: `=UNKNOWN(1)`, err: evaluator.ErrUnknownFunction},
+		{input: `="12"+1`, want: 13},
+		{input: `="abc"+1`, err: evaluator.ErrNotANumber},
+	}
+
+	for _, test := range testCases {
+		tree, err := parser.Parse(test.input)
+		if err != nil {
+			t.Fatalf("%s: want (<nil>) got (%v)", test.input, err)
+		}
+
+		result, err := evaluator.Evaluate(tree, getFormulaByID)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s: want (%v) got (%v)", test.input, test.err, err)
+		}
+		if result != test.want {
+			t.Fatalf("%s: want (%v) got (%v)", test.input, test.want, result)
+		}
+	}
+}
+
+func TestEvaluator_Ranges(t *testing.T) {
+	formulas := map[string]string{
+		"a1":        "1",
+		"a2":        "=a1*2",
+		"b1":        "3",
+		"b3":        "=SUM(a1:b2)",
+		"c1":        "=SUM(a1:c1)",
+		"budget!a1": "10",
+		"budget!a2": "20",
+	}
+	getFormula := func(id string) (string, error) {
+		formula, ok := formulas[id]
+		if !ok {
+			return "", errors.New("cell not found")
+		}
+		return formula, nil
+	}
+
+	testCases := []struct {
+		input string
+		want  float64
+		err   error
+	}{
+		{input: "=SUM(a1:b2)", want: 6},
+		{input: "=SUM(B2:A1, 1)", want: 7},
+		{input: "=b3+1", want: 7},
+		{input: "=AVERAGE(a1:a3)", want: 1.5},
+		{input: "=MIN(a1:b1)+MAX(a1:b2)", want: 4},
+		{input: "=COUNT(a1:b3)", want: 4},
+		{input: "=SUM(budget!a1:a2)", want: 30},
+		{input: "=SUM($a$1:b$2)+$a1", want: 7},
+		{input: "=#REF!+1", err: evaluator.ErrInvalidReference},
+		{input: "=AVERAGE(d1:d9)", err: evaluator.ErrDivisionByZero},
+		{input: "=c1", err: evaluator.ErrCircularReference},
+		{input: "=SUM(a1:total)", err: evaluator.ErrInvalidRange},
+		{input: "=SUM(a1:zz1000)", err: evaluator.ErrInvalidRange},
+		{input: "=SUM(a1:b4611686018427387905)", err: evaluator.ErrInvalidRange},
+		{input: "=a1:a2", err: evaluator.ErrNotANumber},
+	}
+
+	for _, test := range testCases {
+		tree, err := parser.Parse(test.input)
+		if err != nil {
+			t.Fatalf("%s: want (<nil>) got (%v)", test.input, err)
+		}
+
+		result, err := evaluator.Evaluate(tree, getFormula)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s: want (%v) got (%v)", test.input, test.err, err)
+		}
+		if result != test.want {
+			t.Fatalf("%s: want (%v) got (%v)", test.input, test.want, result)
+		}
+	}
+}
+
+func TestEvaluator_FormulaFunctions(t *testing.T) {
+	body, err := parser.Parse("(Price - cost) / price")
+	if err != nil {
+		t.Fatalf("want (<nil>) got (%v)", err)
+	}
+	evaluator.RegisterFunction("MARGIN", evaluator.FormulaFunction([]string{"cost", "price"}, body))
+
+	recursive, err := parser.Parse("DEEP(x) + 1")
+	if err != nil {
+		t.Fatalf("want (<nil>) got (%v)", err)
+	}
+	evaluator.RegisterFunction("DEEP", evaluator.FormulaFunction([]string{"x"}, recursive))
+
+	testCases := []struct {
+		input string
+		want  float64
+		err   error
+	}{
+		{input: "=MARGIN(50, 200)", want: 0.75},
+		// arguments are evaluated in the caller's scope, parameters do not leak into cells
+		{input: "=MARGIN(A1, A1*4)*A2", want: 3},
+		{input: "=MARGIN(1)", err: evaluator.ErrArgumentCount},
+		{input: "=DEEP(1)", err: evaluator.ErrRecursionLimit},
+	}
+
+	for _, test := range testCases {
+		tree, err := parser.Parse(test.input)
+		if err != nil {
+			t.Fatalf("%s: want (<nil>) got (%v)", test.input, err)
+		}
+
+		result, err := evaluator.Evaluate(tree, getFormulaByID)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s: want (%v) got (%v)", test.input, test.err, err)
+		}
+		if result != test.want {
+			t.Fatalf("%s: want (%v) got (%v)", test.input, test.want, result)
+		}
+	}
+}
+
+func TestEvaluator_Math(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  float64
+		err   error
+	}{
+		{input: "=ROUND(2.5)", want: 3},
+		{input: "=ROUND(-2.5)", want: -3},
+		{input: "=ROUND(1.005, 2)", want: 1.01},
+		{input: "=ROUND(1234.5, -2)", want: 1200},
+		{input: "=ROUNDUP(1.21, 1)", want: 1.3},
+		{input: "=ROUNDUP(-1.21, 1)", want: -1.3},
+		{input: "=ROUNDDOWN(1.29, 1)", want: 1.2},
+		{input: "=ROUNDDOWN(-1.29)", want: -1},
+		{input: "=ABS(-3)+SQRT(16)", want: 7},
+		{input: "=SQRT(-1)", err: evaluator.ErrInvalidNumber},
+		{input: "=POWER(2, 10)", want: 1024},
+		{input: "=POWER(0, -1)", err: evaluator.ErrDivisionByZero},
+		{input: "=POWER(-8, 0.5)", err: evaluator.ErrInvalidNumber},
+		{input: "=MOD(7, 3)", want: 1},
+		{input: "=MOD(-3, 2)", want: 1},
+		{input: "=MOD(3, -2)", want: -1},
+		{input: "=MOD(1, 0)", err: evaluator.ErrDivisionByZero},
+		{input: "=FLOOR(2.5)", want: 2},
+		{input: "=FLOOR(-2.5, 2)", want: -4},
+		{input: "=FLOOR(-2.5, -2)", want: -2},
+		{input: "=FLOOR(2.5, -2)", err: evaluator.ErrInvalidNumber},
+		{input: "=FLOOR(2.5, 0)", err: evaluator.ErrDivisionByZero},
+		{input: "=CEILING(2.1, 0.5)", want: 2.5},
+		{input: "=CEILING(-2.5, 2)", want: -2},
+		{input: "=CEILING(2.5, 0)", want: 0},
+		{input: "=LN(EXP(2))", want: 2},
+		{input: "=LOG10(1000)", want: 3},
+		{input: "=LN(0)", err: evaluator.ErrInvalidNumber},
+		{input: "=EXP(1000)", err: evaluator.ErrInvalidNumber},
+		{input: "=ROUND(PI(), 4)", want: 3.1416},
+		{input: "=PI(1)", err: evaluator.ErrArgumentCount},
+		{input: "=ROUND()", err: evaluator.ErrArgumentCount},
+		{input: `=ABS("x")`, err: evaluator.ErrNotANumber},
+		{input: "=RANDBETWEEN(2, 1)", err: evaluator.ErrInvalidNumber},
+		{input: "=1/0", err: evaluator.ErrDivisionByZero},
+	}
+
+	for _, test := range testCases {
+		tree, err := parser.Parse(test.input)
+		if err != nil {
+			t.Fatalf("%s: want (<nil>) got (%v)", test.input, err)
+		}
+
+		result, err := evaluator.Evaluate(tree, getFormulaByID)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s: want (%v) got (%v)", test.input, test.err, err)
+		}
+		if result != test.want {
+			t.Fatalf("%s: want (%v) got (%v)", test.input, test.want, result)
+		}
+	}
+}
+
+func TestEvaluator_Random(t *testing.T) {
+	evaluate := func(input string) float64 {
+		tree, err := parser.Parse(input)
+		if err != nil {
+			t.Fatalf("%s: want (<nil>) got (%v)", input, err)
+		}
+
+		result, err := evaluator.Evaluate(tree, getFormulaByID)
+		if err != nil {
+			t.Fatalf("%s: want (<nil>) got (%v)", input, err)
+		}
+		return result
+	}
+
+	evaluator.SeedRandom(42)
+	first := []float64{evaluate("=RAND()"), evaluate("=RANDBETWEEN(1, 6)")}
+
+	evaluator.SeedRandom(42)
+	second := []float64{evaluate("=RAND()"), evaluate("=RANDBETWEEN(1, 6)")}
+
+	if first[0] != second[0] || first[1] != second[1] {
+		t.Fatalf("want (%v) got (%v)", first, second)
+	}
+	if first[0] < 0 || first[0] >= 1 {
+		t.Fatalf("=RAND(): want [0, 1) got (%v)", first[0])
+	}
+	if first[1] < 1 || first[1] > 6 || first[1] != float64(int(first[1])) {
+		t.Fatalf("=RANDBETWEEN(1, 6): want integer in [1, 6] got (%v)", first[1])
+	}
+}
+
+func TestEvaluator_Text(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  string
+		err   error
+	}{
+		{input: `=LEN("héllo wörld")`, want: "11"},
+		{input: `=LEN(A1*100)`, want: "3"},
+		{input: `=UPPER("héllo")`, want: "HÉLLO"},
+		{input: `=LOWER("ÉCOLE")`, want: "école"},
+		{input: `=TRIM("  a   b  ")`, want: "a b"},
+		{input: `=LEFT("日本語")`, want: "日"},
+		{input: `=LEFT("日本語", 2)`, want: "日本"},
+		{input: `=RIGHT("日本語", 5)`, want: "日本語"},
+		{input: `=MID("привет", 2, 3)`, want: "рив"},
+		{input: `=MID("abc", 5, 1)`, want: ""},
+		{input: `=MID("abc", 0, 1)`, err: evaluator.ErrInvalidArgument},
+		{input: `=LEFT("abc", -1)`, err: evaluator.ErrInvalidArgument},
+		{input: `=CONCAT("a", 1, "é", A2)`, want: "a1é4"},
+		{input: `=SUBSTITUTE("a-b-c", "-", "+")`, want: "a+b+c"},
+		{input: `=SUBSTITUTE("a-b-c", "-", "+", 2)`, want: "a-b+c"},
+		{input: `=SUBSTITUTE("a-b-c", "-", "+", 3)`, want: "a-b-c"},
+		{input: `=FIND("ö", "höhö")`, want: "2"},
+		{input: `=FIND("ö", "höhö", 3)`, want: "4"},
+		{input: `=FIND("O", "höhö")`, err: evaluator.ErrInvalidArgument},
+		{input: `=TEXT(1234.567, "#,##0.00")`, want: "1,234.57"},
+		{input: `=TEXT(-1234.5, "$#,##0")`, want: "-$1,235"},
+		{input: `=TEXT(0.256, "0.0%")`, want: "25.6%"},
+		{input: `=TEXT(1.5, "000.##")`, want: "001.5"},
+		{input: `=TEXT(0.5, "#.00")`, want: ".50"},
+		{input: `=VALUE("1,250.5")+1`, want: "1251.5"},
+		{input: `=VALUE("15%")`, want: "0.15"},
+		{input: `=VALUE("abc")`, err: evaluator.ErrNotANumber},
+		{input: `=VALUE("-1.5e3")`, want: "-1500"},
+		{input: `=VALUE(".5")`, want: "0.5"},
+		{input: `=VALUE("NaN")`, err: evaluator.ErrNotANumber},
+		{input: `=VALUE("-Inf")`, err: evaluator.ErrNotANumber},
+		{input: `=VALUE("infinity")`, err: evaluator.ErrNotANumber},
+		{input: `=VALUE("0x1p-2")`, err: evaluator.ErrNotANumber},
+		{input: `=VALUE("1e400")`, err: evaluator.ErrNotANumber},
+		{input: `=LEN("a", "b")`, err: evaluator.ErrArgumentCount},
+	}
+
+	resolver := evaluator.ResolverFunc(getFormulaByID)
+	for _, test := range testCases {
+		tree, err := parser.Parse(test.input)
+		if err != nil {
+			t.Fatalf("%s: want (<nil>) got (%v)", test.input, err)
+		}
+
+		result, err := evaluator.EvaluateValue(tree, resolver)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s: want (%v) got (%v)", test.input, test.err, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		text, err := result.AsText()
+		if err != nil {
+			t.Fatalf("%s: want (<nil>) got (%v)", test.input, err)
+		}
+		if text != test.want {
+			t.Fatalf("%s: want (%q) got (%q)", test.input, test.want, text)
+		}
+	}
+}
+
+func TestEvaluator_Dates(t *testing.T) {
+	evaluator.SetClock(func() time.Time {
+		return time.Date(2024, time.March, 15, 13, 30, 5, 0, time.UTC)
+	})
+	defer evaluator.SetClock(time.Now)
+
+	testCases := []struct {
+		input string
+		want  string
+		err   error
+	}{
+		{input: "=DATE(2024, 1, 31)", want: "2024-01-31"},
+		{input: "=DATE(2024, 14, 1)", want: "2025-02-01"},
+		{input: "=DATE(2024, 3, 0)", want: "2024-02-29"},
+		{input: "=DATE(2024, 1, 31)*1", want: "45322"},
+		{input: "=DATE(2024, 1, 31)+30", want: "2024-03-01"},
+		{input: "=1+DATE(2024, 1, 31)", want: "2024-02-01"},
+		{input: "=DATE(2024, 3, 1)-DATE(2024, 2, 1)", want: "29"},
+		{input: "=DATE(2024, 3, 1)-1", want: "2024-02-29"},
+		{input: "=TODAY()", want: "2024-03-15"},
+		{input: "=NOW()", want: "2024-03-15 13:30:05"},
+		{input: "=NOW()-TODAY()+DATE(2000, 1, 1)", want: "2000-01-01 13:30:05"},
+		{input: `=YEAR("2024-02-29")*10000+MONTH(DATE(2024, 2, 29))*100+DAY(TODAY())`, want: "20240215"},
+		{input: "=WEEKDAY(DATE(2024, 3, 17))", want: "1"},
+		{input: "=WEEKDAY(DATE(2024, 3, 17), 2)", want: "7"},
+		{input: "=WEEKDAY(DATE(2024, 3, 18), 3)", want: "0"},
+		{input: "=WEEKDAY(DATE(2024, 3, 18), 4)", err: evaluator.ErrInvalidNumber},
+		{input: "=EDATE(DATE(2024, 1, 31), 1)", want: "2024-02-29"},
+		{input: `=EDATE("2024-03-31", -13)`, want: "2023-02-28"},
+		{input: `=DATEDIF("2020-02-29", "2024-02-28", "Y")`, want: "3"},
+		{input: `=DATEDIF("2020-02-29", "2024-02-28", "m")`, want: "47"},
+		{input: `=DATEDIF("2024-01-01", "2024-03-01", "D")`, want: "60"},
+		{input: `=DATEDIF("2023-01-15", "2024-03-10", "YM")`, want: "1"},
+		{input: `=DATEDIF("2023-01-15", "2024-03-10", "MD")`, want: "24"},
+		{input: `=DATEDIF("2023-01-15", "2024-03-10", "YD")`, want: "55"},
+		{input: `=DATEDIF("2024-03-10", "2023-01-15", "D")`, err: evaluator.ErrInvalidNumber},
+		{input: `=DATEDIF("2023-01-15", "2024-03-10", "W")`, err: evaluator.ErrInvalidArgument},
+		{input: `=NETWORKDAYS("2024-03-01", "2024-03-31")`, want: "21"},
+		{input: `=NETWORKDAYS("2024-03-31", "2024-03-01")`, want: "-21"},
+		{input: `=NETWORKDAYS("2024-03-16", "2024-03-17")`, want: "0"},
+		{input: `=NETWORKDAYS("2024-03-01", "2024-03-31", "2024-03-29")`, want: "20"},
+		{input: `=NETWORKDAYS("2024-03-01", "2024-03-31", "2024-03-30")`, want: "21"},
+		{input: `=CONCAT("due ", DATE(2024, 1, 31))`, want: "due 2024-01-31"},
+		{input: "=DATE(2200, 1, 1)", want: "2200-01-01"},
+		{input: "=DATE(2300, 1, 1)", want: "2300-01-01"},
+		{input: "=DATE(9999, 12, 31)*1", want: "2958465"},
+		{input: "=YEAR(DATE(9999, 12, 31))", want: "9999"},
+		{input: "=DAY(DATE(9999, 12, 31))", want: "31"},
+		{input: "=YEAR(DATE(9999, 12, 31)+1)", err: evaluator.ErrInvalidNumber},
+		{input: `=DATEDIF("1900-01-01", "9999-12-31", "D")`, want: "2958463"},
+		{input: `=EDATE("2200-01-31", 1)`, want: "2200-02-28"},
+		{input: `=YEAR("31/01/2024")`, err: evaluator.ErrNotANumber},
+		{input: "=DATE(10000, 1, 1)", err: evaluator.ErrInvalidNumber},
+		{input: "=YEAR(-1)", err: evaluator.ErrInvalidNumber},
+	}
+
+	resolver := evaluator.ResolverFunc(getFormulaByID)
+	for _, test := range testCases {
+		tree, err := parser.Parse(test.input)
+		if err != nil {
+			t.Fatalf("%s: want (<nil>) got (%v)", test.input, err)
+		}
+
+		result, err := evaluator.EvaluateValue(tree, resolver)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s: want (%v) got (%v)", test.input, test.err, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		text, err := result.AsText()
+		if err != nil {
+			t.Fatalf("%s: want (<nil>) got (%v)", test.input, err)
+		}
+		if text != test.want {
+			t.Fatalf("%s: want (%q) got (%q)", test.input, test.want, text)
+		}
+	}
+}
+
+func TestEvaluator_VolatileFunctions(t *testing.T) {
+	body, err := parser.Parse("=TODAY()+days")
+	if err != nil {
+		t.Fatalf("want (<nil>) got (%v)", err)
+	}
+	evaluator.RegisterFunction("DUE", evaluator.FormulaFunction([]string{"days"}, body))
+	defer evaluator.UnregisterFunction("DUE")
+
+	volatile := make(map[string]bool)
+	for _, name := range evaluator.VolatileFunctions() {
+		volatile[name] = true
+	}
+
+	for _, name := range []string{"TODAY", "NOW", "RAND", "DUE"} {
+		if !volatile[name] {
+			t.Fatalf("%s: want volatile got (%v)", name, evaluator.VolatileFunctions())
+		}
+	}
+	if volatile["DATE"] || volatile["SUM"] {
+		t.Fatalf("want DATE and SUM not volatile got (%v)", evaluator.VolatileFunctions())
+	}
+}
+
+func TestEvaluator_Lookups(t *testing.T) {
+	// a price list with a header row
+	formulas := map[string]string{
+		"a1": `="fruit"`, "b1": `="price"`, "c1": `="stock"`,
+		"a2": `="apple"`, "b2": "1.2", "c2": "10",
+		"a3": `="banana"`, "b3": "0.5", "c3": "0",
+		"a4": `="cherry"`, "b4": "4", "c4": "25",
+		"e1": "0", "e2": "100", "e3": "500", "e4": "1000",
+		"f1": `="none"`, "f2": `="bronze"`, "f3": `="silver"`, "f4": `="gold"`,
+		"h1": "30", "h2": "20", "h3": "10",
+		"g1": `="a*b"`,
+	}
+	getFormula := func(id string) (string, error) {
+		formula, ok := formulas[id]
+		if !ok {
+			return "", errors.New("cell not found")
+		}
+		return formula, nil
+	}
+
+	testCases := []struct {
+		input string
+		want  string
+		err   error
+	}{
+		{input: `=VLOOKUP("banana", a2:c4, 2, 0)`, want: "0.5"},
+		{input: `=VLOOKUP("CHERRY", a2:c4, 3, 0)`, want: "25"},
+		{input: `=VLOOKUP("b*", a2:c4, 2, 0)`, want: "0.5"},
+		{input: `=VLOOKUP("?pple", a2:c4, 1, 0)`, want: "apple"},
+		{input: `=VLOOKUP("kiwi", a2:c4, 2, 0)`, err: evaluator.ErrNotAvailable},
+		{input: `=VLOOKUP(750, e1:f4, 2)`, want: "silver"},
+		{input: `=VLOOKUP(1000, e1:f4, 2, 1)`, want: "gold"},
+		{input: `=VLOOKUP(-1, e1:f4, 2)`, err: evaluator.ErrNotAvailable},
+		{input: `=VLOOKUP("apple", a2:c4, 4, 0)`, err: evaluator.ErrInvalidReference},
+		{input: `=VLOOKUP("apple", a2:c4, 0, 0)`, err: evaluator.ErrInvalidArgument},
+		{input: `=HLOOKUP("stock", a1:c4, 4, 0)`, want: "25"},
+		{input: `=HLOOKUP("price", a1:c4, 5, 0)`, err: evaluator.ErrInvalidReference},
+		{input: `=INDEX(a1:c4, 3, 2)`, want: "0.5"},
+		{input: `=INDEX(a2:a4, 2)`, want: "banana"},
+		{input: `=INDEX(a1:c1, 3)`, want: "stock"},
+		{input: `=SUM(INDEX(a1:c4, 0, 3))`, want: "35"},
+		{input: `=SUM(INDEX(a1:c4, 4, 0))`, want: "29"},
+		{input: `=INDEX(a1:c4, 5, 1)`, err: evaluator.ErrInvalidReference},
+		{input: `=INDEX(a1:c4, 2, MATCH("stock", a1:c1, 0))`, want: "10"},
+		{input: `=MATCH("cherry", a1:a4, 0)`, want: "4"},
+		{input: `=MATCH(999, e1:e4)`, want: "3"},
+		{input: `=MATCH(15, h1:h3, -1)`, want: "2"},
+		{input: `=MATCH(35, h1:h3, -1)`, err: evaluator.ErrNotAvailable},
+		{input: `=MATCH(1, a1:c4, 0)`, err: evaluator.ErrNotAvailable},
+		{input: `=XLOOKUP("cherry", a2:a4, b2:b4)`, want: "4"},
+		{input: `=XLOOKUP("c*", a2:a4, b2:b4)`, err: evaluator.ErrNotAvailable},
+		{input: `=XLOOKUP("c*", a2:a4, b2:b4, 0, 2)`, want: "4"},
+		{input: `=XLOOKUP("kiwi", a2:a4, b2:b4, "missing")`, want: "missing"},
+		{input: `=XLOOKUP(750, e1:e4, f1:f4, "", -1)`, want: "silver"},
+		{input: `=XLOOKUP(750, e1:e4, f1:f4, "", 1)`, want: "gold"},
+		{input: `=XLOOKUP("price", a1:c1, a4:c4)`, want: "4"},
+		{input: `=SUM(XLOOKUP("banana", a2:a4, b2:c4))`, want: "0.5"},
+		{input: `=XLOOKUP(0, c2:c4, a2:a4, "", 1, -1)`, want: "banana"},
+		{input: `=XLOOKUP(1, a2:a4, b2:b3)`, err: evaluator.ErrInvalidArgument},
+		{input: `=MATCH("a~*b", g1:g1, 0)`, want: "1"},
+		{input: `=MATCH("a~*", g1:g1, 0)`, err: evaluator.ErrNotAvailable},
+		{input: `=MATCH("*b", g1:g1, 0)`, want: "1"},
+	}
+
+	resolver := evaluator.ResolverFunc(getFormula)
+	for _, test := range testCases {
+		tree, err := parser.Parse(test.input)
+		if err != nil {
+			t.Fatalf("%s: want (<nil>) got (%v)", test.input, err)
+		}
+
+		result, err := evaluator.EvaluateValue(tree, resolver)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s: want (%v) got (%v)", test.input, test.err, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		text, err := result.AsText()
+		if err != nil {
+			t.Fatalf("%s: want (<nil>) got (%v)", test.input, err)
+		}
+		if text != test.want {
+			t.Fatalf("%s: want (%q) got (%q)", test.input, test.want, text)
+		}
+	}
+}
+
+func TestEvaluator_ConditionalAggregates(t *testing.T) {
+	// orders: region, status, amount, date
+	formulas := map[string]string{
+		"a1": `="north"`, "b1": `="done"`, "c1": "100", "d1": "=DATE(2024, 1, 10)",
+		"a2": `="south"`, "b2": `="open"`, "c2": "250", "d2": "=DATE(2024, 2, 5)",
+		"a3": `="north"`, "b3": `="open"`, "c3": "50", "d3": "=DATE(2024, 2, 20)",
+		"a4": `="North-East"`, "b4": `="done"`, "c4": "300", "d4": "=DATE(2024, 3, 1)",
+		"a5": `="west"`, "c5": `="n/a"`, "d5": "=DATE(2024, 3, 15)",
+	}
+	getFormula := func(id string) (string, error) {
+		formula, ok := formulas[id]
+		if !ok {
+			return "", errors.New("cell not found")
+		}
+		return formula, nil
+	}
+
+	testCases := []struct {
+		input string
+		want  float64
+		err   error
+	}{
+		{input: `=SUMIF(c1:c5, ">100")`, want: 550},
+		{input: `=SUMIF(c1:c5, ">=100")`, want: 650},
+		{input: `=SUMIF(a1:a5, "north", c1:c5)`, want: 150},
+		{input: `=SUMIF(a1:a5, "north*", c1:c5)`, want: 450},
+		{input: `=SUMIF(a1:a5, "?????", c1:c5)`, want: 400},
+		{input: `=SUMIF(a1:a5, "<>north", c1:c5)`, want: 550},
+		{input: `=SUMIF(c1:c5, 250)`, want: 250},
+		{input: `=COUNTIF(b1:b5, "done")`, want: 2},
+		{input: `=COUNTIF(b1:b5, "")`, want: 1},
+		{input: `=COUNTIF(b1:b5, "<>")`, want: 4},
+		{input: `=COUNTIF(c1:c5, "<>100")`, want: 4},
+		{input: `=COUNTIF(a1:a5, ">s")`, want: 2},
+		{input: `=COUNTIF(d1:d5, ">=2024-02-20")`, want: 3},
+		{input: `=AVERAGEIF(b1:b5, "open", c1:c5)`, want: 150},
+		{input: `=AVERAGEIF(a1:a5, "west", c1:c5)`, err: evaluator.ErrDivisionByZero},
+		{input: `=SUMIFS(c1:c5, a1:a5, "north*", b1:b5, "done")`, want: 400},
+		{input: `=SUMIFS(c1:c5, d1:d5, ">=2024-02-01", d1:d5, "<2024-03-01")`, want: 300},
+		{input: `=COUNTIFS(a1:a5, "north", b1:b5, "open")`, want: 1},
+		{input: `=AVERAGEIFS(c1:c5, b1:b5, "done")`, want: 200},
+		{input: `=SUMIFS(c1:c5, a1:a5)`, err: evaluator.ErrArgumentCount},
+		{input: `=SUMIF(a1:a4, "north", c1:c5)`, err: evaluator.ErrInvalidArgument},
+		{input: `=COUNTIF(a1:a5, a1:a2)`, err: evaluator.ErrInvalidArgument},
+	}
+
+	for _, test := range testCases {
+		tree, err := parser.Parse(test.input)
+		if err != nil {
+			t.Fatalf("%s: want (<nil>) got (%v)", test.input, err)
+		}
+
+		result, err := evaluator.Evaluate(tree, getFormula)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s: want (%v) got (%v)", test.input, test.err, err)
+		}
+		if result != test.want {
+			t.Fatalf("%s: want (%v) got (%v)", test.input, test.want, result)
+		}
+	}
+}
+
+func TestEvaluator_Arrays(t *testing.T) {
+	formulas := map[string]string{
+		"a1": "3", "a2": "1", "a3": "2",
+		"b1": `="c"`, "b2": `="a"`, "b3": `="b"`,
+	}
+	getFormula := func(id string) (string, error) {
+		formula, ok := formulas[id]
+		if !ok {
+			return "", errors.New("cell not found")
+		}
+		return formula, nil
+	}
+
+	// rows are separated by ";" and values of a row by ","
+	testCases := []struct {
+		input string
+		want  string
+		err   error
+	}{
+		{input: "=a1:a3*2", want: "6;2;4"},
+		{input: "=1+a1:a3", want: "4;2;3"},
+		{input: "=a1:a3-a1:a3", want: "0;0;0"},
+		{input: "=(a1:a3+1)/2", want: "2;1;1.5"},
+		{input: "=a1:a3+a1:a2", err: evaluator.ErrInvalidArgument},
+		{input: "=a1:a3/0", err: evaluator.ErrDivisionByZero},
+		{input: "=b1:b3*2", err: evaluator.ErrNotANumber},
+		{input: "=SORT(a1:a3)", want: "1;2;3"},
+		{input: "=SORT(a1:a3, 1, -1)", want: "3;2;1"},
+		{input: "=SORT(a1:b3, 2)", want: "1,a;2,b;3,c"},
+		{input: "=SORT(a1:b3, 3)", err: evaluator.ErrInvalidArgument},
+		{input: "=SORT(a1:a3, 1, 0)", err: evaluator.ErrInvalidArgument},
+		{input: "=SEQUENCE(3)", want: "1;2;3"},
+		{input: "=SEQUENCE(2, 3, 10, -1)", want: "10,9,8;7,6,5"},
+		{input: "=SEQUENCE(0)", err: evaluator.ErrInvalidArgument},
+		{input: "=TRANSPOSE(a1:b2)", want: "3,1;c,a"},
+		{input: "=SUM(SEQUENCE(4)*2)", want: "20"},
+	}
+
+	resolver := evaluator.ResolverFunc(getFormula)
+	for _, test := range testCases {
+		tree, err := parser.Parse(test.input)
+		if err != nil {
+			t.Fatalf("%s: want (<nil>) got (%v)", test.input, err)
+		}
+
+		result, err := evaluator.EvaluateValue(tree, resolver)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s: want (%v) got (%v)", test.input, test.err, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		rows := [][]evaluator.Value{{result}}
+		if result.IsArray() {
+			rows = result.Array
+		}
+
+		got := ""
+		for i, row := range rows {
+			if i > 0 {
+				got += ";"
+			}
+			for j, v := range row {
+				if j > 0 {
+					got += ","
+				}
+				text, err := v.AsText()
+				if err != nil {
+					t.Fatalf("%s: want (<nil>) got (%v)", test.input, err)
+				}
+				got += text
+			}
+		}
+
+		if got != test.want {
+			t.Fatalf("%s: want (%q) got (%q)", test.input, test.want, got)
+		}
+	}
+}
+
+func TestEvaluator_Explain(t *testing.T) {
+	formulas := map[string]string{
+		"a1": "2",
+		"a2": "=a1*3",
+		"b1": "=1/0",
+		"b2": `="x"`,
+	}
+	getFormula := func(id string) (string, error) {
+		formula, ok := formulas[id]
+		if !ok {
+			return "", errors.New("cell not found")
+		}
+		return formula, nil
+	}
+
+	testCases := []struct {
+		input string
+		want  []string
+		err   error
+	}{
+		{input: "=1+2", want: []string{"0 1 + 2 = 3"}},
+		{
+			input: "=a2+SUM(a1:a2)",
+			want: []string{
+				"1 a1 = 2",
+				"1 2 * 3 = 6",
+				"0 a2 = 6",
+				"1 a1 = 2",
+				"1 2 * 3 = 6",
+				"0 a1:a2 = {2; 6}",
+				"0 SUM({2; 6}) = 8",
+				"0 6 + 8 = 14",
+			},
+		},
+		{input: `=CONCAT(b2, "y")`, want: []string{`0 b2 = "x"`, `0 CONCAT("x", "y") = "xy"`}},
+		{
+			input: "=a1+b1",
+			want:  []string{"0 a1 = 2", "1 1 / 0 ! #DIV/0! division by zero", "0 b1 ! #DIV/0! division by zero"},
+			err:   evaluator.ErrDivisionByZero,
+		},
+	}
+
+	resolver := evaluator.ResolverFunc(getFormula)
+	for _, test := range testCases {
+		tree, err := parser.Parse(test.input)
+		if err != nil {
+			t.Fatalf("%s: want (<nil>) got (%v)", test.input, err)
+		}
+
+		_, trace, err := evaluator.Explain(tree, resolver)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s: want (%v) got (%v)", test.input, test.err, err)
+		}
+
+		got := make([]string, 0, len(trace.Steps))
+		for _, step := range trace.Steps {
+			described := fmt.Sprintf("%d %s = %s", step.Depth, step.Expression, step.Value)
+			if step.Error != "" {
+				described = fmt.Sprintf("%d %s ! %s", step.Depth, step.Expression, step.Error)
+			}
+			got = append(got, described)
+		}
+
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") || trace.Truncated {
+			t.Fatalf("%s: want (%q) got (%q)", test.input, test.want, got)
+		}
+	}
+}
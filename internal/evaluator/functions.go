@@ -0,0 +1,159 @@
+package evaluator
+
+import (
+	"dev-challenge/internal/parser"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrUnknownFunction = errors.New("unknown function")
+	ErrArgumentCount   = errors.New("wrong number of arguments")
+	ErrRecursionLimit  = errors.New("recursion limit exceeded")
+
+	ErrInvalidArgument = &Error{Code: "#VALUE!", Message: "invalid argument"}
+)
+
+const (
+	// Variadic is used as Function.MaxArgs of functions
+	// accepting any number of arguments.
+	Variadic = -1
+
+	// MaxCallDepth limits nested calls of functions defined as formulas.
+	MaxCallDepth = 32
+)
+
+type Function struct {
+	MinArgs int
+	MaxArgs int
+	Call    func(args []Value) (Value, error)
+	// Volatile functions, e.g. TODAY, may return a different
+	// result each time they are called with the same arguments.
+	Volatile bool
+
+	// params and body are set for functions defined as formulas
+	params []string
+	body   parser.Tree
+}
+
+// FormulaFunction returns a function which evaluates the body with its variables
+// bound to the arguments, e.g. MARGIN(cost, price) = (price - cost) / price.
+func FormulaFunction(params []string, body parser.Tree) Function {
+	lowercased := make([]string, 0, len(params))
+	for _, param := range params {
+		lowercased = append(lowercased, strings.ToLower(param))
+	}
+
+	return Function{
+		MinArgs: len(params),
+		MaxArgs: len(params),
+		params:  lowercased,
+		body:    body,
+	}
+}
+
+var (
+	functionsMu sync.RWMutex
+	functions   = make(map[string]Function)
+)
+
+// RegisterFunction makes the function callable from formulas.
+// Names are case-insensitive, registering a name again replaces the function.
+func RegisterFunction(name string, fn Function) {
+	functionsMu.Lock()
+	defer functionsMu.Unlock()
+
+	functions[strings.ToUpper(name)] = fn
+}
+
+// UnregisterFunction makes the function unknown to formulas.
+func UnregisterFunction(name string) {
+	functionsMu.Lock()
+	defer functionsMu.Unlock()
+
+	delete(functions, strings.ToUpper(name))
+}
+
+func IsFunction(name string) bool {
+	_, ok := lookupFunction(name)
+	return ok
+}
+
+// VolatileFunctions returns names of the volatile functions and of
+// the functions defined as formulas which (indirectly) call them.
+func VolatileFunctions() []string {
+	functionsMu.RLock()
+	defer functionsMu.RUnlock()
+
+	volatile := make(map[string]bool)
+	for name, fn := range functions {
+		if fn.Volatile {
+			volatile[name] = true
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for name, fn := range functions {
+			if volatile[name] || fn.body == nil {
+				continue
+			}
+
+			for _, called := range fn.body.Funcs() {
+				if volatile[strings.ToUpper(called)] {
+					volatile[name] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(volatile))
+	for name := range volatile {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupFunction(name string) (Function, bool) {
+	functionsMu.RLock()
+	defer functionsMu.RUnlock()
+
+	fn, ok := functions[strings.ToUpper(name)]
+	return fn, ok
+}
+
+func (e *evaluation) call(name string, args []Value, sheet string, f *frame) (Value, error) {
+	fn, ok := lookupFunction(name)
+	if !ok {
+		return Value{}, fmt.Errorf("%w: %s", ErrUnknownFunction, strings.ToUpper(name))
+	}
+
+	if len(args) < fn.MinArgs || (fn.MaxArgs != Variadic && len(args) > fn.MaxArgs) {
+		return Value{}, fmt.Errorf("%w: %s", ErrArgumentCount, strings.ToUpper(name))
+	}
+
+	if fn.body == nil {
+		return fn.Call(args)
+	}
+
+	depth := 1
+	if f != nil {
+		depth = f.depth + 1
+	}
+	if depth > MaxCallDepth {
+		return Value{}, fmt.Errorf("%w: %s", ErrRecursionLimit, strings.ToUpper(name))
+	}
+
+	bound := make(map[string]Value, len(args))
+	for i, param := range fn.params {
+		bound[param] = args[i]
+	}
+
+	return e.evaluate(fn.body, sheet, &frame{args: bound, depth: depth})
+}
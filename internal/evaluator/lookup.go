@@ -0,0 +1,441 @@
+package evaluator
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+func init() {
+	RegisterFunction("VLOOKUP", Function{MinArgs: 3, MaxArgs: 4, Call: vlookup})
+	RegisterFunction("HLOOKUP", Function{MinArgs: 3, MaxArgs: 4, Call: hlookup})
+	RegisterFunction("INDEX", Function{MinArgs: 2, MaxArgs: 3, Call: index})
+	RegisterFunction("MATCH", Function{MinArgs: 2, MaxArgs: 3, Call: match})
+	RegisterFunction("XLOOKUP", Function{MinArgs: 3, MaxArgs: 6, Call: xlookup})
+}
+
+var (
+	ErrNotAvailable     = &Error{Code: "#N/A", Message: "no value matches"}
+	ErrInvalidReference = &Error{Code: "#REF!", Message: "reference is out of the range"}
+)
+
+// matchMode tells which value of a lookup matches when no value equals the looked up one.
+type matchMode int
+
+const (
+	exactMatch matchMode = iota
+	// wildcardMatch is an exact match where * and ? of a text match any
+	// characters and any single character, ~ escapes them.
+	wildcardMatch
+	nextSmallerMatch
+	nextLargerMatch
+)
+
+// table returns rows of a range, a single value is a table of one cell.
+func table(v Value) [][]Value {
+	if v.IsArray() {
+		return v.Array
+	}
+	return [][]Value{{v}}
+}
+
+// vector returns values of a range which is a single row or column.
+func vector(v Value) ([]Value, bool) {
+	rows := table(v)
+	if len(rows) == 1 {
+		return rows[0], true
+	}
+
+	values := make([]Value, 0, len(rows))
+	for _, row := range rows {
+		if len(row) != 1 {
+			return nil, false
+		}
+		values = append(values, row[0])
+	}
+	return values, true
+}
+
+func column(rows [][]Value, col int) []Value {
+	values := make([]Value, 0, len(rows))
+	for _, row := range rows {
+		values = append(values, row[col])
+	}
+	return values
+}
+
+// compareValues orders numbers (and dates) and texts, texts case-insensitively.
+// Values of different kinds and empty cells are not comparable.
+func compareValues(a, b Value) (int, bool) {
+	switch {
+	case a.IsArray() || b.IsArray() || a.Empty || b.Empty || a.IsText != b.IsText:
+		return 0, false
+	case a.IsText:
+		return strings.Compare(strings.ToLower(a.Text), strings.ToLower(b.Text)), true
+	case a.Number < b.Number:
+		return -1, true
+	case a.Number > b.Number:
+		return 1, true
+	}
+	return 0, true
+}
+
+// matchesWildcard tells if the text matches the pattern case-insensitively,
+// where * matches any characters, ? any single character and ~ escapes them.
+func matchesWildcard(pattern, text string) bool {
+	p := []rune(strings.ToLower(pattern))
+	s := []rune(strings.ToLower(text))
+
+	// position of the last * and of the text it has matched up to
+	star, starText := -1, 0
+	i, j := 0, 0
+	for j < len(s) {
+		switch {
+		case i < len(p) && p[i] == '*':
+			star, starText = i, j
+			i++
+			continue
+		case i+1 < len(p) && p[i] == '~' && (p[i+1] == '*' || p[i+1] == '?' || p[i+1] == '~'):
+			if p[i+1] == s[j] {
+				i, j = i+2, j+1
+				continue
+			}
+		case i < len(p) && (p[i] == '?' || p[i] == s[j]):
+			i, j = i+1, j+1
+			continue
+		}
+
+		if star < 0 {
+			return false
+		}
+		starText++
+		i, j = star+1, starText
+	}
+
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
+
+// equalValues tells if the value matches the looked up one.
+func equalValues(x, v Value, mode matchMode) bool {
+	if mode == wildcardMatch && x.IsText && v.IsText {
+		return matchesWildcard(x.Text, v.Text)
+	}
+
+	order, ok := compareValues(x, v)
+	return ok && order == 0
+}
+
+// search returns the zero-based position of the first value matching x, or the last one
+// when searching in reverse. If no value is equal, the next smaller or larger
+// modes return the closest of the smaller or larger values.
+func search(x Value, values []Value, mode matchMode, reverse bool) (int, error) {
+	closest := -1
+	for k := range values {
+		i := k
+		if reverse {
+			i = len(values) - 1 - k
+		}
+
+		if equalValues(x, values[i], mode) {
+			return i, nil
+		}
+
+		order, ok := compareValues(values[i], x)
+		if !ok || mode == exactMatch || mode == wildcardMatch {
+			continue
+		}
+
+		if mode == nextSmallerMatch && order < 0 || mode == nextLargerMatch && order > 0 {
+			if closest < 0 {
+				closest = i
+				continue
+			}
+
+			closer, _ := compareValues(values[i], values[closest])
+			if mode == nextSmallerMatch && closer > 0 || mode == nextLargerMatch && closer < 0 {
+				closest = i
+			}
+		}
+	}
+
+	if closest < 0 {
+		return 0, ErrNotAvailable
+	}
+	return closest, nil
+}
+
+// searchSorted returns the zero-based position of the last value not greater than x
+// (not less than x if descending) in values sorted in that order, values of
+// other kinds are skipped.
+func searchSorted(x Value, values []Value, descending bool) (int, error) {
+	found := -1
+	for i, v := range values {
+		order, ok := compareValues(v, x)
+		if !ok {
+			continue
+		}
+
+		if descending && order < 0 || !descending && order > 0 {
+			break
+		}
+		found = i
+	}
+
+	if found < 0 {
+		return 0, ErrNotAvailable
+	}
+	return found, nil
+}
+
+// lookupValue returns the looked up value, which must be a single value.
+func lookupValue(v Value) (Value, error) {
+	if v.IsArray() {
+		return Value{}, ErrInvalidArgument
+	}
+	return v, nil
+}
+
+// positionArg converts a one-based position of a row or a column
+// which may be zero when allowZero is set.
+func positionArg(arg Value, allowZero bool) (int, error) {
+	number, err := arg.Float()
+	if err != nil {
+		return 0, err
+	}
+
+	number = math.Trunc(number)
+	if number < 0 || number == 0 && !allowZero || number > math.MaxInt32 {
+		return 0, ErrInvalidArgument
+	}
+	return int(number), nil
+}
+
+// approximate tells if the optional argument of VLOOKUP and HLOOKUP
+// asks for an approximate match in a sorted range, which is the default.
+func approximate(args []Value) (bool, error) {
+	if len(args) < 4 {
+		return true, nil
+	}
+
+	number, err := args[3].Float()
+	if err != nil {
+		return false, err
+	}
+	return number != 0, nil
+}
+
+// lookupIn finds the looked up value in the keys and returns its position.
+func lookupIn(x Value, keys []Value, sorted bool) (int, error) {
+	if sorted {
+		return searchSorted(x, keys, false)
+	}
+	return search(x, keys, wildcardMatch, false)
+}
+
+// vlookup looks the value up in the first column of the range and
+// returns the value of the column given by the one-based index.
+func vlookup(args []Value) (Value, error) {
+	x, err := lookupValue(args[0])
+	if err != nil {
+		return Value{}, err
+	}
+
+	rows := table(args[1])
+	col, err := positionArg(args[2], false)
+	if err != nil {
+		return Value{}, err
+	}
+	if col > len(rows[0]) {
+		return Value{}, ErrInvalidReference
+	}
+
+	sorted, err := approximate(args)
+	if err != nil {
+		return Value{}, err
+	}
+
+	row, err := lookupIn(x, column(rows, 0), sorted)
+	if err != nil {
+		return Value{}, err
+	}
+	return rows[row][col-1], nil
+}
+
+// hlookup is like vlookup but looks the value up in the first row.
+func hlookup(args []Value) (Value, error) {
+	x, err := lookupValue(args[0])
+	if err != nil {
+		return Value{}, err
+	}
+
+	rows := table(args[1])
+	row, err := positionArg(args[2], false)
+	if err != nil {
+		return Value{}, err
+	}
+	if row > len(rows) {
+		return Value{}, ErrInvalidReference
+	}
+
+	sorted, err := approximate(args)
+	if err != nil {
+		return Value{}, err
+	}
+
+	col, err := lookupIn(x, rows[0], sorted)
+	if err != nil {
+		return Value{}, err
+	}
+	return rows[row-1][col], nil
+}
+
+// index returns the value at the one-based row and column of the range. A single
+// position indexes a range of one row or column, or selects a row of a table.
+// Zero selects the whole row or column.
+func index(args []Value) (Value, error) {
+	rows := table(args[0])
+
+	row, err := positionArg(args[1], true)
+	if err != nil {
+		return Value{}, err
+	}
+
+	col := 0
+	switch {
+	case len(args) > 2:
+		if col, err = positionArg(args[2], true); err != nil {
+			return Value{}, err
+		}
+	case len(rows) == 1:
+		row, col = 1, row
+	case len(rows[0]) == 1:
+		col = 1
+	}
+
+	if row > len(rows) || col > len(rows[0]) {
+		return Value{}, ErrInvalidReference
+	}
+
+	switch {
+	case row == 0 && col == 0:
+		return Value{Array: rows}, nil
+	case row == 0:
+		values := make([][]Value, 0, len(rows))
+		for _, v := range column(rows, col-1) {
+			values = append(values, []Value{v})
+		}
+		return Value{Array: values}, nil
+	case col == 0:
+		return Value{Array: [][]Value{rows[row-1]}}, nil
+	}
+	return rows[row-1][col-1], nil
+}
+
+// match returns the one-based position of the value in a row or column. The optional
+// type 1 (default) finds the largest value not greater than it in an ascending
+// range, -1 the smallest not less than it in a descending one and 0 an equal value.
+func match(args []Value) (Value, error) {
+	x, err := lookupValue(args[0])
+	if err != nil {
+		return Value{}, err
+	}
+
+	values, ok := vector(args[1])
+	if !ok {
+		return Value{}, ErrNotAvailable
+	}
+
+	matchType := 1.0
+	if len(args) > 2 {
+		if matchType, err = args[2].Float(); err != nil {
+			return Value{}, err
+		}
+	}
+
+	var position int
+	switch {
+	case matchType > 0:
+		position, err = searchSorted(x, values, false)
+	case matchType < 0:
+		position, err = searchSorted(x, values, true)
+	default:
+		position, err = search(x, values, wildcardMatch, false)
+	}
+	if err != nil {
+		return Value{}, err
+	}
+
+	return NumberValue(float64(position + 1)), nil
+}
+
+// xlookup finds the value in a row or column and returns the value at the same
+// position of the return range, or its row or column if the return range is a table.
+// Optional arguments are the value returned when nothing matches, the match mode:
+// 0 exact (default), -1 exact or next smaller, 1 exact or next larger, 2 wildcards,
+// and the search mode: 1 from the first value (default), -1 from the last one.
+func xlookup(args []Value) (Value, error) {
+	x, err := lookupValue(args[0])
+	if err != nil {
+		return Value{}, err
+	}
+
+	keys, ok := vector(args[1])
+	if !ok {
+		return Value{}, ErrInvalidArgument
+	}
+
+	results := table(args[2])
+	vertical := len(keys) > 1 && len(table(args[1])) > 1
+	if vertical && len(results) != len(keys) || !vertical && len(results[0]) != len(keys) {
+		return Value{}, ErrInvalidArgument
+	}
+
+	mode := exactMatch
+	if len(args) > 4 {
+		number, err := args[4].Float()
+		if err != nil {
+			return Value{}, err
+		}
+
+		modes := map[float64]matchMode{0: exactMatch, -1: nextSmallerMatch, 1: nextLargerMatch, 2: wildcardMatch}
+		if mode, ok = modes[number]; !ok {
+			return Value{}, ErrInvalidArgument
+		}
+	}
+
+	reverse := false
+	if len(args) > 5 {
+		number, err := args[5].Float()
+		if err != nil {
+			return Value{}, err
+		}
+		reverse = number < 0
+	}
+
+	position, err := search(x, keys, mode, reverse)
+	switch {
+	case errors.Is(err, ErrNotAvailable) && len(args) > 3:
+		return args[3], nil
+	case err != nil:
+		return Value{}, err
+	}
+
+	if vertical {
+		if len(results[position]) == 1 {
+			return results[position][0], nil
+		}
+		return Value{Array: [][]Value{results[position]}}, nil
+	}
+
+	if len(results) == 1 {
+		return results[0][position], nil
+	}
+	values := make([][]Value, 0, len(results))
+	for _, v := range column(results, position) {
+		values = append(values, []Value{v})
+	}
+	return Value{Array: values}, nil
+}
@@ -0,0 +1,231 @@
+package evaluator
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterFunction("ROUND", Function{MinArgs: 1, MaxArgs: 2, Call: roundWith(math.Round)})
+	RegisterFunction("ROUNDUP", Function{MinArgs: 1, MaxArgs: 2, Call: roundWith(roundAwayFromZero)})
+	RegisterFunction("ROUNDDOWN", Function{MinArgs: 1, MaxArgs: 2, Call: roundWith(math.Trunc)})
+	RegisterFunction("ABS", Function{MinArgs: 1, MaxArgs: 1, Call: unary(math.Abs)})
+	RegisterFunction("SQRT", Function{MinArgs: 1, MaxArgs: 1, Call: unary(math.Sqrt)})
+	RegisterFunction("POWER", Function{MinArgs: 2, MaxArgs: 2, Call: power})
+	RegisterFunction("MOD", Function{MinArgs: 2, MaxArgs: 2, Call: mod})
+	RegisterFunction("FLOOR", Function{MinArgs: 1, MaxArgs: 2, Call: floor})
+	RegisterFunction("CEILING", Function{MinArgs: 1, MaxArgs: 2, Call: ceiling})
+	RegisterFunction("LN", Function{MinArgs: 1, MaxArgs: 1, Call: logarithm(math.Log)})
+	RegisterFunction("LOG10", Function{MinArgs: 1, MaxArgs: 1, Call: logarithm(math.Log10)})
+	RegisterFunction("EXP", Function{MinArgs: 1, MaxArgs: 1, Call: unary(math.Exp)})
+	RegisterFunction("PI", Function{MinArgs: 0, MaxArgs: 0, Call: pi})
+	RegisterFunction("RAND", Function{MinArgs: 0, MaxArgs: 0, Call: random, Volatile: true})
+	RegisterFunction("RANDBETWEEN", Function{MinArgs: 2, MaxArgs: 2, Call: randomBetween, Volatile: true})
+}
+
+var (
+	randomMu     sync.Mutex
+	randomSource = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// SeedRandom makes RAND and RANDBETWEEN return the same sequence
+// of numbers for the same seed, e.g. in tests.
+func SeedRandom(seed int64) {
+	randomMu.Lock()
+	defer randomMu.Unlock()
+
+	randomSource = rand.New(rand.NewSource(seed))
+}
+
+// floats converts arguments of a function accepting numbers only.
+func floats(args []Value) ([]float64, error) {
+	result := make([]float64, 0, len(args))
+	for _, arg := range args {
+		number, err := arg.Float()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, number)
+	}
+	return result, nil
+}
+
+// number returns the result unless it is not a finite number, e.g. SQRT(-1).
+func number(result float64) (Value, error) {
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return Value{}, ErrInvalidNumber
+	}
+	return NumberValue(result), nil
+}
+
+func unary(fn func(float64) float64) func(args []Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		x, err := args[0].Float()
+		if err != nil {
+			return Value{}, err
+		}
+		return number(fn(x))
+	}
+}
+
+// roundWith rounds to the number of digits given by the optional second
+// argument, which may be negative to round to tens, hundreds and so on.
+func roundWith(round func(float64) float64) func(args []Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		values, err := floats(args)
+		if err != nil {
+			return Value{}, err
+		}
+
+		digits := 0.0
+		if len(values) > 1 {
+			digits = values[1]
+		}
+
+		return number(roundTo(values[0], digits, round))
+	}
+}
+
+func roundTo(x, digits float64, round func(float64) float64) float64 {
+	scale := math.Pow(10, math.Trunc(digits))
+	return round(significant(x*scale)) / scale
+}
+
+// significant keeps 15 significant digits of the number like spreadsheets do,
+// so that ROUND(1.005, 2) is 1.01 although 1.005 is 1.00499... in binary.
+func significant(x float64) float64 {
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return x
+	}
+
+	result, _ := strconv.ParseFloat(strconv.FormatFloat(x, 'g', 15, 64), 64)
+	return result
+}
+
+func roundAwayFromZero(x float64) float64 {
+	if x < 0 {
+		return math.Floor(x)
+	}
+	return math.Ceil(x)
+}
+
+func power(args []Value) (Value, error) {
+	values, err := floats(args)
+	if err != nil {
+		return Value{}, err
+	}
+
+	if values[0] == 0 && values[1] < 0 {
+		return Value{}, ErrDivisionByZero
+	}
+
+	return number(math.Pow(values[0], values[1]))
+}
+
+// mod returns the remainder with the sign of the divisor, MOD(-3, 2) is 1.
+func mod(args []Value) (Value, error) {
+	values, err := floats(args)
+	if err != nil {
+		return Value{}, err
+	}
+
+	if values[1] == 0 {
+		return Value{}, ErrDivisionByZero
+	}
+
+	return number(values[0] - values[1]*math.Floor(values[0]/values[1]))
+}
+
+// significance returns the multiple FLOOR and CEILING round to,
+// a positive number cannot be rounded to a negative multiple.
+func significance(values []float64) (float64, error) {
+	multiple := 1.0
+	if len(values) > 1 {
+		multiple = values[1]
+	}
+
+	if values[0] > 0 && multiple < 0 {
+		return 0, ErrInvalidNumber
+	}
+	return multiple, nil
+}
+
+func floor(args []Value) (Value, error) {
+	values, err := floats(args)
+	if err != nil {
+		return Value{}, err
+	}
+
+	multiple, err := significance(values)
+	if err != nil {
+		return Value{}, err
+	}
+	if multiple == 0 {
+		return Value{}, ErrDivisionByZero
+	}
+
+	return number(math.Floor(values[0]/multiple) * multiple)
+}
+
+func ceiling(args []Value) (Value, error) {
+	values, err := floats(args)
+	if err != nil {
+		return Value{}, err
+	}
+
+	multiple, err := significance(values)
+	if err != nil {
+		return Value{}, err
+	}
+	if multiple == 0 {
+		return NumberValue(0), nil
+	}
+
+	return number(math.Ceil(values[0]/multiple) * multiple)
+}
+
+func logarithm(fn func(float64) float64) func(args []Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		x, err := args[0].Float()
+		if err != nil {
+			return Value{}, err
+		}
+
+		if x <= 0 {
+			return Value{}, ErrInvalidNumber
+		}
+		return number(fn(x))
+	}
+}
+
+func pi(args []Value) (Value, error) {
+	return NumberValue(math.Pi), nil
+}
+
+func random(args []Value) (Value, error) {
+	randomMu.Lock()
+	defer randomMu.Unlock()
+
+	return NumberValue(randomSource.Float64()), nil
+}
+
+// randomBetween returns an integer between the bounds, both inclusive.
+func randomBetween(args []Value) (Value, error) {
+	values, err := floats(args)
+	if err != nil {
+		return Value{}, err
+	}
+
+	bottom, top := math.Ceil(values[0]), math.Floor(values[1])
+	if bottom > top {
+		return Value{}, ErrInvalidNumber
+	}
+
+	randomMu.Lock()
+	defer randomMu.Unlock()
+
+	return NumberValue(bottom + math.Floor(randomSource.Float64()*(top-bottom+1))), nil
+}
@@ -0,0 +1,372 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+func init() {
+	RegisterFunction("LEN", Function{MinArgs: 1, MaxArgs: 1, Call: length})
+	RegisterFunction("UPPER", Function{MinArgs: 1, MaxArgs: 1, Call: mapText(strings.ToUpper)})
+	RegisterFunction("LOWER", Function{MinArgs: 1, MaxArgs: 1, Call: mapText(strings.ToLower)})
+	RegisterFunction("TRIM", Function{MinArgs: 1, MaxArgs: 1, Call: mapText(trim)})
+	RegisterFunction("LEFT", Function{MinArgs: 1, MaxArgs: 2, Call: left})
+	RegisterFunction("RIGHT", Function{MinArgs: 1, MaxArgs: 2, Call: right})
+	RegisterFunction("MID", Function{MinArgs: 3, MaxArgs: 3, Call: mid})
+	RegisterFunction("CONCAT", Function{MinArgs: 1, MaxArgs: Variadic, Call: concat})
+	RegisterFunction("SUBSTITUTE", Function{MinArgs: 3, MaxArgs: 4, Call: substitute})
+	RegisterFunction("FIND", Function{MinArgs: 2, MaxArgs: 3, Call: find})
+	RegisterFunction("TEXT", Function{MinArgs: 2, MaxArgs: 2, Call: text})
+	RegisterFunction("VALUE", Function{MinArgs: 1, MaxArgs: 1, Call: value})
+}
+
+// AsText returns the text of the value, numbers are written with at most
+// 15 significant digits, dates in the DateLayout or DateTimeLayout format
+// and an empty cell is an empty text.
+func (v Value) AsText() (string, error) {
+	switch {
+	case v.IsArray():
+		return "", ErrInvalidArgument
+	case v.IsText:
+		return v.Text, nil
+	case v.Empty:
+		return "", nil
+	case v.IsDate:
+		t, err := v.Time()
+		if err != nil {
+			return "", err
+		}
+		return formatTime(t), nil
+	}
+
+	return strconv.FormatFloat(significant(v.Number), 'f', -1, 64), nil
+}
+
+// position converts an argument which is a number of characters or a position.
+func position(arg Value) (int, error) {
+	number, err := arg.Float()
+	if err != nil {
+		return 0, err
+	}
+
+	if number < 0 || number > math.MaxInt32 {
+		return 0, ErrInvalidArgument
+	}
+	return int(number), nil
+}
+
+// length counts characters rather than bytes, LEN("héllo") is 5.
+func length(args []Value) (Value, error) {
+	s, err := args[0].AsText()
+	if err != nil {
+		return Value{}, err
+	}
+
+	return NumberValue(float64(utf8.RuneCountInString(s))), nil
+}
+
+func mapText(fn func(string) string) func(args []Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		s, err := args[0].AsText()
+		if err != nil {
+			return Value{}, err
+		}
+
+		return TextValue(fn(s)), nil
+	}
+}
+
+// trim removes leading and trailing spaces and collapses the ones between words.
+func trim(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// substring returns the characters of s starting at the zero-based
+// character offset, it is empty or shorter if s is shorter.
+func substring(s []rune, offset, n int) string {
+	if offset > len(s) {
+		return ""
+	}
+	if n > len(s)-offset {
+		n = len(s) - offset
+	}
+	return string(s[offset : offset+n])
+}
+
+// leading returns the text and the optional number of characters, 1 by default.
+func leading(args []Value) ([]rune, int, error) {
+	s, err := args[0].AsText()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	n := 1
+	if len(args) > 1 {
+		if n, err = position(args[1]); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return []rune(s), n, nil
+}
+
+func left(args []Value) (Value, error) {
+	s, n, err := leading(args)
+	if err != nil {
+		return Value{}, err
+	}
+
+	return TextValue(substring(s, 0, n)), nil
+}
+
+func right(args []Value) (Value, error) {
+	s, n, err := leading(args)
+	if err != nil {
+		return Value{}, err
+	}
+
+	if n > len(s) {
+		n = len(s)
+	}
+	return TextValue(substring(s, len(s)-n, n)), nil
+}
+
+// mid returns n characters starting at the one-based position.
+func mid(args []Value) (Value, error) {
+	s, err := args[0].AsText()
+	if err != nil {
+		return Value{}, err
+	}
+
+	start, err := position(args[1])
+	if err != nil {
+		return Value{}, err
+	}
+	if start < 1 {
+		return Value{}, ErrInvalidArgument
+	}
+
+	n, err := position(args[2])
+	if err != nil {
+		return Value{}, err
+	}
+
+	return TextValue(substring([]rune(s), start-1, n)), nil
+}
+
+// concat joins the arguments, ranges are joined row by row.
+func concat(args []Value) (Value, error) {
+	var b strings.Builder
+	for _, arg := range args {
+		values := []Value{arg}
+		if arg.IsArray() {
+			values = values[:0]
+			for _, row := range arg.Array {
+				values = append(values, row...)
+			}
+		}
+
+		for _, v := range values {
+			s, err := v.AsText()
+			if err != nil {
+				return Value{}, err
+			}
+			b.WriteString(s)
+		}
+	}
+
+	return TextValue(b.String()), nil
+}
+
+// substitute replaces every occurrence of a text, or only the one
+// given by the optional one-based instance number.
+func substitute(args []Value) (Value, error) {
+	texts := make([]string, 3)
+	for i := range texts {
+		s, err := args[i].AsText()
+		if err != nil {
+			return Value{}, err
+		}
+		texts[i] = s
+	}
+	s, old, replacement := texts[0], texts[1], texts[2]
+
+	if len(args) < 4 {
+		if old == "" {
+			return TextValue(s), nil
+		}
+		return TextValue(strings.ReplaceAll(s, old, replacement)), nil
+	}
+
+	instance, err := position(args[3])
+	if err != nil {
+		return Value{}, err
+	}
+	if instance < 1 {
+		return Value{}, ErrInvalidArgument
+	}
+	if old == "" {
+		return TextValue(s), nil
+	}
+
+	offset := 0
+	for i := 1; ; i++ {
+		index := strings.Index(s[offset:], old)
+		if index < 0 {
+			return TextValue(s), nil
+		}
+		if i == instance {
+			offset += index
+			return TextValue(s[:offset] + replacement + s[offset+len(old):]), nil
+		}
+		offset += index + len(old)
+	}
+}
+
+// find returns the one-based character position of a text, case-sensitively,
+// searching from the optional start position.
+func find(args []Value) (Value, error) {
+	needle, err := args[0].AsText()
+	if err != nil {
+		return Value{}, err
+	}
+
+	s, err := args[1].AsText()
+	if err != nil {
+		return Value{}, err
+	}
+
+	start := 1
+	if len(args) > 2 {
+		if start, err = position(args[2]); err != nil {
+			return Value{}, err
+		}
+	}
+
+	runes := []rune(s)
+	if start < 1 || start > len(runes)+1 {
+		return Value{}, ErrInvalidArgument
+	}
+
+	skipped := len(string(runes[:start-1]))
+	index := strings.Index(s[skipped:], needle)
+	if index < 0 {
+		return Value{}, fmt.Errorf("%w: %q not found", ErrInvalidArgument, needle)
+	}
+
+	return NumberValue(float64(start + utf8.RuneCountInString(s[skipped:skipped+index]))), nil
+}
+
+// text formats a number with a pattern of spreadsheet number formats:
+// 0 is a digit, # is a digit shown only if significant, "," groups thousands
+// and % shows the number as a percentage, e.g. TEXT(1234.5, "$#,##0.00").
+func text(args []Value) (Value, error) {
+	x, err := args[0].Float()
+	if err != nil {
+		return Value{}, err
+	}
+
+	format, err := args[1].AsText()
+	if err != nil {
+		return Value{}, err
+	}
+
+	return TextValue(formatNumber(x, format)), nil
+}
+
+func formatNumber(x float64, format string) string {
+	start := strings.IndexAny(format, "0#")
+	if start < 0 {
+		return format
+	}
+
+	end := start
+	for end < len(format) && strings.IndexByte("0#.,", format[end]) >= 0 {
+		end++
+	}
+	prefix, pattern, suffix := format[:start], format[start:end], format[end:]
+
+	if strings.Contains(prefix+suffix, "%") {
+		x *= 100
+	}
+
+	integerPattern, fractionPattern, _ := strings.Cut(pattern, ".")
+	required := strings.Count(fractionPattern, "0")
+	decimals := required + strings.Count(fractionPattern, "#")
+
+	x = roundTo(x, float64(decimals), math.Round)
+	sign := ""
+	if x < 0 {
+		sign = "-"
+		x = -x
+	}
+
+	integer, fraction, _ := strings.Cut(strconv.FormatFloat(x, 'f', decimals, 64), ".")
+	for len(fraction) > required && strings.HasSuffix(fraction, "0") {
+		fraction = fraction[:len(fraction)-1]
+	}
+
+	minDigits := strings.Count(integerPattern, "0")
+	if integer == "0" && minDigits == 0 {
+		integer = ""
+	}
+	for len(integer) < minDigits {
+		integer = "0" + integer
+	}
+
+	if strings.Contains(integerPattern, ",") {
+		integer = groupThousands(integer)
+	}
+
+	result := integer
+	if fraction != "" {
+		result += "." + fraction
+	}
+	return sign + prefix + result + suffix
+}
+
+func groupThousands(digits string) string {
+	var b strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	return b.String()
+}
+
+var decimalPattern = regexp.MustCompile(`^[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][+-]?[0-9]+)?$`)
+
+// value converts a text into a number, accepting thousands
+// separators and percentages, VALUE("1,250.5") is 1250.5.
+func value(args []Value) (Value, error) {
+	if !args[0].IsText {
+		x, err := args[0].Float()
+		if err != nil {
+			return Value{}, err
+		}
+		return NumberValue(x), nil
+	}
+
+	s := strings.ReplaceAll(strings.TrimSpace(args[0].Text), ",", "")
+	scale := 1.0
+	if trimmed, ok := strings.CutSuffix(s, "%"); ok {
+		s, scale = trimmed, 0.01
+	}
+
+	// ParseFloat also accepts "NaN", "Inf" and hexadecimal numbers
+	if !decimalPattern.MatchString(s) {
+		return Value{}, ErrNotANumber
+	}
+
+	x, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return Value{}, ErrNotANumber
+	}
+	return number(x * scale)
+}
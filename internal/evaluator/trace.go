@@ -0,0 +1,123 @@
+package evaluator
+
+import (
+	"dev-challenge/internal/parser"
+	"strings"
+)
+
+const (
+	// MaxTraceSteps limits the number of steps Explain records.
+	MaxTraceSteps = 1000
+
+	// maxTracedValues limits the number of an array's values a step shows.
+	maxTracedValues = 20
+)
+
+// Step is an intermediate result of an evaluation: a referenced cell or name,
+// a range, a function call or an operation with the values of its operands.
+// Depth tells how deeply the step is nested in formulas of referenced cells
+// and user-defined functions, the evaluated formula itself is at depth 0.
+type Step struct {
+	Depth      int    `json:"depth"`
+	Expression string `json:"expression"`
+	Value      string `json:"value,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Trace lists the steps of an evaluation in the order they are completed,
+// so the operands of an expression precede the expression itself.
+type Trace struct {
+	Steps []Step `json:"steps"`
+	// Truncated tells that the evaluation took more than MaxTraceSteps steps.
+	Truncated bool `json:"truncated"`
+}
+
+// Explain is like EvaluateValue but records the steps of the evaluation as well.
+// The trace is returned even if the evaluation fails, its last steps lead to the error.
+func Explain(tree parser.Tree, resolver Resolver) (Value, Trace, error) {
+	e := evaluation{
+		resolver: resolver,
+		visiting: make(map[string]bool),
+		trace:    &Trace{Steps: make([]Step, 0)},
+	}
+
+	result, err := e.evaluate(tree, "", nil)
+	return result, *e.trace, err
+}
+
+// record adds a step to the trace of the evaluation if there is one.
+func (e *evaluation) record(expression func() string, value Value, err error) {
+	if e.trace == nil {
+		return
+	}
+	if len(e.trace.Steps) >= MaxTraceSteps {
+		e.trace.Truncated = true
+		return
+	}
+
+	step := Step{Depth: e.depth, Expression: expression()}
+	if err != nil {
+		step.Error = err.Error()
+	} else {
+		step.Value = describe(value)
+	}
+	e.trace.Steps = append(e.trace.Steps, step)
+}
+
+var operators = map[string]string{
+	parser.KindOpPlus:     string(parser.OpPlus),
+	parser.KindOpMinus:    string(parser.OpMinus),
+	parser.KindOpMultiply: string(parser.OpMultiply),
+	parser.KindOpDivide:   string(parser.OpDivide),
+}
+
+func describeOperation(kind string, left, right Value) string {
+	return describe(left) + " " + operators[kind] + " " + describe(right)
+}
+
+func describeCall(name string, args []Value) string {
+	described := make([]string, 0, len(args))
+	for _, arg := range args {
+		described = append(described, describe(arg))
+	}
+	return strings.ToUpper(name) + "(" + strings.Join(described, ", ") + ")"
+}
+
+// describe formats a value the way formulas write it: texts are quoted and arrays
+// list their rows separated by semicolons, e.g. {1, 2; 3, 4}.
+func describe(v Value) string {
+	switch {
+	case v.IsArray():
+		var b strings.Builder
+		b.WriteString("{")
+		shown := 0
+		for i, row := range v.Array {
+			for j, value := range row {
+				switch {
+				case j > 0:
+					b.WriteString(", ")
+				case i > 0:
+					b.WriteString("; ")
+				}
+				if shown == maxTracedValues {
+					b.WriteString("...}")
+					return b.String()
+				}
+				b.WriteString(describe(value))
+				shown++
+			}
+		}
+		b.WriteString("}")
+		return b.String()
+	case v.Empty:
+		return `""`
+	case v.IsText:
+		return `"` + v.Text + `"`
+	}
+
+	text, err := v.AsText()
+	if err != nil {
+		return err.Error()
+	}
+	return text
+}
@@ -0,0 +1,110 @@
+package events
+
+import "sync"
+
+const (
+	TypeCellCreated        = "cell_created"
+	TypeCellUpdated        = "cell_updated"
+	TypeCellDeleted        = "cell_deleted"
+	TypeResultRecalculated = "result_recalculated"
+	TypeSheetReplaced      = "sheet_replaced"
+)
+
+// subscriberBuffer is a number of events which may be queued for
+// a single subscriber before new events start to be dropped for it.
+const subscriberBuffer = 64
+
+type Event struct {
+	Type    string `json:"type"`
+	SheetID string `json:"sheet_id"`
+	CellID  string `json:"cell_id"`
+	Value   string `json:"value"`
+	Result  string `json:"result"`
+	Version int    `json:"version"`
+}
+
+// Bus is an in-process publish/subscribe hub which delivers
+// cell events to everyone subscribed to the event's sheet.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan Event]struct{}
+	// everything receives events of all sheets
+	everything map[chan Event]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[string]map[chan Event]struct{}),
+		everything:  make(map[chan Event]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving events of the given sheet
+// and a function which must be called to release the subscription.
+func (b *Bus) Subscribe(sheetID string) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	if _, ok := b.subscribers[sheetID]; !ok {
+		b.subscribers[sheetID] = make(map[chan Event]struct{})
+	}
+	b.subscribers[sheetID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers[sheetID], ch)
+			if len(b.subscribers[sheetID]) == 0 {
+				delete(b.subscribers, sheetID)
+			}
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+// SubscribeAll is like Subscribe but receives events of every sheet.
+func (b *Bus) SubscribeAll() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	b.everything[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.everything, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+// Publish never blocks: a subscriber which does not keep up
+// with the stream misses the events that do not fit its buffer.
+func (b *Bus) Publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch := range b.subscribers[e.SheetID] {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+
+	for ch := range b.everything {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
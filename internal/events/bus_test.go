@@ -0,0 +1,71 @@
+package events_test
+
+import (
+	"dev-challenge/internal/events"
+	"testing"
+)
+
+func TestBus_Publish(t *testing.T) {
+	bus := events.NewBus()
+
+	sheetEvents, unsubscribe := bus.Subscribe("sheet_1")
+	otherEvents, unsubscribeOther := bus.Subscribe("sheet_2")
+	defer unsubscribeOther()
+
+	want := events.Event{
+		Type:    events.TypeCellCreated,
+		SheetID: "sheet_1",
+		CellID:  "a1",
+		Value:   "1+1",
+		Result:  "2",
+	}
+	bus.Publish(want)
+
+	select {
+	case got := <-sheetEvents:
+		if got != want {
+			t.Fatalf("want (%v) got (%v)", want, got)
+		}
+	default:
+		t.Fatalf("expected an event to be delivered")
+	}
+
+	select {
+	case got := <-otherEvents:
+		t.Fatalf("expected no events for another sheet, got (%v)", got)
+	default:
+	}
+
+	unsubscribe()
+	if _, ok := <-sheetEvents; ok {
+		t.Fatalf("expected channel to be closed after unsubscribe")
+	}
+
+	// must not panic on a released subscription
+	bus.Publish(want)
+	unsubscribe()
+}
+
+func TestBus_SubscribeAll(t *testing.T) {
+	bus := events.NewBus()
+
+	allEvents, unsubscribe := bus.SubscribeAll()
+
+	for _, sheetID := range []string{"sheet_1", "sheet_2"} {
+		bus.Publish(events.Event{Type: events.TypeCellUpdated, SheetID: sheetID, CellID: "a1"})
+
+		select {
+		case got := <-allEvents:
+			if got.SheetID != sheetID {
+				t.Fatalf("want (%v) got (%v)", sheetID, got.SheetID)
+			}
+		default:
+			t.Fatalf("expected an event of %s to be delivered", sheetID)
+		}
+	}
+
+	unsubscribe()
+	if _, ok := <-allEvents; ok {
+		t.Fatalf("expected channel to be closed after unsubscribe")
+	}
+}
@@ -0,0 +1,236 @@
+package external
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"dev-challenge/internal/evaluator"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FunctionName is the name of the formula function resolving remote cells.
+const FunctionName = "EXTERNAL_REF"
+
+var (
+	ErrInvalidURL          = errors.New("invalid external reference url")
+	ErrInvalidSubscription = errors.New("invalid subscription")
+	ErrRemoteResponse      = errors.New("unexpected response of a remote server")
+)
+
+// Subscription is sent to a remote server to be notified about changes of
+// the cell at URL, and is what the server keeps for its subscribers. The
+// secret is generated by the subscriber to verify signed notifications.
+type Subscription struct {
+	URL        string `json:"url"`
+	WebhookURL string `json:"webhook_url"`
+	Secret     string `json:"secret"`
+}
+
+// Notification is posted to a subscriber's webhook when a remote cell changes.
+type Notification struct {
+	URL    string `json:"url"`
+	Value  string `json:"value"`
+	Result string `json:"result"`
+}
+
+type entry struct {
+	result    string
+	fetchedAt time.Time
+}
+
+// subscribed is a subscription of the client to a remote cell.
+type subscribed struct {
+	secret    string
+	expiresAt time.Time
+}
+
+// Client fetches results of cells served by other instances of the service
+// and caches them for the TTL. If a webhook URL is given, the client subscribes
+// to every fetched cell so that remote changes invalidate the cache early.
+// Addresses of private networks are refused unless allowPrivate is set.
+type Client struct {
+	httpClient *http.Client
+	ttl        time.Duration
+	webhookURL string
+
+	mu            sync.Mutex
+	cache         map[string]entry
+	subscriptions map[string]subscribed
+	sweptAt       time.Time
+	now           func() time.Time
+}
+
+func NewClient(timeout, ttl time.Duration, webhookURL string, allowPrivate bool) *Client {
+	return &Client{
+		httpClient:    newHTTPClient(timeout, allowPrivate),
+		ttl:           ttl,
+		webhookURL:    webhookURL,
+		cache:         make(map[string]entry),
+		subscriptions: make(map[string]subscribed),
+		now:           time.Now,
+	}
+}
+
+// Function returns EXTERNAL_REF("http://host/api/v1/sheet/cell")
+// resolving to the remote cell's result.
+func (c *Client) Function() evaluator.Function {
+	return evaluator.Function{
+		MinArgs: 1,
+		MaxArgs: 1,
+		Call: func(args []evaluator.Value) (evaluator.Value, error) {
+			if !args[0].IsText {
+				return evaluator.Value{}, fmt.Errorf("%w: %s expects an url", evaluator.ErrInvalidArgument, FunctionName)
+			}
+
+			result, err := c.Fetch(args[0].Text)
+			if err != nil {
+				return evaluator.Value{}, err
+			}
+
+			number, err := strconv.ParseFloat(result, 64)
+			if err != nil {
+				return evaluator.Value{}, fmt.Errorf("%w: %s", evaluator.ErrNotANumber, result)
+			}
+			return evaluator.NumberValue(number), nil
+		},
+	}
+}
+
+// Fetch returns the result of the remote cell, from the cache if it is fresh.
+func (c *Client) Fetch(url string) (string, error) {
+	c.mu.Lock()
+	cached, ok := c.cache[url]
+	c.mu.Unlock()
+
+	if ok && c.now().Sub(cached.fetchedAt) < c.ttl {
+		return cached.result, nil
+	}
+
+	if !isHTTPURL(url) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidURL, url)
+	}
+
+	response, err := c.httpClient.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: %s responded with %d", ErrRemoteResponse, url, response.StatusCode)
+	}
+
+	remote := Notification{}
+	if err := json.NewDecoder(response.Body).Decode(&remote); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrRemoteResponse, err)
+	}
+
+	c.mu.Lock()
+	c.sweep()
+	c.cache[url] = entry{result: remote.Result, fetchedAt: c.now()}
+	c.mu.Unlock()
+
+	if c.webhookURL != "" {
+		// the value stays correct for the TTL even if the subscription fails
+		if err := c.subscribe(url); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return remote.Result, nil
+}
+
+// Invalidate drops the cached result, so that the next use fetches it again.
+func (c *Client) Invalidate(url string) {
+	c.mu.Lock()
+	delete(c.cache, url)
+	c.mu.Unlock()
+}
+
+// Verify tells if the notification body about a change of the remote cell at
+// the url has been signed with the secret of an active subscription to it.
+func (c *Client) Verify(url string, body []byte, signature string) bool {
+	if !isHTTPURL(url) {
+		return false
+	}
+
+	c.mu.Lock()
+	s, ok := c.subscriptions[url]
+	c.mu.Unlock()
+
+	if !ok || !c.now().Before(s.expiresAt) {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(sign(s.secret, body)))
+}
+
+// sweep evicts expired results and subscriptions at most once per TTL, so that urls
+// which are no longer referenced do not stay in memory. The caller must hold the lock.
+func (c *Client) sweep() {
+	now := c.now()
+	if now.Sub(c.sweptAt) < c.ttl {
+		return
+	}
+	c.sweptAt = now
+
+	for url, cached := range c.cache {
+		if now.Sub(cached.fetchedAt) >= c.ttl {
+			delete(c.cache, url)
+		}
+	}
+	for url, s := range c.subscriptions {
+		if !now.Before(s.expiresAt) {
+			delete(c.subscriptions, url)
+		}
+	}
+}
+
+// subscribe asks the remote server to post to the webhook when the cell changes.
+// Servers keep subscriptions in memory only, therefore the client subscribes
+// on every fetch and the server ignores repeated subscriptions, which
+// keep the secret of the active subscription.
+func (c *Client) subscribe(url string) error {
+	c.mu.Lock()
+	s, ok := c.subscriptions[url]
+	if !ok || !c.now().Before(s.expiresAt) {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			c.mu.Unlock()
+			return err
+		}
+		s.secret = hex.EncodeToString(secret)
+	}
+	// notifications may arrive before the response
+	s.expiresAt = c.now().Add(SubscriptionTTL)
+	c.subscriptions[url] = s
+	c.mu.Unlock()
+
+	body, err := json.Marshal(Subscription{
+		URL:        url,
+		WebhookURL: c.webhookURL,
+		Secret:     s.secret,
+	})
+	if err != nil {
+		return err
+	}
+
+	response, err := c.httpClient.Post(url+"/subscribe", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: subscription to %s responded with %d", ErrRemoteResponse, url, response.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package external
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+var ErrForbiddenAddress = errors.New("address of a private network")
+
+// newHTTPClient returns a client which, unless allowPrivate is set, refuses to connect
+// to loopback, private and link-local addresses. The address is checked once it has been
+// resolved, so that neither a host name nor a redirect can point a request to them.
+func newHTTPClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		dialer := &net.Dialer{
+			Timeout: timeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || isPrivate(ip) {
+					return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+				}
+				return nil
+			},
+		}
+		transport.DialContext = dialer.DialContext
+		// a proxy would connect to the address instead of the dialer
+		transport.Proxy = nil
+	}
+
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
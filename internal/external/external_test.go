@@ -0,0 +1,235 @@
+package external_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"dev-challenge/internal/evaluator"
+	"dev-challenge/internal/events"
+	"dev-challenge/internal/external"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func signature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestClient_Fetch(t *testing.T) {
+	mu := sync.Mutex{}
+	requests := 0
+	result := "42"
+	subscriptions := make(chan external.Subscription, 1)
+
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/sheet/cell":
+			mu.Lock()
+			requests++
+			json.NewEncoder(w).Encode(map[string]string{"value": result, "result": result})
+			mu.Unlock()
+		case "/api/v1/sheet/cell/subscribe":
+			subscription := external.Subscription{}
+			json.NewDecoder(r.Body).Decode(&subscription)
+			subscriptions <- subscription
+			json.NewEncoder(w).Encode(&subscription)
+		case "/api/v1/sheet/slow":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer remote.Close()
+
+	url := remote.URL + "/api/v1/sheet/cell"
+	client := external.NewClient(100*time.Millisecond, time.Minute, "http://local/api/v1/external/webhook", true)
+
+	got, err := client.Fetch(url)
+	if err != nil || got != "42" {
+		t.Fatalf("want (42, <nil>) got (%v, %v)", got, err)
+	}
+
+	secret := ""
+	select {
+	case subscription := <-subscriptions:
+		if subscription.URL != url || subscription.WebhookURL != "http://local/api/v1/external/webhook" || subscription.Secret == "" {
+			t.Fatalf("unexpected subscription (%v)", subscription)
+		}
+		secret = subscription.Secret
+	default:
+		t.Fatalf("expected the client to subscribe to the remote cell")
+	}
+
+	// notifications are accepted only if they are signed with the secret
+	notification := []byte(`{"url": "` + url + `"}`)
+	if !client.Verify(url, notification, signature(secret, notification)) {
+		t.Fatalf("expected a notification signed with the secret to be verified")
+	}
+	if client.Verify(url, notification, signature("forged", notification)) {
+		t.Fatalf("expected a notification signed with another secret not to be verified")
+	}
+	if client.Verify(remote.URL+"/api/v1/sheet/other", notification, signature(secret, notification)) {
+		t.Fatalf("expected a notification about a cell without a subscription not to be verified")
+	}
+
+	mu.Lock()
+	result = "43"
+	mu.Unlock()
+
+	// the cached result is used until it is invalidated
+	got, _ = client.Fetch(url)
+	mu.Lock()
+	fetched := requests
+	mu.Unlock()
+	if got != "42" || fetched != 1 {
+		t.Fatalf("want cached (42) after %d requests got (%v)", fetched, got)
+	}
+
+	client.Invalidate(url)
+	if got, _ := client.Fetch(url); got != "43" {
+		t.Fatalf("want (43) got (%v)", got)
+	}
+
+	if _, err := client.Fetch(remote.URL + "/api/v1/sheet/missing"); !errors.Is(err, external.ErrRemoteResponse) {
+		t.Fatalf("want (%v) got (%v)", external.ErrRemoteResponse, err)
+	}
+
+	if _, err := client.Fetch(remote.URL + "/api/v1/sheet/slow"); err == nil {
+		t.Fatalf("expected the request to time out")
+	}
+
+	if _, err := client.Fetch("file:///etc/passwd"); !errors.Is(err, external.ErrInvalidURL) {
+		t.Fatalf("want (%v) got (%v)", external.ErrInvalidURL, err)
+	}
+}
+
+func TestClient_Fetch_PrivateAddress(t *testing.T) {
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"value": "1", "result": "1"})
+	}))
+	defer remote.Close()
+
+	client := external.NewClient(time.Second, time.Minute, "", false)
+
+	// the test server listens on a loopback address
+	for _, url := range []string{
+		remote.URL + "/api/v1/sheet/cell",
+		strings.Replace(remote.URL, "127.0.0.1", "localhost", 1) + "/api/v1/sheet/cell",
+	} {
+		if _, err := client.Fetch(url); !errors.Is(err, external.ErrForbiddenAddress) {
+			t.Fatalf("want (%v) got (%v)", external.ErrForbiddenAddress, err)
+		}
+	}
+}
+
+func TestClient_Function(t *testing.T) {
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"value": "=1/2", "result": "0.5"})
+	}))
+	defer remote.Close()
+
+	fn := external.NewClient(time.Second, time.Minute, "", true).Function()
+
+	got, err := fn.Call([]evaluator.Value{evaluator.TextValue(remote.URL + "/api/v1/sheet/cell")})
+	if err != nil || got.Number != 0.5 {
+		t.Fatalf("want (0.5, <nil>) got (%v, %v)", got.Number, err)
+	}
+
+	if _, err := fn.Call([]evaluator.Value{evaluator.NumberValue(1)}); !errors.Is(err, evaluator.ErrInvalidArgument) {
+		t.Fatalf("want (%v) got (%v)", evaluator.ErrInvalidArgument, err)
+	}
+}
+
+func TestNotifier_Listen(t *testing.T) {
+	notifications := make(chan external.Notification, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		notification := external.Notification{}
+		// a notification which is not signed is dropped
+		if r.Header.Get(external.SignatureHeader) == signature("secret", body) && json.Unmarshal(body, &notification) == nil {
+			notifications <- notification
+		}
+	}))
+	defer webhook.Close()
+
+	bus := events.NewBus()
+	notifier := external.NewNotifier(time.Second, time.Hour, true)
+
+	if err := notifier.Subscribe("sheet", "cell", external.Subscription{URL: "ref", WebhookURL: "not an url"}); !errors.Is(err, external.ErrInvalidURL) {
+		t.Fatalf("want (%v) got (%v)", external.ErrInvalidURL, err)
+	}
+
+	if err := notifier.Subscribe("sheet", "cell", external.Subscription{URL: "ref", WebhookURL: webhook.URL}); !errors.Is(err, external.ErrInvalidSubscription) {
+		t.Fatalf("want (%v) got (%v)", external.ErrInvalidSubscription, err)
+	}
+
+	err := notifier.Subscribe("sheet", "cell", external.Subscription{URL: "http://remote/api/v1/sheet/cell", WebhookURL: webhook.URL, Secret: "secret"})
+	if err != nil {
+		t.Fatalf("want (<nil>) got (%v)", err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go notifier.Listen(bus, stop)
+
+	// the listener subscribes to the bus asynchronously
+	deadline := time.After(time.Second)
+	for {
+		bus.Publish(events.Event{Type: events.TypeCellUpdated, SheetID: "sheet", CellID: "other", Result: "1"})
+		bus.Publish(events.Event{Type: events.TypeCellUpdated, SheetID: "sheet", CellID: "cell", Result: "2"})
+
+		select {
+		case notification := <-notifications:
+			if notification.URL != "http://remote/api/v1/sheet/cell" || notification.Result != "2" {
+				t.Fatalf("unexpected notification (%v)", notification)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("expected a notification to be delivered")
+		}
+	}
+}
+
+func TestNotifier_Listen_Expired(t *testing.T) {
+	notifications := make(chan external.Notification, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notifications <- external.Notification{}
+	}))
+	defer webhook.Close()
+
+	bus := events.NewBus()
+	// subscriptions expire as soon as they are made
+	notifier := external.NewNotifier(time.Second, 0, true)
+
+	err := notifier.Subscribe("sheet", "cell", external.Subscription{URL: "http://remote/api/v1/sheet/cell", WebhookURL: webhook.URL, Secret: "secret"})
+	if err != nil {
+		t.Fatalf("want (<nil>) got (%v)", err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go notifier.Listen(bus, stop)
+
+	deadline := time.After(200 * time.Millisecond)
+	for {
+		bus.Publish(events.Event{Type: events.TypeCellUpdated, SheetID: "sheet", CellID: "cell", Result: "2"})
+
+		select {
+		case <-notifications:
+			t.Fatalf("expected no notification for an expired subscription")
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			return
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package external
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"dev-challenge/internal/events"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// NotifyWorkers is the number of notifications posted at the same time.
+	NotifyWorkers = 8
+	// NotifyQueueSize is the number of notifications waiting to be posted,
+	// further ones are dropped until the workers catch up.
+	NotifyQueueSize = 1024
+	// SubscriptionTTL is how long subscriptions are kept unless they are renewed.
+	SubscriptionTTL = 24 * time.Hour
+	// SignatureHeader carries the signature of a notification, the hex encoded
+	// HMAC-SHA256 of its body with the secret of the subscription.
+	SignatureHeader = "X-Signature"
+)
+
+type delivery struct {
+	webhookURL   string
+	secret       string
+	notification Notification
+}
+
+// Notifier keeps subscriptions of other servers to cells of this one
+// and posts a Notification to their webhooks whenever a cell changes.
+// Subscriptions are kept in memory and expire after the TTL, clients
+// renew them on every fetch. Webhooks of private networks are refused
+// unless allowPrivate is set.
+type Notifier struct {
+	httpClient *http.Client
+	ttl        time.Duration
+
+	mu            sync.RWMutex
+	subscriptions map[string]map[string]map[Subscription]time.Time
+	sweptAt       time.Time
+	now           func() time.Time
+}
+
+func NewNotifier(timeout, ttl time.Duration, allowPrivate bool) *Notifier {
+	return &Notifier{
+		httpClient:    newHTTPClient(timeout, allowPrivate),
+		ttl:           ttl,
+		subscriptions: make(map[string]map[string]map[Subscription]time.Time),
+		now:           time.Now,
+	}
+}
+
+// Subscribe registers the webhook to be notified about changes of the cell.
+// Notifications are signed with the subscription's secret, so that the
+// subscriber can tell them from ones posted by anybody else.
+func (n *Notifier) Subscribe(sheetID, cellID string, subscription Subscription) error {
+	if !isHTTPURL(subscription.WebhookURL) {
+		return fmt.Errorf("%w: %s", ErrInvalidURL, subscription.WebhookURL)
+	}
+	if subscription.Secret == "" {
+		return fmt.Errorf("%w: a secret is required", ErrInvalidSubscription)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.sweep()
+
+	if _, ok := n.subscriptions[sheetID]; !ok {
+		n.subscriptions[sheetID] = make(map[string]map[Subscription]time.Time)
+	}
+	if _, ok := n.subscriptions[sheetID][cellID]; !ok {
+		n.subscriptions[sheetID][cellID] = make(map[Subscription]time.Time)
+	}
+	n.subscriptions[sheetID][cellID][subscription] = n.now().Add(n.ttl)
+
+	return nil
+}
+
+// sweep evicts expired subscriptions at most once per TTL. The caller must hold the lock.
+func (n *Notifier) sweep() {
+	now := n.now()
+	if now.Sub(n.sweptAt) < n.ttl {
+		return
+	}
+	n.sweptAt = now
+
+	for sheetID, sheetSubscriptions := range n.subscriptions {
+		for cellID, cellSubscriptions := range sheetSubscriptions {
+			for subscription, expiresAt := range cellSubscriptions {
+				if !now.Before(expiresAt) {
+					delete(cellSubscriptions, subscription)
+				}
+			}
+			if len(cellSubscriptions) == 0 {
+				delete(sheetSubscriptions, cellID)
+			}
+		}
+		if len(sheetSubscriptions) == 0 {
+			delete(n.subscriptions, sheetID)
+		}
+	}
+}
+
+// Listen delivers notifications for the bus events until stop is closed.
+func (n *Notifier) Listen(bus *events.Bus, stop <-chan struct{}) {
+	allEvents, unsubscribe := bus.SubscribeAll()
+	defer unsubscribe()
+
+	deliveries := make(chan delivery, NotifyQueueSize)
+	defer close(deliveries)
+
+	for i := 0; i < NotifyWorkers; i++ {
+		go func() {
+			for d := range deliveries {
+				n.notify(d)
+			}
+		}()
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case e := <-allEvents:
+			for _, subscription := range n.subscribersOf(e) {
+				d := delivery{
+					webhookURL: subscription.WebhookURL,
+					secret:     subscription.Secret,
+					notification: Notification{
+						URL:    subscription.URL,
+						Value:  e.Value,
+						Result: e.Result,
+					},
+				}
+
+				select {
+				case deliveries <- d:
+				default:
+					log.Printf("notification queue is full, dropping notification to %s", d.webhookURL)
+				}
+			}
+		}
+	}
+}
+
+// subscribersOf returns subscriptions to the cell of the event, or to any
+// cell of the sheet if the whole sheet has been replaced.
+func (n *Notifier) subscribersOf(e events.Event) []Subscription {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	now := n.now()
+	subscriptions := make([]Subscription, 0)
+	for cellID, cellSubscriptions := range n.subscriptions[e.SheetID] {
+		if e.Type != events.TypeSheetReplaced && cellID != e.CellID {
+			continue
+		}
+		for subscription, expiresAt := range cellSubscriptions {
+			if now.Before(expiresAt) {
+				subscriptions = append(subscriptions, subscription)
+			}
+		}
+	}
+
+	return subscriptions
+}
+
+func (n *Notifier) notify(d delivery) {
+	body, err := json.Marshal(d.notification)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	request, err := http.NewRequest(http.MethodPost, d.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(SignatureHeader, sign(d.secret, body))
+
+	response, err := n.httpClient.Do(request)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	response.Body.Close()
+}
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func isHTTPURL(rawURL string) bool {
+	u, err := neturl.Parse(rawURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
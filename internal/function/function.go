@@ -0,0 +1,80 @@
+package function
+
+import (
+	"dev-challenge/internal/parser"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidDefinition = errors.New("invalid function definition")
+
+// Function is a user-defined function written as a formula,
+// e.g. MARGIN(cost, price) = (price - cost) / price.
+type Function struct {
+	Name   string   `json:"name"`
+	Params []string `json:"params"`
+	Body   string   `json:"body"`
+}
+
+// Definition returns the function as it is written by users.
+func (f Function) Definition() string {
+	return fmt.Sprintf("%s(%s) = %s", f.Name, strings.Join(f.Params, ", "), f.Body)
+}
+
+// Parse reads a definition such as "MARGIN(cost, price) = (price - cost) / price".
+// Names of functions are uppercased and names of parameters lowercased, as both
+// are case-insensitive. The body may only reference the parameters.
+func Parse(definition string) (Function, parser.Tree, error) {
+	header, body, found := strings.Cut(strings.TrimPrefix(strings.TrimSpace(definition), "="), "=")
+	if !found {
+		return Function{}, nil, fmt.Errorf("%w: %s", ErrInvalidDefinition, "expected NAME(params) = formula")
+	}
+
+	headerTree, err := parser.Parse(header)
+	if err != nil || len(headerTree) != 1 || !headerTree[0].IsFunc() {
+		return Function{}, nil, fmt.Errorf("%w: %s", ErrInvalidDefinition, "expected NAME(params) = formula")
+	}
+
+	f := Function{
+		Name:   strings.ToUpper(headerTree[0].Value),
+		Params: make([]string, 0, len(headerTree[0].Children)),
+		Body:   strings.TrimSpace(body),
+	}
+
+	params := make(map[string]bool)
+	for _, arg := range headerTree[0].Children {
+		if len(arg.Children) != 1 || !arg.Children[0].IsVar() || arg.Children[0].Sheet != "" {
+			return Function{}, nil, fmt.Errorf("%w: %s", ErrInvalidDefinition, "parameters must be names")
+		}
+
+		param := strings.ToLower(arg.Children[0].Value)
+		if params[param] {
+			return Function{}, nil, fmt.Errorf("%w: duplicate parameter %s", ErrInvalidDefinition, param)
+		}
+		params[param] = true
+		f.Params = append(f.Params, param)
+	}
+
+	bodyTree, err := parser.Parse(f.Body)
+	if err != nil {
+		return Function{}, nil, fmt.Errorf("%w: %v", ErrInvalidDefinition, err)
+	}
+
+	if len(bodyTree) == 0 {
+		return Function{}, nil, fmt.Errorf("%w: %s", ErrInvalidDefinition, "body is required")
+	}
+
+	// functions are shared by all sheets, so they cannot depend on cells
+	for _, name := range bodyTree.Vars() {
+		if !params[strings.ToLower(name)] {
+			return Function{}, nil, fmt.Errorf("%w: %s is not a parameter", ErrInvalidDefinition, name)
+		}
+	}
+
+	if ranges := bodyTree.Ranges(); len(ranges) > 0 {
+		return Function{}, nil, fmt.Errorf("%w: %s is not a parameter", ErrInvalidDefinition, ranges[0])
+	}
+
+	return f, bodyTree, nil
+}
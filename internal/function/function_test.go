@@ -0,0 +1,64 @@
+package function_test
+
+import (
+	"dev-challenge/internal/function"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		definition string
+		want       function.Function
+		err        error
+	}{
+		{
+			definition: "MARGIN(cost, price) = (price - cost) / price",
+			want:       function.Function{Name: "MARGIN", Params: []string{"cost", "price"}, Body: "(price - cost) / price"},
+		},
+		{
+			definition: "=tax(Amount)=Amount*0.2",
+			want:       function.Function{Name: "TAX", Params: []string{"amount"}, Body: "Amount*0.2"},
+		},
+		{
+			definition: "TAU() = 6.28",
+			want:       function.Function{Name: "TAU", Params: []string{}, Body: "6.28"},
+		},
+		{definition: "MARGIN(cost, price)", err: function.ErrInvalidDefinition},
+		{definition: "MARGIN = 1", err: function.ErrInvalidDefinition},
+		{definition: "MARGIN(1) = 1", err: function.ErrInvalidDefinition},
+		{definition: "MARGIN(s!x) = 1", err: function.ErrInvalidDefinition},
+		{definition: "MARGIN(x, X) = x", err: function.ErrInvalidDefinition},
+		{definition: "MARGIN(x) = x + a1", err: function.ErrInvalidDefinition},
+		{definition: "MARGIN(x) = SUM(a1:a2)", err: function.ErrInvalidDefinition},
+		{definition: "MARGIN(x) = ", err: function.ErrInvalidDefinition},
+		{definition: "MARGIN(x) = (x", err: function.ErrInvalidDefinition},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.definition, func(t *testing.T) {
+			got, _, err := function.Parse(test.definition)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("want (%v) got (%v)", test.err, err)
+			}
+
+			if test.err == nil && !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("want (%v) got (%v)", test.want, got)
+			}
+		})
+	}
+}
+
+func TestFunction_Definition(t *testing.T) {
+	definition := "MARGIN(cost, price) = (price - cost) / price"
+
+	f, _, err := function.Parse(definition)
+	if err != nil {
+		t.Fatalf("want (<nil>) got (%v)", err)
+	}
+
+	if got := f.Definition(); got != definition {
+		t.Fatalf("want (%s) got (%s)", definition, got)
+	}
+}
@@ -0,0 +1,14 @@
+package function
+
+import "errors"
+
+var ErrNotFound = errors.New("function not found")
+
+type Repository interface {
+	GetOne(name string) (Function, error)
+	GetMany() ([]Function, error)
+	// Upsert creates the function or replaces its definition.
+	Upsert(f Function) error
+	// Delete returns ErrNotFound if the function is not defined.
+	Delete(name string) error
+}
@@ -0,0 +1,175 @@
+package function
+
+import (
+	"dev-challenge/internal/evaluator"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+var ErrReservedName = errors.New("function name is reserved")
+
+// Recalculator re-evaluates formulas calling the function.
+type Recalculator interface {
+	RecalculateCalling(name string) error
+}
+
+type Service struct {
+	repo         Repository
+	recalculator Recalculator
+
+	// names of user-defined functions, other registered functions are built-in
+	mu      sync.Mutex
+	defined map[string]bool
+}
+
+func NewService(repo Repository, recalculator Recalculator) *Service {
+	return &Service{
+		repo:         repo,
+		recalculator: recalculator,
+		defined:      make(map[string]bool),
+	}
+}
+
+// Load registers the stored functions, so that formulas can call them.
+func (s *Service) Load() error {
+	functions, err := s.repo.GetMany()
+	if err != nil {
+		return err
+	}
+
+	for _, f := range functions {
+		if err := s.register(f); err != nil {
+			log.Printf("function %s: %v", f.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) GetFunctions() ([]Function, error) {
+	return s.repo.GetMany()
+}
+
+func (s *Service) GetFunction(name string) (Function, error) {
+	return s.repo.GetOne(strings.ToUpper(name))
+}
+
+// Define validates and stores the definition and recalculates cells calling
+// the function, which may have been written while it was not defined.
+func (s *Service) Define(definition string) (Function, error) {
+	f, body, err := Parse(definition)
+	if err != nil {
+		return Function{}, err
+	}
+
+	// a function may call itself, recursion is limited when it is evaluated
+	for _, name := range body.Funcs() {
+		if !strings.EqualFold(name, f.Name) && !evaluator.IsFunction(name) {
+			return Function{}, fmt.Errorf("%w: %s", evaluator.ErrUnknownFunction, strings.ToUpper(name))
+		}
+	}
+
+	s.mu.Lock()
+	defined := s.defined[f.Name]
+	s.mu.Unlock()
+
+	if !defined && evaluator.IsFunction(f.Name) {
+		return Function{}, fmt.Errorf("%w: %s", ErrReservedName, f.Name)
+	}
+
+	if err := s.repo.Upsert(f); err != nil {
+		return Function{}, err
+	}
+
+	if err := s.register(f); err != nil {
+		return Function{}, err
+	}
+
+	s.recalculate(f.Name)
+
+	return f, nil
+}
+
+// Delete removes the function, cells calling it get the error result.
+func (s *Service) Delete(name string) error {
+	name = strings.ToUpper(name)
+
+	if err := s.repo.Delete(name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.defined, name)
+	s.mu.Unlock()
+
+	evaluator.UnregisterFunction(name)
+	s.recalculate(name)
+
+	return nil
+}
+
+func (s *Service) register(f Function) error {
+	_, body, err := Parse(f.Definition())
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.defined[f.Name] = true
+	s.mu.Unlock()
+
+	evaluator.RegisterFunction(f.Name, evaluator.FormulaFunction(f.Params, body))
+	return nil
+}
+
+// recalculate re-evaluates cells calling the function
+// directly or through other user-defined functions.
+func (s *Service) recalculate(name string) {
+	names, err := s.callers(name)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, name := range names {
+		if err := s.recalculator.RecalculateCalling(name); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// callers returns the function's name and names of the functions calling it.
+func (s *Service) callers(name string) ([]string, error) {
+	functions, err := s.repo.GetMany()
+	if err != nil {
+		return nil, err
+	}
+
+	calls := make(map[string][]string)
+	for _, f := range functions {
+		_, body, err := Parse(f.Definition())
+		if err != nil {
+			continue
+		}
+		for _, called := range body.Funcs() {
+			called = strings.ToUpper(called)
+			calls[called] = append(calls[called], f.Name)
+		}
+	}
+
+	names := []string{name}
+	seen := map[string]bool{name: true}
+	for i := 0; i < len(names); i++ {
+		for _, caller := range calls[names[i]] {
+			if !seen[caller] {
+				seen[caller] = true
+				names = append(names, caller)
+			}
+		}
+	}
+
+	return names, nil
+}
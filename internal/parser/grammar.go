@@ -15,6 +15,16 @@ const (
 	Space      = ' '
 	Dot        = '.'
 	Underscore = '_'
+
+	SheetSeparator = '!'
+	RangeSeparator = ':'
+	Comma          = ','
+	Quote          = '"'
+	Dollar         = '$'
+	Hash           = '#'
+
+	// ErrorRef replaces references to deleted cells
+	ErrorRef = "#REF!"
 )
 
 func containsDot(number []rune) bool {
@@ -43,5 +53,8 @@ const (
 	KindFloat   = "KindFloat"
 	KindString  = "KindString"
 
-	KindVar = "KindVar"
+	KindVar   = "KindVar"
+	KindRange = "KindRange"
+	KindFunc  = "KindFunc"
+	KindError = "KindError"
 )
@@ -1,9 +1,40 @@
 package parser
 
+import (
+	"dev-challenge/internal/a1"
+	"strings"
+)
+
 type Node struct {
-	Kind     string
-	Value    string
-	Children []Node
+	Kind     string `json:"kind"`
+	Value    string `json:"value,omitempty"`
+	Children []Node `json:"children,omitempty"`
+
+	// Sheet qualifies a variable or a range which refers to cells of another sheet.
+	Sheet string `json:"sheet,omitempty"`
+
+	// Absolute tells which parts of an A1-style variable, or of both corners
+	// of a range, are written with a dollar sign, e.g. "$a$1". The value
+	// itself is the cell id or the range without dollar signs.
+	Absolute []a1.Absolute `json:"absolute,omitempty"`
+}
+
+// Ref returns a variable name or a range qualified with its sheet if there is one.
+func (n Node) Ref() string {
+	if n.Sheet == "" {
+		return n.Value
+	}
+	return n.Sheet + string(SheetSeparator) + n.Value
+}
+
+// SplitRef splits a possibly qualified variable name into a sheet and a name.
+func SplitRef(ref string) (string, string) {
+	for i, char := range ref {
+		if char == SheetSeparator {
+			return ref[:i], ref[i+1:]
+		}
+	}
+	return "", ref
 }
 
 func (n Node) IsParentheses() bool {
@@ -14,6 +45,10 @@ func (n Node) IsVar() bool {
 	return n.Kind == KindVar
 }
 
+func (n Node) IsRange() bool {
+	return n.Kind == KindRange
+}
+
 func (n Node) IsNumber() bool {
 	return n.Kind == KindInteger || n.Kind == KindFloat
 }
@@ -35,10 +70,36 @@ func (n Node) IsOperation() bool {
 	}
 }
 
+func (n Node) IsFunc() bool {
+	return n.Kind == KindFunc
+}
+
+func (n Node) IsString() bool {
+	return n.Kind == KindString
+}
+
+func (n Node) IsError() bool {
+	return n.Kind == KindError
+}
+
 func (n Node) needSecondOperand() bool {
 	return n.IsParentheses() && len(n.Children) == 2 && (n.Children[1].Kind == KindOpMultiply || n.Children[1].Kind == KindOpDivide)
 }
 
+// pendingOperation returns the (possibly nested) multiplication or division
+// still waiting for its second operand, e.g. the unary minus in "2*-".
+func (n *Node) pendingOperation() *Node {
+	if n.needSecondOperand() {
+		return n
+	}
+
+	if n.IsParentheses() && len(n.Children) == 3 && (n.Children[1].Kind == KindOpMultiply || n.Children[1].Kind == KindOpDivide) {
+		return n.Children[2].pendingOperation()
+	}
+
+	return nil
+}
+
 type Tree []Node
 
 func (t Tree) Pop() Tree {
@@ -57,8 +118,71 @@ func (t Tree) Last() (*Node, bool) {
 
 func (t Tree) expectsNextNode() bool {
 	node, ok := t.Last()
-	if ok && !node.IsOperation() && !node.needSecondOperand() {
+	if ok && !node.IsOperation() && node.pendingOperation() == nil {
 		return false
 	}
 	return true
 }
+
+// Vars returns (qualified) names of all variables referenced by
+// the tree including the ones nested into parentheses.
+func (t Tree) Vars() []string {
+	vars := make([]string, 0)
+	for _, node := range t {
+		if node.IsVar() {
+			vars = append(vars, node.Ref())
+		}
+		if len(node.Children) > 0 {
+			vars = append(vars, Tree(node.Children).Vars()...)
+		}
+	}
+	return vars
+}
+
+// Ranges returns (qualified) ranges referenced by the tree, e.g. "budget!a1:a10".
+func (t Tree) Ranges() []string {
+	ranges := make([]string, 0)
+	for _, node := range t {
+		if node.IsRange() {
+			ranges = append(ranges, node.Ref())
+		}
+		if len(node.Children) > 0 {
+			ranges = append(ranges, Tree(node.Children).Ranges()...)
+		}
+	}
+	return ranges
+}
+
+// Funcs returns names of all functions called in the tree.
+func (t Tree) Funcs() []string {
+	funcs := make([]string, 0)
+	for _, node := range t {
+		if node.IsFunc() {
+			funcs = append(funcs, node.Value)
+		}
+		if len(node.Children) > 0 {
+			funcs = append(funcs, Tree(node.Children).Funcs()...)
+		}
+	}
+	return funcs
+}
+
+// CallsWith tells if the tree calls the function, whose name is case-insensitive,
+// with the text constant as its first argument, e.g. EXTERNAL_REF("http://...").
+func (t Tree) CallsWith(name, text string) bool {
+	for _, node := range t {
+		if node.IsFunc() && strings.EqualFold(node.Value, name) && len(node.Children) > 0 {
+			arg := node.Children[0]
+			if arg.IsParentheses() && len(arg.Children) == 1 {
+				arg = arg.Children[0]
+			}
+			if arg.IsString() && arg.Value == text {
+				return true
+			}
+		}
+		if len(node.Children) > 0 && Tree(node.Children).CallsWith(name, text) {
+			return true
+		}
+	}
+	return false
+}
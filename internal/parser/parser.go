@@ -1,14 +1,17 @@
 package parser
 
 import (
+	"dev-challenge/internal/a1"
 	"errors"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 var (
 	ErrInvalidParentheses = errors.New("invalid parentheses")
 	ErrInvalidOperation   = errors.New("invalid operation")
+	ErrInvalidString      = errors.New("invalid string")
 )
 
 // Parse parses given input string into an abstract syntax tree.
@@ -20,7 +23,89 @@ func Parse(input string) (Tree, error) {
 	parenStack := make([]rune, 0)
 	parenBuffer := make([]rune, 0)
 
+	// sheet qualifier of the variable being parsed, e.g. "budget" in "budget!total"
+	sheet := ""
+	// first cell of the range being parsed, e.g. "a1" in "a1:a10"
+	rangeStart := ""
+	newOperand := func() (Node, error) {
+		node := createVarOrNumberNode(buffer)
+		if sheet != "" {
+			node.Kind = KindVar
+			node.Sheet = sheet
+			sheet = ""
+		}
+		if rangeStart != "" {
+			node.Kind = KindRange
+			node.Value = rangeStart + string(RangeSeparator) + node.Value
+			rangeStart = ""
+		}
+		return absolute(node)
+	}
+
+	// number of characters of an error literal, e.g. #REF!, which have already been read
+	skip := 0
+
+	// name of the function whose arguments are being collected into parenBuffer
+	function := ""
+
+	// a string literal is being read, closingQuote is set when a quote has been
+	// met inside of it which either ends the string or escapes the next quote
+	inString := false
+	closingQuote := false
+	stringBuffer := make([]rune, 0)
+
 	for i, char := range input {
+		if skip > 0 {
+			skip--
+			continue
+		}
+
+		if closingQuote {
+			closingQuote = false
+
+			if char == Quote {
+				if len(parenStack) > 0 {
+					parenBuffer = append(parenBuffer, char)
+				} else {
+					stringBuffer = append(stringBuffer, char)
+				}
+				continue
+			}
+
+			inString = false
+			if len(parenStack) == 0 {
+				if !nodes.expectsNextNode() {
+					return nil, ErrInvalidOperation
+				}
+				nodes = satisfyOperators(nodes, Node{Kind: KindString, Value: string(stringBuffer)})
+				stringBuffer = make([]rune, 0)
+			}
+		}
+
+		if inString {
+			if char == Quote {
+				closingQuote = true
+			}
+			// strings inside parentheses are kept as they are to be parsed later
+			if len(parenStack) > 0 {
+				parenBuffer = append(parenBuffer, char)
+			} else if char != Quote {
+				stringBuffer = append(stringBuffer, char)
+			}
+			continue
+		}
+
+		if char == Quote {
+			if len(buffer) > 0 || sheet != "" || rangeStart != "" {
+				return nil, ErrInvalidOperation
+			}
+			inString = true
+			if len(parenStack) > 0 {
+				parenBuffer = append(parenBuffer, char)
+			}
+			continue
+		}
+
 		if char == Space {
 			continue
 		}
@@ -46,34 +131,63 @@ func Parse(input string) (Tree, error) {
 			}
 		}
 
-		isLastChar := len(input)-1 == i
+		isLastChar := i+utf8.RuneLen(char) == len(input)
+
+		// a qualifier or a range separator must be followed by a variable name
+		if (sheet != "" || rangeStart != "") && len(buffer) == 0 && !isLetter(char) && !unicode.IsNumber(char) && char != Dollar {
+			return nil, ErrInvalidOperation
+		}
 
 		// continue fill variable name or number if already started
 		if len(buffer) > 0 {
 			switch {
-			case isLetter(char) || unicode.IsNumber(char) && !isLastChar:
+			case (isLetter(char) || unicode.IsNumber(char) || char == Dollar) && !isLastChar:
 				buffer = append(buffer, char)
 			case char == Dot && unicode.IsNumber(buffer[0]) && !isLastChar:
 				buffer = append(buffer, char)
+			case char == SheetSeparator && sheet == "" && rangeStart == "" && !containsDollar(buffer) && !isLastChar:
+				sheet = string(buffer)
+				buffer = make([]rune, 0)
+				continue
+			case char == RangeSeparator && rangeStart == "" && !isLastChar:
+				rangeStart = string(buffer)
+				buffer = make([]rune, 0)
+				continue
+			case char == OpenParen && sheet == "" && rangeStart == "" && unicode.IsLetter(buffer[0]):
+				if !nodes.expectsNextNode() {
+					return nil, ErrInvalidOperation
+				}
+				function = string(buffer)
+				buffer = make([]rune, 0)
 			case (isLetter(char) || unicode.IsNumber(char)) && isLastChar:
 				buffer = append(buffer, char)
 				if !nodes.expectsNextNode() {
 					return nil, ErrInvalidOperation
 				}
 
-				node := createVarOrNumberNode(buffer)
+				node, err := newOperand()
+				if err != nil {
+					return nil, err
+				}
 				nodes = satisfyOperators(nodes, node)
 				return nodes, nil
 			default:
 				if !nodes.expectsNextNode() {
 					return nil, ErrInvalidOperation
 				}
-				node := createVarOrNumberNode(buffer)
+				node, err := newOperand()
+				if err != nil {
+					return nil, err
+				}
 				nodes = satisfyOperators(nodes, node)
 				buffer = make([]rune, 0)
 			}
 		}
 
+		if char == SheetSeparator || char == RangeSeparator {
+			return nil, ErrInvalidOperation
+		}
+
 		node := Node{}
 
 		switch char {
@@ -93,8 +207,8 @@ func Parse(input string) (Tree, error) {
 				return nil, ErrInvalidOperation
 			}
 
-			lastNode, ok := nodes.Last()
-			if !ok || (!lastNode.IsNumber() && !lastNode.IsVar()) {
+			// a minus is unary unless it follows a complete operand
+			if nodes.expectsNextNode() {
 				node.Kind = KindParentheses
 				node.Children = []Node{
 					{
@@ -105,7 +219,7 @@ func Parse(input string) (Tree, error) {
 						Kind: KindOpMultiply,
 					},
 				}
-				nodes = append(nodes, node)
+				nodes = satisfyOperators(nodes, node)
 			} else {
 				node.Kind = KindOpMinus
 				nodes = append(nodes, node)
@@ -135,6 +249,13 @@ func Parse(input string) (Tree, error) {
 			}
 			nodes = tree
 
+		case Hash:
+			if !nodes.expectsNextNode() || !hasErrorRef(input[i:]) {
+				return nil, ErrInvalidOperation
+			}
+			nodes = satisfyOperators(nodes, Node{Kind: KindError, Value: ErrorRef})
+			skip = len(ErrorRef) - 1
+
 		// catches first opened parenthesis
 		case OpenParen:
 			parenStack = append(parenStack, char)
@@ -148,33 +269,58 @@ func Parse(input string) (Tree, error) {
 				return nil, ErrInvalidParentheses
 			}
 
-			node.Kind = KindParentheses
 			parenStack = make([]rune, 0)
 
-			parsedChildren, err := Parse(string(parenBuffer))
-			if err != nil {
-				return nil, err
+			if function != "" {
+				args, err := parseArguments(parenBuffer)
+				if err != nil {
+					return nil, err
+				}
+				node.Kind = KindFunc
+				node.Value = function
+				node.Children = args
+				function = ""
+			} else {
+				parsedChildren, err := Parse(string(parenBuffer))
+				if err != nil {
+					return nil, err
+				}
+				node.Kind = KindParentheses
+				node.Children = parsedChildren
 			}
-			node.Children = parsedChildren
 			parenBuffer = make([]rune, 0)
 
 			nodes = satisfyOperators(nodes, node)
 		}
 
 		// start parsing variable name or number
-		if len(buffer) == 0 && (isLetter(char) || unicode.IsNumber(char)) {
+		if len(buffer) == 0 && (isLetter(char) || unicode.IsNumber(char) || char == Dollar) {
 			buffer = append(buffer, char)
 
 			if isLastChar {
 				if !nodes.expectsNextNode() {
 					return nil, ErrInvalidOperation
 				}
-				node := createVarOrNumberNode(buffer)
+				node, err := newOperand()
+				if err != nil {
+					return nil, err
+				}
 				nodes = satisfyOperators(nodes, node)
 			}
 		}
 	}
 
+	if inString && !closingQuote {
+		return nil, ErrInvalidString
+	}
+
+	if closingQuote && len(parenStack) == 0 {
+		if !nodes.expectsNextNode() {
+			return nil, ErrInvalidOperation
+		}
+		nodes = satisfyOperators(nodes, Node{Kind: KindString, Value: string(stringBuffer)})
+	}
+
 	if len(parenStack) > 0 {
 		return nil, ErrInvalidParentheses
 	}
@@ -182,9 +328,60 @@ func Parse(input string) (Tree, error) {
 	return nodes, nil
 }
 
+// parseArguments splits function arguments by top level commas
+// and parses each of them into a parentheses node.
+func parseArguments(input []rune) ([]Node, error) {
+	args := make([]Node, 0)
+	if strings.TrimSpace(string(input)) == "" {
+		return args, nil
+	}
+
+	depth := 0
+	inString := false
+	start := 0
+	for i := 0; i <= len(input); i++ {
+		if i < len(input) {
+			char := input[i]
+			switch {
+			case char == Quote:
+				inString = !inString
+				continue
+			case inString:
+				continue
+			case char == OpenParen:
+				depth++
+				continue
+			case char == CloseParen:
+				depth--
+				continue
+			case char != Comma || depth > 0:
+				continue
+			}
+		}
+
+		arg := string(input[start:i])
+		if strings.TrimSpace(arg) == "" {
+			return nil, ErrInvalidOperation
+		}
+
+		children, err := Parse(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, Node{
+			Kind:     KindParentheses,
+			Children: children,
+		})
+		start = i + 1
+	}
+
+	return args, nil
+}
+
 func wrapLastNode(nodes Tree, operation Node) (Tree, error) {
 	lastNode, ok := nodes.Last()
-	if !ok {
+	if !ok || nodes.expectsNextNode() {
 		return nil, ErrInvalidOperation
 	}
 
@@ -203,8 +400,8 @@ func satisfyOperators(nodes Tree, node Node) Tree {
 		return append(nodes, node)
 	}
 
-	if lastNode.needSecondOperand() {
-		lastNode.Children = append(lastNode.Children, node)
+	if pending := lastNode.pendingOperation(); pending != nil {
+		pending.Children = append(pending.Children, node)
 		return nodes
 	}
 
@@ -214,7 +411,7 @@ func satisfyOperators(nodes Tree, node Node) Tree {
 func createVarOrNumberNode(buffer []rune) Node {
 	node := Node{}
 
-	if unicode.IsLetter(buffer[0]) {
+	if unicode.IsLetter(buffer[0]) || containsDollar(buffer) {
 		node.Kind = KindVar
 	} else if containsDot(buffer) {
 		node.Kind = KindFloat
@@ -225,3 +422,39 @@ func createVarOrNumberNode(buffer []rune) Node {
 	node.Value = string(buffer)
 	return node
 }
+
+// absolute strips the dollar signs of an A1-style variable or range and
+// records which parts are absolute. Dollar signs are invalid elsewhere.
+func absolute(node Node) (Node, error) {
+	if !containsDollar([]rune(node.Value)) {
+		return node, nil
+	}
+
+	corners := strings.Split(node.Value, string(RangeSeparator))
+	node.Absolute = make([]a1.Absolute, 0, len(corners))
+	for i, corner := range corners {
+		_, absolute, ok := a1.ParseAbsolute(corner)
+		if !ok {
+			return Node{}, ErrInvalidOperation
+		}
+		corners[i] = strings.ReplaceAll(corner, string(Dollar), "")
+		node.Absolute = append(node.Absolute, absolute)
+	}
+
+	node.Value = strings.Join(corners, string(RangeSeparator))
+	return node, nil
+}
+
+func containsDollar(buffer []rune) bool {
+	for _, char := range buffer {
+		if char == Dollar {
+			return true
+		}
+	}
+	return false
+}
+
+// hasErrorRef tells if the input starts with the #REF! error, case-insensitively.
+func hasErrorRef(input string) bool {
+	return len(input) >= len(ErrorRef) && strings.EqualFold(input[:len(ErrorRef)], ErrorRef)
+}
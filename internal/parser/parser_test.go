@@ -1,6 +1,7 @@
 package parser_test
 
 import (
+	"dev-challenge/internal/a1"
 	"dev-challenge/internal/parser"
 	"errors"
 	"testing"
@@ -81,9 +82,196 @@ func TestParser_Parse(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "variable at the end",
+			input: "=1+total",
+			err:   nil,
+			want: []parser.Node{
+				{
+					Kind: parser.KindOpEqual,
+				},
+				{
+					Kind:  parser.KindInteger,
+					Value: "1",
+				},
+				{
+					Kind: parser.KindOpPlus,
+				},
+				{
+					Kind:  parser.KindVar,
+					Value: "total",
+				},
+			},
+		},
+		{
+			name:  "qualified variables",
+			input: "=budget!total*0.2+2023!a1",
+			err:   nil,
+			want: []parser.Node{
+				{
+					Kind: parser.KindOpEqual,
+				},
+				{
+					Kind: parser.KindParentheses,
+					Children: []parser.Node{
+						{
+							Kind:  parser.KindVar,
+							Value: "total",
+							Sheet: "budget",
+						},
+						{
+							Kind: parser.KindOpMultiply,
+						},
+						{
+							Kind:  parser.KindFloat,
+							Value: "0.2",
+						},
+					},
+				},
+				{
+					Kind: parser.KindOpPlus,
+				},
+				{
+					Kind:  parser.KindVar,
+					Value: "a1",
+					Sheet: "2023",
+				},
+			},
+		},
+		{
+			name:  "minus after a product",
+			input: "2*3-1",
+			err:   nil,
+			want: []parser.Node{
+				{
+					Kind: parser.KindParentheses,
+					Children: []parser.Node{
+						{
+							Kind:  parser.KindInteger,
+							Value: "2",
+						},
+						{
+							Kind: parser.KindOpMultiply,
+						},
+						{
+							Kind:  parser.KindInteger,
+							Value: "3",
+						},
+					},
+				},
+				{
+					Kind: parser.KindOpMinus,
+				},
+				{
+					Kind:  parser.KindInteger,
+					Value: "1",
+				},
+			},
+		},
+		{
+			name:  "function call",
+			input: `=EXTERNAL_REF("http://host/api/v1/a(b)"", c") * 2`,
+			err:   nil,
+			want: []parser.Node{
+				{
+					Kind: parser.KindOpEqual,
+				},
+				{
+					Kind: parser.KindParentheses,
+					Children: []parser.Node{
+						{
+							Kind:  parser.KindFunc,
+							Value: "EXTERNAL_REF",
+							Children: []parser.Node{
+								{
+									Kind: parser.KindParentheses,
+									Children: []parser.Node{
+										{
+											Kind:  parser.KindString,
+											Value: `http://host/api/v1/a(b)", c`,
+										},
+									},
+								},
+							},
+						},
+						{
+							Kind: parser.KindOpMultiply,
+						},
+						{
+							Kind:  parser.KindInteger,
+							Value: "2",
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "function arguments",
+			input: "max(a1, (1+2), min())",
+			err:   nil,
+			want: []parser.Node{
+				{
+					Kind:  parser.KindFunc,
+					Value: "max",
+					Children: []parser.Node{
+						{
+							Kind:     parser.KindParentheses,
+							Children: []parser.Node{{Kind: parser.KindVar, Value: "a1"}},
+						},
+						{
+							Kind: parser.KindParentheses,
+							Children: []parser.Node{
+								{
+									Kind: parser.KindParentheses,
+									Children: []parser.Node{
+										{Kind: parser.KindInteger, Value: "1"},
+										{Kind: parser.KindOpPlus},
+										{Kind: parser.KindInteger, Value: "2"},
+									},
+								},
+							},
+						},
+						{
+							Kind:     parser.KindParentheses,
+							Children: []parser.Node{{Kind: parser.KindFunc, Value: "min"}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "ranges",
+			input: "=SUM(A1:a10, budget!b2:c3)",
+			err:   nil,
+			want: []parser.Node{
+				{
+					Kind: parser.KindOpEqual,
+				},
+				{
+					Kind:  parser.KindFunc,
+					Value: "SUM",
+					Children: []parser.Node{
+						{
+							Kind:     parser.KindParentheses,
+							Children: []parser.Node{{Kind: parser.KindRange, Value: "A1:a10"}},
+						},
+						{
+							Kind:     parser.KindParentheses,
+							Children: []parser.Node{{Kind: parser.KindRange, Value: "b2:c3", Sheet: "budget"}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "unterminated string",
+			input: `="abc`,
+			err:   parser.ErrInvalidString,
+			want:  nil,
+		},
 	}
 
-	invalidOperations := []string{"5+", "5-", "*5", "5*", "/5", "5/", "5(2+2)", "(2+2)5"}
+	invalidOperations := []string{"5+", "5-", "*5", "5*", "/5", "5/", "5(2+2)", "(2+2)5", "budget!", "!a1", "budget!+1", "a!b!c", "f(1,)", "f(,1)", `"a"b`, `1"a"`, "a1:", ":a1", "a1:b2:c3", "a1:budget!b2", "a1:(b2)", "$", "$$a1", "a1$", "a$$1", "$a", "$1", "$sum(1)", "$budget!a1", "total$", "a1:$total", "#", "#REF", "#N/A", "1#REF!", "#REF!1"}
 
 	t.Run("invalid operations", func(t *testing.T) {
 		for _, invalidOp := range invalidOperations {
@@ -120,8 +308,131 @@ func compareNodes(t *testing.T, want, got []parser.Node) {
 			t.Fatalf("node kind mismatch: want (%v) got (%v)", want[i].Kind, node.Kind)
 		case node.Value != want[i].Value:
 			t.Fatalf("node value mismatch: want (%v) got (%v)", want[i].Value, node.Value)
+		case node.Sheet != want[i].Sheet:
+			t.Fatalf("node sheet mismatch: want (%v) got (%v)", want[i].Sheet, node.Sheet)
 		case len(node.Children) > 0:
 			compareNodes(t, want[i].Children, node.Children)
 		}
 	}
 }
+
+func TestParser_CallsWith(t *testing.T) {
+	url := "http://remote/api/v1/sheet/cell"
+
+	testCases := []struct {
+		input string
+		want  bool
+	}{
+		{input: `=EXTERNAL_REF("http://remote/api/v1/sheet/cell") * 2`, want: true},
+		{input: `=SUM(external_ref ( "http://remote/api/v1/sheet/cell" ), 1)`, want: true},
+		{input: `=EXTERNAL_REF("http://remote/api/v1/sheet/cell2")`, want: false},
+		{input: `=EXTERNAL_REF(CONCAT("http://remote/api/v1/sheet/", "cell"))`, want: false},
+		{input: `=LEN("http://remote/api/v1/sheet/cell")`, want: false},
+		{input: `=MY_EXTERNAL_REF("http://remote/api/v1/sheet/cell")`, want: false},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.input, func(t *testing.T) {
+			tree, err := parser.Parse(test.input)
+			if err != nil {
+				t.Fatalf("want (<nil>) got (%v)", err)
+			}
+
+			if got := tree.CallsWith("EXTERNAL_REF", url); got != test.want {
+				t.Fatalf("want (%v) got (%v)", test.want, got)
+			}
+		})
+	}
+}
+
+func TestParser_Print(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  string
+	}{
+		{input: "=A1*(-A2+cell_3)/0.5", want: "=a1 * (-a2 + cell_3) / 0.5"},
+		{input: "= 1+2 *3", want: "=1 + 2 * 3"},
+		{input: "=(1+2)*3", want: "=(1 + 2) * 3"},
+		{input: "=((a1))", want: "=a1"},
+		{input: "=1-(2-3)", want: "=1 - (2 - 3)"},
+		{input: "=(1-2)-3", want: "=1 - 2 - 3"},
+		{input: "=1+(2*3)", want: "=1 + 2 * 3"},
+		{input: "=a1/(b1*c1)", want: "=a1 / (b1 * c1)"},
+		{input: "=-(a1+1)", want: "=-(a1 + 1)"},
+		{input: "=-1*a1", want: "=-1 * a1"},
+		{input: "=2*-3", want: "=2 * -3"},
+		{input: "=--a1", want: "=--a1"},
+		{input: "=sum( A1:b2 ,Budget!Total)", want: "=SUM(a1:b2, budget!total)"},
+		{input: "=pi()", want: "=PI()"},
+		{input: `=concat("Say ""hi""", 1)`, want: `=CONCAT("Say ""hi""", 1)`},
+		{input: "=IF(a1, (1+2)*3, -b1)", want: "=IF(a1, (1 + 2) * 3, -b1)"},
+		{input: "2 +2", want: "2 + 2"},
+		{input: "=$A$1+a$2*SUM($b1:C$3, budget!$z$9)", want: "=$a$1 + a$2 * SUM($b1:c$3, budget!$z$9)"},
+		{input: "=#ref!+SUM(#REF!)", want: "=#REF! + SUM(#REF!)"},
+		{input: "", want: ""},
+	}
+
+	for _, test := range testCases {
+		got, err := parser.Canonical(test.input)
+		if err != nil {
+			t.Fatalf("%s: want (<nil>) got (%v)", test.input, err)
+		}
+		if got != test.want {
+			t.Fatalf("%s: want (%s) got (%s)", test.input, test.want, got)
+		}
+
+		// the canonical formula is canonical itself
+		again, err := parser.Canonical(got)
+		if err != nil {
+			t.Fatalf("%s: want (<nil>) got (%v)", got, err)
+		}
+		if again != got {
+			t.Fatalf("%s: want (%s) got (%s)", got, got, again)
+		}
+	}
+}
+
+func TestParser_Rewrite(t *testing.T) {
+	tree, err := parser.Parse("=total*2+SUM(a1:a3, budget!total, (total))")
+	if err != nil {
+		t.Fatalf("want (<nil>) got (%v)", err)
+	}
+
+	rewritten := tree.Rewrite(func(node parser.Node) parser.Node {
+		switch {
+		case node.IsVar() && node.Value == "total":
+			node.Value = "grand_total"
+		case node.IsRange():
+			node.Value = "b1:b3"
+		}
+		return node
+	})
+
+	want := "=grand_total * 2 + SUM(b1:b3, budget!grand_total, grand_total)"
+	if got := parser.Print(rewritten); got != want {
+		t.Fatalf("want (%s) got (%s)", want, got)
+	}
+
+	// the tree itself is not modified
+	if got := parser.Print(tree); got != "=total * 2 + SUM(a1:a3, budget!total, total)" {
+		t.Fatalf("want the original tree got (%s)", got)
+	}
+}
+
+func TestParser_Absolute(t *testing.T) {
+	tree, err := parser.Parse("=$a$1+SUM(b$2:$C3)")
+	if err != nil {
+		t.Fatalf("want (<nil>) got (%v)", err)
+	}
+
+	variable, sum := tree[1], tree[3]
+	if variable.Value != "a1" || len(variable.Absolute) != 1 || variable.Absolute[0] != (a1.Absolute{Col: true, Row: true}) {
+		t.Fatalf("unexpected variable (%+v)", variable)
+	}
+
+	r := sum.Children[0].Children[0]
+	want := []a1.Absolute{{Row: true}, {Col: true}}
+	if r.Value != "b2:C3" || len(r.Absolute) != 2 || r.Absolute[0] != want[0] || r.Absolute[1] != want[1] {
+		t.Fatalf("unexpected range (%+v)", r)
+	}
+}
@@ -0,0 +1,202 @@
+package parser
+
+import (
+	"dev-challenge/internal/a1"
+	"strings"
+)
+
+// precedence of operations, higher ones bind tighter
+const (
+	precedenceAdditive = iota
+	precedenceMultiplicative
+	precedenceUnary
+	precedenceAtom
+)
+
+// expression is a node of a tree whose operations are resolved into
+// their operands, the way the evaluator applies them from left to right.
+type expression struct {
+	// operation is the kind of the operation, empty for an atom such as a number or a function call
+	operation string
+	operands  []*expression
+	node      Node
+}
+
+// Print renders the tree as a canonical formula: operators are surrounded by
+// single spaces, function arguments are separated by a comma and a space,
+// function names are uppercase, variables and ranges are lowercase and only
+// the parentheses which change the order of operations are kept.
+// Parsing the printed formula yields a tree which evaluates the same way.
+func Print(tree Tree) string {
+	var b strings.Builder
+	if len(tree) > 0 && tree[0].Kind == KindOpEqual {
+		b.WriteRune(OpEqual)
+	}
+
+	if expr := resolve(tree); expr != nil {
+		expr.print(&b)
+	}
+	return b.String()
+}
+
+// Canonical parses the value and prints it as a canonical formula.
+func Canonical(value string) (string, error) {
+	tree, err := Parse(value)
+	if err != nil {
+		return "", err
+	}
+	return Print(tree), nil
+}
+
+// resolve applies the operations of the tree to its operands from left to right.
+// An operand which follows another one without an operation replaces it, e.g.
+// after an equal sign in the middle of a formula, as the evaluator does.
+func resolve(tree Tree) *expression {
+	var result *expression
+	operation := ""
+
+	for _, node := range tree {
+		var operand *expression
+		switch {
+		case node.IsOperation():
+			if node.Kind != KindOpEqual {
+				operation = node.Kind
+			}
+			continue
+		case node.IsParentheses():
+			operand = resolve(node.Children)
+			if operand == nil {
+				operand = &expression{node: node}
+			}
+		default:
+			operand = &expression{node: node}
+		}
+
+		if operation == "" || result == nil {
+			result = operand
+			continue
+		}
+
+		result = &expression{operation: operation, operands: []*expression{result, operand}}
+		operation = ""
+	}
+
+	return result
+}
+
+// unary returns the operand of a unary minus, which is parsed as a multiplication by -1.
+func (e *expression) unary() (*expression, bool) {
+	if e.operation != KindOpMultiply {
+		return nil, false
+	}
+
+	left := e.operands[0]
+	if left.operation != "" || left.node.Kind != KindInteger || left.node.Value != "-1" {
+		return nil, false
+	}
+	return e.operands[1], true
+}
+
+func (e *expression) precedence() int {
+	if _, ok := e.unary(); ok {
+		return precedenceUnary
+	}
+
+	switch e.operation {
+	case KindOpPlus, KindOpMinus:
+		return precedenceAdditive
+	case KindOpMultiply, KindOpDivide:
+		return precedenceMultiplicative
+	}
+	return precedenceAtom
+}
+
+var operationSymbols = map[string]rune{
+	KindOpPlus:     OpPlus,
+	KindOpMinus:    OpMinus,
+	KindOpMultiply: OpMultiply,
+	KindOpDivide:   OpDivide,
+}
+
+func (e *expression) print(b *strings.Builder) {
+	if operand, ok := e.unary(); ok {
+		b.WriteRune(OpMinus)
+		operand.printOperand(b, operand.precedence() < precedenceUnary)
+		return
+	}
+
+	if e.operation != "" {
+		// operations are applied from left to right, so an operation on
+		// the right which does not bind tighter must be parenthesized
+		left, right := e.operands[0], e.operands[1]
+		left.printOperand(b, left.precedence() < e.precedence())
+		b.WriteRune(Space)
+		b.WriteRune(operationSymbols[e.operation])
+		b.WriteRune(Space)
+		right.printOperand(b, right.precedence() <= e.precedence())
+		return
+	}
+
+	printNode(b, e.node)
+}
+
+func (e *expression) printOperand(b *strings.Builder, parenthesized bool) {
+	if !parenthesized {
+		e.print(b)
+		return
+	}
+
+	b.WriteRune(OpenParen)
+	e.print(b)
+	b.WriteRune(CloseParen)
+}
+
+func printNode(b *strings.Builder, node Node) {
+	switch {
+	case node.IsString():
+		b.WriteRune(Quote)
+		b.WriteString(strings.ReplaceAll(node.Value, string(Quote), string([]rune{Quote, Quote})))
+		b.WriteRune(Quote)
+	case node.IsVar(), node.IsRange():
+		b.WriteString(strings.ToLower(node.written().Ref()))
+	case node.IsFunc():
+		b.WriteString(strings.ToUpper(node.Value))
+		b.WriteRune(OpenParen)
+		for i, arg := range node.Children {
+			if i > 0 {
+				b.WriteRune(Comma)
+				b.WriteRune(Space)
+			}
+			if expr := resolve(arg.Children); expr != nil {
+				expr.print(b)
+			}
+		}
+		b.WriteRune(CloseParen)
+	case node.IsParentheses():
+		// parentheses without an expression
+		b.WriteRune(OpenParen)
+		b.WriteRune(CloseParen)
+	default:
+		b.WriteString(node.Value)
+	}
+}
+
+// written returns the node with the dollar signs of its absolute parts in its value.
+// They are dropped if the value is not an A1-style cell id or range anymore.
+func (n Node) written() Node {
+	corners := strings.Split(n.Value, string(RangeSeparator))
+	if len(n.Absolute) != len(corners) {
+		return n
+	}
+
+	for i, corner := range corners {
+		ref, ok := a1.Parse(corner)
+		if !ok {
+			return n
+		}
+		corners[i] = ref.Format(n.Absolute[i])
+	}
+
+	n.Value = strings.Join(corners, string(RangeSeparator))
+	return n
+}
@@ -0,0 +1,18 @@
+package parser
+
+// Rewrite returns a copy of the tree in which every variable and range,
+// including the ones nested into parentheses and function arguments,
+// is replaced by the node rewrite returns for it.
+func (t Tree) Rewrite(rewrite func(Node) Node) Tree {
+	rewritten := make(Tree, 0, len(t))
+	for _, node := range t {
+		if node.IsVar() || node.IsRange() {
+			node = rewrite(node)
+		}
+		if len(node.Children) > 0 {
+			node.Children = Tree(node.Children).Rewrite(rewrite)
+		}
+		rewritten = append(rewritten, node)
+	}
+	return rewritten
+}
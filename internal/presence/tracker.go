@@ -0,0 +1,117 @@
+package presence
+
+import (
+	"sort"
+	"sync"
+)
+
+type User struct {
+	Name   string `json:"user"`
+	CellID string `json:"cell_id,omitempty"`
+}
+
+// Session represents a single connection of a user to a sheet.
+// A user may have several sessions e.g. when the sheet is open in two tabs.
+type Session struct {
+	sheetID string
+	user    User
+	updates chan []User
+}
+
+// Updates delivers a full list of the sheet's users every time it changes.
+func (s *Session) Updates() <-chan []User {
+	return s.updates
+}
+
+// Tracker keeps track of who is connected to which sheet
+// and which cell each of the users is editing at the moment.
+type Tracker struct {
+	mu       sync.Mutex
+	sessions map[string]map[*Session]struct{}
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		sessions: make(map[string]map[*Session]struct{}),
+	}
+}
+
+func (t *Tracker) Join(sheetID, userName string) *Session {
+	s := &Session{
+		sheetID: sheetID,
+		user:    User{Name: userName},
+		updates: make(chan []User, 1),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.sessions[sheetID]; !ok {
+		t.sessions[sheetID] = make(map[*Session]struct{})
+	}
+	t.sessions[sheetID][s] = struct{}{}
+	t.broadcast(sheetID)
+
+	return s
+}
+
+func (t *Tracker) Leave(s *Session) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.sessions[s.sheetID], s)
+	if len(t.sessions[s.sheetID]) == 0 {
+		delete(t.sessions, s.sheetID)
+		return
+	}
+	t.broadcast(s.sheetID)
+}
+
+// Edit marks the cell the session's user is editing, an empty id clears the mark.
+func (t *Tracker) Edit(s *Session, cellID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s.user.CellID == cellID {
+		return
+	}
+	s.user.CellID = cellID
+	t.broadcast(s.sheetID)
+}
+
+func (t *Tracker) Users(sheetID string) []User {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.users(sheetID)
+}
+
+func (t *Tracker) users(sheetID string) []User {
+	users := make([]User, 0, len(t.sessions[sheetID]))
+	for s := range t.sessions[sheetID] {
+		users = append(users, s.user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Name == users[j].Name {
+			return users[i].CellID < users[j].CellID
+		}
+		return users[i].Name < users[j].Name
+	})
+
+	return users
+}
+
+// broadcast replaces a pending update of each session with
+// the current state, so slow sessions only get the latest one.
+func (t *Tracker) broadcast(sheetID string) {
+	users := t.users(sheetID)
+
+	for s := range t.sessions[sheetID] {
+		select {
+		case <-s.updates:
+		default:
+		}
+		s.updates <- users
+	}
+}
@@ -0,0 +1,34 @@
+package presence_test
+
+import (
+	"dev-challenge/internal/presence"
+	"reflect"
+	"testing"
+)
+
+func TestTracker(t *testing.T) {
+	tracker := presence.NewTracker()
+
+	alice := tracker.Join("sheet_1", "alice")
+	bob := tracker.Join("sheet_1", "bob")
+	tracker.Join("sheet_2", "carol")
+
+	tracker.Edit(alice, "a1")
+
+	want := []presence.User{{Name: "alice", CellID: "a1"}, {Name: "bob"}}
+
+	// only the latest state is kept for a session
+	if got := <-bob.Updates(); !reflect.DeepEqual(want, got) {
+		t.Fatalf("want (%v) got (%v)", want, got)
+	}
+
+	tracker.Leave(alice)
+
+	want = []presence.User{{Name: "bob"}}
+	if got := tracker.Users("sheet_1"); !reflect.DeepEqual(want, got) {
+		t.Fatalf("want (%v) got (%v)", want, got)
+	}
+	if got := <-bob.Updates(); !reflect.DeepEqual(want, got) {
+		t.Fatalf("want (%v) got (%v)", want, got)
+	}
+}
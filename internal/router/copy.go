@@ -0,0 +1,77 @@
+package router
+
+import (
+	"dev-challenge/internal/cell"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+func (rt *Router) handleCopy(ctx *Ctx) {
+	sheetID, okSheetID := ctx.Params["sheet_id"]
+
+	if !okSheetID {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	body := struct {
+		Source      string `json:"source"`
+		Destination string `json:"destination"`
+	}{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&body); err != nil {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.Response.Write([]byte("cannot process request body"))
+		return
+	}
+
+	pasted, failures, err := rt.cellService.Copy(strings.ToLower(sheetID), body.Source, body.Destination)
+	respondPasted(ctx, pasted, failures, err)
+}
+
+func (rt *Router) handleFill(ctx *Ctx) {
+	sheetID, okSheetID := ctx.Params["sheet_id"]
+
+	if !okSheetID {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	body := struct {
+		Range     string `json:"range"`
+		Direction string `json:"direction"`
+	}{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&body); err != nil {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.Response.Write([]byte("cannot process request body"))
+		return
+	}
+
+	if body.Direction == "" {
+		body.Direction = cell.DirectionDown
+	}
+
+	pasted, failures, err := rt.cellService.Fill(strings.ToLower(sheetID), body.Range, body.Direction)
+	respondPasted(ctx, pasted, failures, err)
+}
+
+func respondPasted(ctx *Ctx, pasted cell.Pasted, failures []cell.Failure, err error) {
+	if err != nil {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		respondJSON(ctx.Response, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if len(failures) > 0 {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		respondJSON(ctx.Response, map[string]any{
+			"message": "pasted cells cannot be evaluated",
+			"errors":  failures,
+		})
+		return
+	}
+
+	respondJSON(ctx.Response, &pasted)
+}
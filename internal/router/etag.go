@@ -0,0 +1,49 @@
+package router
+
+import (
+	"crypto/md5"
+	"dev-challenge/internal/cell"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// cellETag identifies the cell's representation. A cell deleted and created
+// again starts over with version 1, so the value and result are hashed along
+// with the version and the ETags of the former cell do not match the new one.
+func cellETag(c cell.Cell) string {
+	sum := md5.Sum([]byte(strconv.Itoa(c.Version) + strconv.Quote(c.Value) + strconv.Quote(c.Result)))
+	return strconv.Quote(hex.EncodeToString(sum[:]))
+}
+
+func sheetETag(revision string) string {
+	return strconv.Quote(revision)
+}
+
+// matchETag reports whether the etag is listed in an If-Match or If-None-Match
+// header value. If-None-Match uses weak comparison which ignores the W/ prefix.
+func matchETag(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchPrecondition turns an If-Match header into a write precondition,
+// an empty header lets the write through unconditionally.
+func ifMatchPrecondition(header string) cell.Precondition {
+	if strings.TrimSpace(header) == "" {
+		return nil
+	}
+
+	return func(current cell.Cell, exists bool) bool {
+		// If-Match never matches a missing representation, not even with "*"
+		return exists && matchETag(header, cellETag(current), false)
+	}
+}
@@ -0,0 +1,84 @@
+package router
+
+import (
+	"dev-challenge/internal/external"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// handleSubscribeCell is called by other servers whose formulas
+// reference the cell with EXTERNAL_REF to be notified about its changes.
+func (rt *Router) handleSubscribeCell(ctx *Ctx) {
+	sheetID, okSheetID := ctx.Params["sheet_id"]
+	cellID, okCellID := ctx.Params["cell_id"]
+
+	if !okSheetID || !okCellID {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	sheetID = strings.ToLower(sheetID)
+	cellID = strings.ToLower(cellID)
+
+	if _, err := rt.cellService.GetCell(sheetID, cellID); err != nil {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		ctx.Response.Write([]byte("Cell " + http.StatusText(http.StatusNotFound)))
+		return
+	}
+
+	subscription := external.Subscription{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&subscription); err != nil {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.Response.Write([]byte("cannot process request body"))
+		return
+	}
+
+	if err := rt.notifier.Subscribe(sheetID, cellID, subscription); err != nil {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		respondJSON(ctx.Response, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	respondJSON(ctx.Response, &subscription)
+}
+
+// maxNotificationSize limits the size of a notification posted to the webhook.
+const maxNotificationSize = 1 << 20
+
+// handleExternalWebhook receives notifications about changes of remote cells
+// and recalculates formulas referencing them. Only notifications signed for
+// an active subscription of this server are accepted.
+func (rt *Router) handleExternalWebhook(ctx *Ctx) {
+	body, err := io.ReadAll(http.MaxBytesReader(ctx.Response, ctx.Request.Body, maxNotificationSize))
+
+	notification := external.Notification{}
+	if err != nil || json.Unmarshal(body, &notification) != nil || notification.URL == "" {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.Response.Write([]byte("cannot process request body"))
+		return
+	}
+
+	if !rt.external.Verify(notification.URL, body, ctx.Request.Header.Get(external.SignatureHeader)) {
+		ctx.Response.WriteHeader(http.StatusForbidden)
+		ctx.Response.Write([]byte("notification is not signed for a subscription"))
+		return
+	}
+
+	// the result is fetched again rather than taken from the notification,
+	// which carries no result when the whole remote sheet has been replaced
+	rt.external.Invalidate(notification.URL)
+
+	if err := rt.cellService.RecalculateCallingWith(external.FunctionName, notification.URL); err != nil {
+		log.Println(err)
+		ctx.Response.WriteHeader(http.StatusInternalServerError)
+		ctx.Response.Write([]byte(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	ctx.Response.WriteHeader(http.StatusNoContent)
+}
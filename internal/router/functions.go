@@ -0,0 +1,92 @@
+package router
+
+import (
+	"dev-challenge/internal/function"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+func (rt *Router) handleGetFunctions(ctx *Ctx) {
+	functions, err := rt.functionService.GetFunctions()
+	if err != nil {
+		ctx.Response.WriteHeader(http.StatusInternalServerError)
+		ctx.Response.Write([]byte(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	respondJSON(ctx.Response, &functions)
+}
+
+func (rt *Router) handleGetFunction(ctx *Ctx) {
+	name, okName := ctx.Params["name"]
+
+	if !okName {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	f, err := rt.functionService.GetFunction(name)
+	if err != nil {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		ctx.Response.Write([]byte("Function " + http.StatusText(http.StatusNotFound)))
+		return
+	}
+
+	respondJSON(ctx.Response, &f)
+}
+
+func (rt *Router) handlePostFunction(ctx *Ctx) {
+	body := struct {
+		Definition string `json:"definition"`
+	}{}
+
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&body); err != nil {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.Response.Write([]byte("cannot process request body"))
+		return
+	}
+
+	if strings.Trim(body.Definition, " ") == "" {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.Response.Write([]byte("definition is required"))
+		return
+	}
+
+	f, err := rt.functionService.Define(body.Definition)
+	if err != nil {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		respondJSON(ctx.Response, map[string]string{
+			"message":    err.Error(),
+			"definition": body.Definition,
+		})
+		return
+	}
+
+	ctx.Response.WriteHeader(http.StatusCreated)
+	respondJSON(ctx.Response, &f)
+}
+
+func (rt *Router) handleDeleteFunction(ctx *Ctx) {
+	name, okName := ctx.Params["name"]
+
+	if !okName {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err := rt.functionService.Delete(name)
+	if errors.Is(err, function.ErrNotFound) {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		ctx.Response.Write([]byte("Function " + http.StatusText(http.StatusNotFound)))
+		return
+	}
+	if err != nil {
+		ctx.Response.WriteHeader(http.StatusInternalServerError)
+		ctx.Response.Write([]byte(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	ctx.Response.WriteHeader(http.StatusNoContent)
+}
@@ -1,16 +1,103 @@
 package router
 
 import (
+	"dev-challenge/internal/a1"
 	"dev-challenge/internal/cell"
+	"dev-challenge/internal/sheet"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strings"
 )
 
 func (rt *Router) establishRoutes() {
+	// the function routes are matched before the sheet and
+	// cell routes, therefore "functions" cannot be used as a sheet id
+
+	// /api/v1/functions
+	rt.Get(`^\/api\/v1\/functions$`, rt.handleGetFunctions)
+
+	// /api/v1/functions
+	rt.Post(`^\/api\/v1\/functions$`, rt.handlePostFunction)
+
+	// /api/v1/functions/:name
+	rt.Get(`^\/api\/v1\/functions\/(?P<name>\w+)$`, rt.handleGetFunction)
+
+	// /api/v1/functions/:name
+	rt.Delete(`^\/api\/v1\/functions\/(?P<name>\w+)$`, rt.handleDeleteFunction)
+
 	// /api/v1/:sheet_id
 	rt.Get(`^\/api\/v1\/(?P<sheet_id>[\w-]+)$`, rt.handleGetSheet)
 
+	// /api/v1/export.xlsx?sheet=:sheet_id&sheet=:sheet_id
+	rt.Get(`^\/api\/v1\/export\.xlsx$`, rt.handleExportWorkbook)
+
+	// /api/v1/import.xlsx
+	rt.Post(`^\/api\/v1\/import\.xlsx$`, rt.handleImportWorkbook)
+
+	// /api/v1/external/webhook, a cell "webhook" of a sheet "external" cannot be written
+	rt.Post(`^\/api\/v1\/external\/webhook$`, rt.handleExternalWebhook)
+
+	// /api/v1/:sheet_id/names/:name
+	rt.Get(`^\/api\/v1\/(?P<sheet_id>[\w-]+)\/names\/(?P<name>\w+)$`, rt.handleGetName)
+
+	// /api/v1/:sheet_id/names/:name
+	rt.Post(`^\/api\/v1\/(?P<sheet_id>[\w-]+)\/names\/(?P<name>\w+)$`, rt.handlePostName)
+
+	// /api/v1/:sheet_id/names/:name
+	rt.Delete(`^\/api\/v1\/(?P<sheet_id>[\w-]+)\/names\/(?P<name>\w+)$`, rt.handleDeleteName)
+
+	// /api/v1/:sheet_id/:cell_id/subscribe
+	rt.Post(`^\/api\/v1\/(?P<sheet_id>[\w-]+)\/(?P<cell_id>[\w-]+)\/subscribe$`, rt.handleSubscribeCell)
+
+	// /api/v1/:sheet_id/:cell_id/explain
+	rt.Get(`^\/api\/v1\/(?P<sheet_id>[\w-]+)\/(?P<cell_id>[\w-]+)\/explain$`, rt.handleExplainCell)
+
+	// /api/v1/:sheet_id/:cell_id/rename
+	rt.Post(`^\/api\/v1\/(?P<sheet_id>[\w-]+)\/(?P<cell_id>[\w-]+)\/rename$`, rt.handleRenameCell)
+
+	// /api/v1/:sheet_id/rows/insert, /api/v1/:sheet_id/columns/delete and so on
+	rt.Post(`^\/api\/v1\/(?P<sheet_id>[\w-]+)\/(?P<dimension>rows|columns)\/(?P<operation>insert|delete)$`, rt.handleShift)
+
+	// the routes below are matched before the cell routes,
+	// therefore "events", "ws", "import", "snapshot", "names", "evaluate",
+	// "copy" and "fill" cannot be used as cell ids
+
+	// /api/v1/:sheet_id/names
+	rt.Get(`^\/api\/v1\/(?P<sheet_id>[\w-]+)\/names$`, rt.handleGetNames)
+
+	// /api/v1/:sheet_id/events
+	rt.Get(`^\/api\/v1\/(?P<sheet_id>[\w-]+)\/events$`, rt.handleSheetEvents)
+
+	// /api/v1/:sheet_id/ws
+	rt.Get(`^\/api\/v1\/(?P<sheet_id>[\w-]+)\/ws$`, rt.handleSheetSocket)
+
+	// /api/v1/:sheet_id/export.csv
+	rt.Get(`^\/api\/v1\/(?P<sheet_id>[\w-]+)\/export\.csv$`, rt.handleExportCSV)
+
+	// /api/v1/:sheet_id/export.xlsx
+	rt.Get(`^\/api\/v1\/(?P<sheet_id>[\w-]+)\/export\.xlsx$`, rt.handleExportWorkbook)
+
+	// /api/v1/:sheet_id/snapshot
+	rt.Get(`^\/api\/v1\/(?P<sheet_id>[\w-]+)\/snapshot$`, rt.handleGetSnapshot)
+
+	// /api/v1/:sheet_id/snapshot
+	rt.Put(`^\/api\/v1\/(?P<sheet_id>[\w-]+)\/snapshot$`, rt.handlePutSnapshot)
+
+	// /api/v1/:sheet_id/import
+	rt.Post(`^\/api\/v1\/(?P<sheet_id>[\w-]+)\/import$`, rt.handleImportCSV)
+
+	// /api/v1/:sheet_id/evaluate
+	rt.Post(`^\/api\/v1\/(?P<sheet_id>[\w-]+)\/evaluate$`, rt.handleEvaluate)
+
+	// /api/v1/:sheet_id/copy
+	rt.Post(`^\/api\/v1\/(?P<sheet_id>[\w-]+)\/copy$`, rt.handleCopy)
+
+	// /api/v1/:sheet_id/fill
+	rt.Post(`^\/api\/v1\/(?P<sheet_id>[\w-]+)\/fill$`, rt.handleFill)
+
 	// /api/v1/:sheet_id/:cell_id
 	rt.Get(`^\/api\/v1\/(?P<sheet_id>[\w-]+)\/(?P<cell_id>[\w-]+)$`, rt.handleGetCell)
 
@@ -37,9 +124,88 @@ func (rt *Router) handleGetCell(ctx *Ctx) {
 		return
 	}
 
+	etag := cellETag(cell)
+	ctx.Response.Header().Set("ETag", etag)
+
+	if matchETag(ctx.Request.Header.Get("If-None-Match"), etag, true) {
+		ctx.Response.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	respondJSON(ctx.Response, &cell)
 }
 
+func (rt *Router) handleExplainCell(ctx *Ctx) {
+	sheetID, okSheetID := ctx.Params["sheet_id"]
+	cellID, okCellID := ctx.Params["cell_id"]
+
+	if !okSheetID || !okCellID {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	explanation, err := rt.cellService.Explain(strings.ToLower(sheetID), strings.ToLower(cellID))
+	if errors.Is(err, cell.ErrNotFound) {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		ctx.Response.Write([]byte("Cell " + http.StatusText(http.StatusNotFound)))
+		return
+	}
+	if err != nil {
+		ctx.Response.WriteHeader(http.StatusInternalServerError)
+		ctx.Response.Write([]byte(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	respondJSON(ctx.Response, &explanation)
+}
+
+func (rt *Router) handleRenameCell(ctx *Ctx) {
+	sheetID, okSheetID := ctx.Params["sheet_id"]
+	cellID, okCellID := ctx.Params["cell_id"]
+
+	if !okSheetID || !okCellID {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	body := struct {
+		CellID string `json:"cell_id"`
+	}{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&body); err != nil {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.Response.Write([]byte("cannot process request body"))
+		return
+	}
+
+	if strings.Trim(body.CellID, " ") == "" {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.Response.Write([]byte("cell_id is required"))
+		return
+	}
+
+	renamed, err := rt.cellService.Rename(strings.ToLower(sheetID), strings.ToLower(cellID), body.CellID)
+	switch {
+	case errors.Is(err, cell.ErrNotFound):
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		ctx.Response.Write([]byte("Cell " + http.StatusText(http.StatusNotFound)))
+		return
+	case errors.Is(err, cell.ErrCellExists) || errors.Is(err, cell.ErrVersionConflict) || errors.Is(err, cell.ErrPreconditionFailed):
+		ctx.Response.WriteHeader(http.StatusConflict)
+		respondJSON(ctx.Response, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	case err != nil:
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		respondJSON(ctx.Response, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	respondJSON(ctx.Response, &renamed)
+}
+
 func (rt *Router) handleGetSheet(ctx *Ctx) {
 	sheetID, okSheetID := ctx.Params["sheet_id"]
 
@@ -50,20 +216,119 @@ func (rt *Router) handleGetSheet(ctx *Ctx) {
 
 	sheetID = strings.ToLower(sheetID)
 
-	sheet, err := rt.sheetService.GetSheet(sheetID)
+	query := ctx.Request.URL.Query()
+	view := query.Get("view")
+	if view != "" && view != sheet.ViewGrid {
+		ctx.Response.WriteHeader(http.StatusBadRequest)
+		ctx.Response.Write([]byte("view must be grid"))
+		return
+	}
+
+	var area *a1.Range
+	if value := query.Get("range"); value != "" {
+		r, ok := a1.ParseRange(strings.ToLower(value))
+		if view != sheet.ViewGrid || !ok {
+			ctx.Response.WriteHeader(http.StatusBadRequest)
+			ctx.Response.Write([]byte("range must be an A1-style range of the grid view"))
+			return
+		}
+		area = &r
+	}
+
+	pageQuery, paged, err := parsePageQuery(query)
+	if err == nil && paged && view == sheet.ViewGrid {
+		err = errors.New("the grid view cannot be paged")
+	}
+	if err != nil {
+		ctx.Response.WriteHeader(http.StatusBadRequest)
+		ctx.Response.Write([]byte(err.Error()))
+		return
+	}
+
+	revision, err := rt.sheetService.GetRevision(sheetID)
 	if err != nil {
 		ctx.Response.WriteHeader(http.StatusInternalServerError)
 		ctx.Response.Write([]byte(http.StatusText(http.StatusInternalServerError)))
 		return
 	}
 
-	if len(sheet) == 0 {
+	// the sheet is either JSON or NDJSON, see below
+	ctx.Response.Header().Set("Vary", "Accept")
+
+	if revision != "" {
+		etag := sheetETag(revision)
+		ctx.Response.Header().Set("ETag", etag)
+
+		// revalidation does not need to load any cells
+		if matchETag(ctx.Request.Header.Get("If-None-Match"), etag, true) {
+			ctx.Response.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	if view == sheet.ViewGrid {
+		rt.respondGrid(ctx, sheetID, area)
+		return
+	}
+
+	// a sheet without cells has no revision
+	if revision == "" {
 		ctx.Response.WriteHeader(http.StatusNotFound)
 		ctx.Response.Write([]byte("Sheet " + http.StatusText(http.StatusNotFound)))
 		return
 	}
 
-	respondJSON(ctx.Response, &sheet)
+	if paged {
+		rt.respondPage(ctx, sheetID, pageQuery)
+		return
+	}
+
+	format := sheet.FormatJSON
+	if acceptsNDJSON(ctx.Request.Header.Get("Accept")) {
+		format = sheet.FormatNDJSON
+		ctx.Response.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		ctx.Response.Header().Set("Content-Type", "application/json")
+	}
+
+	// the status has been sent with the first cells, a failure can only cut the response short
+	if err := rt.sheetService.WriteSheet(sheetID, format, ctx.Response); err != nil {
+		log.Println(err)
+	}
+}
+
+// acceptsNDJSON tells if the Accept header asks for NDJSON rather than JSON.
+func acceptsNDJSON(accept string) bool {
+	for _, mediaType := range strings.Split(accept, ",") {
+		mediaType, _, _ = strings.Cut(mediaType, ";")
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case "application/x-ndjson", "application/ndjson":
+			return true
+		}
+	}
+	return false
+}
+
+func (rt *Router) respondGrid(ctx *Ctx, sheetID string, area *a1.Range) {
+	grid, err := rt.sheetService.GetGrid(sheetID, area)
+	switch {
+	case errors.Is(err, cell.ErrNotFound):
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		ctx.Response.Write([]byte("Sheet " + http.StatusText(http.StatusNotFound)))
+		return
+	case errors.Is(err, sheet.ErrGridTooLarge):
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		respondJSON(ctx.Response, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	case err != nil:
+		ctx.Response.WriteHeader(http.StatusInternalServerError)
+		ctx.Response.Write([]byte(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	respondJSON(ctx.Response, &grid)
 }
 
 func (rt *Router) handlePostCell(ctx *Ctx) {
@@ -76,8 +341,8 @@ func (rt *Router) handlePostCell(ctx *Ctx) {
 	}
 
 	c := cell.Cell{
-		CellID:  cellID,
-		SheetID: sheetID,
+		CellID:  strings.ToLower(cellID),
+		SheetID: strings.ToLower(sheetID),
 	}
 
 	if err := json.NewDecoder(ctx.Request.Body).Decode(&c); err != nil {
@@ -92,17 +357,111 @@ func (rt *Router) handlePostCell(ctx *Ctx) {
 		return
 	}
 
-	result, err := rt.cellService.UpsertCell(c)
+	result, err := rt.cellService.UpsertCellIf(c, ifMatchPrecondition(ctx.Request.Header.Get("If-Match")))
+	if errors.Is(err, cell.ErrPreconditionFailed) || errors.Is(err, cell.ErrVersionConflict) {
+		ctx.Response.WriteHeader(http.StatusPreconditionFailed)
+		ctx.Response.Write([]byte(http.StatusText(http.StatusPreconditionFailed)))
+		return
+	}
 	if err != nil {
 		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
 		respondJSON(ctx.Response, map[string]string{
 			"message": err.Error(),
 			"value":   c.Value,
-			"result":  "ERROR",
+			"result":  cell.ResultError,
 		})
 		return
 	}
 
+	ctx.Response.Header().Set("ETag", cellETag(result))
 	ctx.Response.WriteHeader(http.StatusCreated)
 	respondJSON(ctx.Response, &result)
 }
+
+// handleEvaluate evaluates a value against the sheet like a cell would, without writing it.
+func (rt *Router) handleEvaluate(ctx *Ctx) {
+	sheetID, okSheetID := ctx.Params["sheet_id"]
+
+	if !okSheetID {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	c := cell.Cell{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&c); err != nil {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.Response.Write([]byte("cannot process request body"))
+		return
+	}
+
+	if strings.Trim(c.Value, " ") == "" {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.Response.Write([]byte("value is required"))
+		return
+	}
+
+	result, err := rt.cellService.Evaluate(strings.ToLower(sheetID), c.Value)
+	var expressionErr *cell.ExpressionError
+	if errors.As(err, &expressionErr) {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		respondJSON(ctx.Response, map[string]any{
+			"message": expressionErr.Error(),
+			"value":   c.Value,
+			"result":  cell.ResultError,
+			"error":   expressionErr,
+		})
+		return
+	}
+	if err != nil {
+		ctx.Response.WriteHeader(http.StatusInternalServerError)
+		ctx.Response.Write([]byte(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	respondJSON(ctx.Response, &result)
+}
+
+func (rt *Router) handleSheetEvents(ctx *Ctx) {
+	sheetID, okSheetID := ctx.Params["sheet_id"]
+
+	if !okSheetID {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := ctx.Response.(http.Flusher)
+	if !ok {
+		ctx.Response.WriteHeader(http.StatusInternalServerError)
+		ctx.Response.Write([]byte("streaming is not supported"))
+		return
+	}
+
+	sheetID = strings.ToLower(sheetID)
+
+	sheetEvents, unsubscribe := rt.eventBus.Subscribe(sheetID)
+	defer unsubscribe()
+
+	ctx.Response.Header().Set("Content-Type", "text/event-stream")
+	ctx.Response.Header().Set("Cache-Control", "no-cache")
+	ctx.Response.Header().Set("Connection", "keep-alive")
+	ctx.Response.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case e := <-sheetEvents:
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			if _, err := fmt.Fprintf(ctx.Response, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
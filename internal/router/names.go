@@ -0,0 +1,109 @@
+package router
+
+import (
+	"dev-challenge/internal/cell"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+func (rt *Router) handleGetNames(ctx *Ctx) {
+	sheetID, okSheetID := ctx.Params["sheet_id"]
+
+	if !okSheetID {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	names, err := rt.cellService.GetNames(strings.ToLower(sheetID))
+	if err != nil {
+		ctx.Response.WriteHeader(http.StatusInternalServerError)
+		ctx.Response.Write([]byte(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	respondJSON(ctx.Response, &names)
+}
+
+func (rt *Router) handleGetName(ctx *Ctx) {
+	sheetID, okSheetID := ctx.Params["sheet_id"]
+	name, okName := ctx.Params["name"]
+
+	if !okSheetID || !okName {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	n, err := rt.cellService.GetName(strings.ToLower(sheetID), name)
+	if err != nil {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		ctx.Response.Write([]byte("Name " + http.StatusText(http.StatusNotFound)))
+		return
+	}
+
+	respondJSON(ctx.Response, &n)
+}
+
+func (rt *Router) handlePostName(ctx *Ctx) {
+	sheetID, okSheetID := ctx.Params["sheet_id"]
+	name, okName := ctx.Params["name"]
+
+	if !okSheetID || !okName {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	n := cell.Name{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&n); err != nil {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.Response.Write([]byte("cannot process request body"))
+		return
+	}
+
+	if strings.Trim(n.Value, " ") == "" {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.Response.Write([]byte("value is required"))
+		return
+	}
+
+	n.SheetID = sheetID
+	n.Name = name
+
+	result, err := rt.cellService.UpsertName(n)
+	if err != nil {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		respondJSON(ctx.Response, map[string]string{
+			"message": err.Error(),
+			"value":   n.Value,
+		})
+		return
+	}
+
+	ctx.Response.WriteHeader(http.StatusCreated)
+	respondJSON(ctx.Response, &result)
+}
+
+func (rt *Router) handleDeleteName(ctx *Ctx) {
+	sheetID, okSheetID := ctx.Params["sheet_id"]
+	name, okName := ctx.Params["name"]
+
+	if !okSheetID || !okName {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err := rt.cellService.DeleteName(sheetID, name)
+	if errors.Is(err, cell.ErrNotFound) {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		ctx.Response.Write([]byte("Name " + http.StatusText(http.StatusNotFound)))
+		return
+	}
+	if err != nil {
+		ctx.Response.WriteHeader(http.StatusInternalServerError)
+		ctx.Response.Write([]byte(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	ctx.Response.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,114 @@
+package router
+
+import (
+	"dev-challenge/internal/cell"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// pageParams are the query parameters which select a page of a sheet instead of all of its cells.
+var pageParams = []string{"limit", "cursor", "prefix", "has_formula", "error", "fields"}
+
+// pageCell is a cell of a page with only the selected fields.
+type pageCell struct {
+	CellID     string  `json:"cell_id"`
+	Value      *string `json:"value,omitempty"`
+	Result     *string `json:"result,omitempty"`
+	Normalized *string `json:"normalized,omitempty"`
+}
+
+type page struct {
+	Cells      []pageCell `json:"cells"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// parsePageQuery reads the page parameters, ok is false if none of them is given.
+func parsePageQuery(values url.Values) (query cell.Query, ok bool, err error) {
+	for _, param := range pageParams {
+		if values.Has(param) {
+			ok = true
+		}
+	}
+	if !ok {
+		return cell.Query{}, false, nil
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil {
+			return cell.Query{}, true, errors.New("limit must be a number")
+		}
+	}
+
+	query.Cursor = strings.ToLower(values.Get("cursor"))
+	query.Prefix = strings.ToLower(values.Get("prefix"))
+
+	if query.HasFormula, err = parseBoolParam(values, "has_formula"); err != nil {
+		return cell.Query{}, true, err
+	}
+	if query.Error, err = parseBoolParam(values, "error"); err != nil {
+		return cell.Query{}, true, err
+	}
+
+	if fields := values.Get("fields"); fields != "" {
+		for _, field := range strings.Split(fields, ",") {
+			query.Fields = append(query.Fields, strings.TrimSpace(field))
+		}
+	}
+
+	return query, true, nil
+}
+
+func parseBoolParam(values url.Values, param string) (*bool, error) {
+	value := values.Get(param)
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be either true or false", param)
+	}
+	return &parsed, nil
+}
+
+func (rt *Router) respondPage(ctx *Ctx, sheetID string, query cell.Query) {
+	result, err := rt.sheetService.GetPage(sheetID, query)
+	if errors.Is(err, cell.ErrInvalidQuery) {
+		ctx.Response.WriteHeader(http.StatusBadRequest)
+		ctx.Response.Write([]byte(err.Error()))
+		return
+	}
+	if err != nil {
+		ctx.Response.WriteHeader(http.StatusInternalServerError)
+		ctx.Response.Write([]byte(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	fields := query.Fields
+	if len(fields) == 0 {
+		fields = []string{cell.FieldValue, cell.FieldResult, cell.FieldNormalized}
+	}
+
+	p := page{Cells: make([]pageCell, 0, len(result.Cells)), NextCursor: result.NextCursor}
+	for i := range result.Cells {
+		c := &result.Cells[i]
+		pc := pageCell{CellID: c.CellID}
+		for _, field := range fields {
+			switch field {
+			case cell.FieldValue:
+				pc.Value = &c.Value
+			case cell.FieldResult:
+				pc.Result = &c.Result
+			case cell.FieldNormalized:
+				pc.Normalized = &c.Normalized
+			}
+		}
+		p.Cells = append(p.Cells, pc)
+	}
+
+	respondJSON(ctx.Response, &p)
+}
@@ -2,6 +2,10 @@ package router
 
 import (
 	"dev-challenge/internal/cell"
+	"dev-challenge/internal/events"
+	"dev-challenge/internal/external"
+	"dev-challenge/internal/function"
+	"dev-challenge/internal/presence"
 	"dev-challenge/internal/sheet"
 	"dev-challenge/internal/utils"
 	"encoding/json"
@@ -24,17 +28,31 @@ type handler struct {
 }
 
 type Router struct {
-	sheetService *sheet.Service
-	cellService  *cell.Service
+	sheetService    *sheet.Service
+	cellService     *cell.Service
+	functionService *function.Service
+	eventBus        *events.Bus
+	presence        *presence.Tracker
+	external        *external.Client
+	notifier        *external.Notifier
+
+	// origins of pages other than the service's own which may open websockets
+	allowedOrigins []string
 
 	// http method to slice of handlers map
 	handlers map[string][]handler
 }
 
-func New(sheetService *sheet.Service, cellService *cell.Service) *Router {
+func New(sheetService *sheet.Service, cellService *cell.Service, functionService *function.Service, eventBus *events.Bus, presenceTracker *presence.Tracker, externalClient *external.Client, notifier *external.Notifier, allowedOrigins []string) *Router {
 	rt := &Router{
-		sheetService: sheetService,
-		cellService:  cellService,
+		sheetService:    sheetService,
+		cellService:     cellService,
+		functionService: functionService,
+		eventBus:        eventBus,
+		presence:        presenceTracker,
+		external:        externalClient,
+		notifier:        notifier,
+		allowedOrigins:  allowedOrigins,
 
 		handlers: make(map[string][]handler),
 	}
@@ -98,6 +116,14 @@ func (rt *Router) Post(pattern string, executor Executor) {
 	rt.regisetHandler(http.MethodPost, pattern, executor)
 }
 
+func (rt *Router) Put(pattern string, executor Executor) {
+	rt.regisetHandler(http.MethodPut, pattern, executor)
+}
+
+func (rt *Router) Delete(pattern string, executor Executor) {
+	rt.regisetHandler(http.MethodDelete, pattern, executor)
+}
+
 func respondJSON(w http.ResponseWriter, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(v); err != nil {
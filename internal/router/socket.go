@@ -0,0 +1,192 @@
+package router
+
+import (
+	"dev-challenge/internal/cell"
+	"dev-challenge/internal/presence"
+	"dev-challenge/internal/websocket"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	socketMessageEdit  = "edit"
+	socketMessageFocus = "focus"
+	socketMessageBlur  = "blur"
+
+	socketMessageAck      = "ack"
+	socketMessageError    = "error"
+	socketMessagePresence = "presence"
+)
+
+// anonymousUsers numbers the users which connected without a name.
+var anonymousUsers atomic.Int64
+
+// socketMessage is a frame exchanged over the sheet websocket in both directions.
+type socketMessage struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	CellID  string          `json:"cell_id,omitempty"`
+	Value   string          `json:"value,omitempty"`
+	Result  string          `json:"result,omitempty"`
+	Version int             `json:"version,omitempty"`
+	Message string          `json:"message,omitempty"`
+	Users   []presence.User `json:"users,omitempty"`
+}
+
+func (rt *Router) handleSheetSocket(ctx *Ctx) {
+	sheetID, okSheetID := ctx.Params["sheet_id"]
+
+	if !okSheetID {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	conn, err := websocket.Upgrade(ctx.Response, ctx.Request, rt.allowedOrigins)
+	if errors.Is(err, websocket.ErrForbiddenOrigin) {
+		ctx.Response.WriteHeader(http.StatusForbidden)
+		ctx.Response.Write([]byte(err.Error()))
+		return
+	}
+	if err != nil {
+		ctx.Response.WriteHeader(http.StatusBadRequest)
+		ctx.Response.Write([]byte(err.Error()))
+		return
+	}
+	defer conn.Close()
+
+	sheetID = strings.ToLower(sheetID)
+
+	userName := ctx.Request.URL.Query().Get("user")
+	if userName == "" {
+		userName = fmt.Sprintf("anonymous_%d", anonymousUsers.Add(1))
+	}
+
+	// subscribe before joining so that the own presence update is not missed
+	sheetEvents, unsubscribe := rt.eventBus.Subscribe(sheetID)
+	defer unsubscribe()
+
+	session := rt.presence.Join(sheetID, userName)
+	defer rt.presence.Leave(session)
+
+	incoming := make(chan socketMessage)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(incoming)
+
+		for {
+			data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			message := socketMessage{}
+			if err := json.Unmarshal(data, &message); err != nil {
+				writeSocketMessage(conn, socketMessage{
+					Type:    socketMessageError,
+					Message: "cannot process message",
+				})
+				continue
+			}
+
+			select {
+			case incoming <- message:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case message, ok := <-incoming:
+			if !ok {
+				return
+			}
+			rt.handleSocketMessage(conn, session, sheetID, message)
+
+		case users := <-session.Updates():
+			writeSocketMessage(conn, socketMessage{
+				Type:  socketMessagePresence,
+				Users: users,
+			})
+
+		case e := <-sheetEvents:
+			writeSocketMessage(conn, socketMessage{
+				Type:    e.Type,
+				CellID:  e.CellID,
+				Value:   e.Value,
+				Result:  e.Result,
+				Version: e.Version,
+			})
+		}
+	}
+}
+
+func (rt *Router) handleSocketMessage(conn *websocket.Conn, session *presence.Session, sheetID string, message socketMessage) {
+	switch message.Type {
+	case socketMessageFocus:
+		rt.presence.Edit(session, strings.ToLower(message.CellID))
+
+	case socketMessageBlur:
+		rt.presence.Edit(session, "")
+
+	case socketMessageEdit:
+		reply := socketMessage{
+			ID:     message.ID,
+			CellID: strings.ToLower(message.CellID),
+			Value:  message.Value,
+		}
+
+		if reply.CellID == "" || strings.Trim(message.Value, " ") == "" {
+			reply.Type = socketMessageError
+			reply.Result = cell.ResultError
+			reply.Message = "cell_id and value are required"
+			writeSocketMessage(conn, reply)
+			return
+		}
+
+		result, err := rt.cellService.UpsertCell(cell.Cell{
+			CellID:  reply.CellID,
+			SheetID: sheetID,
+			Value:   message.Value,
+		})
+		if err != nil {
+			reply.Type = socketMessageError
+			reply.Result = cell.ResultError
+			reply.Message = err.Error()
+			writeSocketMessage(conn, reply)
+			return
+		}
+
+		reply.Type = socketMessageAck
+		reply.Result = result.Result
+		reply.Version = result.Version
+		writeSocketMessage(conn, reply)
+
+	default:
+		writeSocketMessage(conn, socketMessage{
+			Type:    socketMessageError,
+			ID:      message.ID,
+			Message: "unknown message type",
+		})
+	}
+}
+
+func writeSocketMessage(conn *websocket.Conn, message socketMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if err := conn.WriteMessage(data); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,79 @@
+package router
+
+import (
+	"dev-challenge/internal/a1"
+	"dev-challenge/internal/cell"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+func (rt *Router) handleShift(ctx *Ctx) {
+	sheetID, okSheetID := ctx.Params["sheet_id"]
+	dimension, okDimension := ctx.Params["dimension"]
+	operation, okOperation := ctx.Params["operation"]
+
+	if !okSheetID || !okDimension || !okOperation {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// columns may be given by their letters, e.g. {"at": "c"}
+	body := struct {
+		At    json.RawMessage `json:"at"`
+		Count *int            `json:"count"`
+	}{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&body); err != nil {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.Response.Write([]byte("cannot process request body"))
+		return
+	}
+
+	shift := cell.Shift{Dimension: dimension, Count: 1, Delete: operation == "delete"}
+	if body.Count != nil {
+		shift.Count = *body.Count
+	}
+
+	at, ok := parsePosition(body.At, dimension)
+	if !ok {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		respondJSON(ctx.Response, map[string]string{
+			"message": "at must be a row number or a column number or letters",
+		})
+		return
+	}
+	shift.At = at
+
+	restructured, err := rt.cellService.Shift(strings.ToLower(sheetID), shift)
+	switch {
+	case errors.Is(err, cell.ErrVersionConflict) || errors.Is(err, cell.ErrPreconditionFailed):
+		ctx.Response.WriteHeader(http.StatusConflict)
+		respondJSON(ctx.Response, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	case err != nil:
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		respondJSON(ctx.Response, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	respondJSON(ctx.Response, &restructured)
+}
+
+// parsePosition reads a one-based row or column number, columns may also be given by their letters.
+func parsePosition(raw json.RawMessage, dimension string) (int, bool) {
+	number := 0
+	if err := json.Unmarshal(raw, &number); err == nil {
+		return number, true
+	}
+
+	letters := ""
+	if dimension != cell.DimensionColumns || json.Unmarshal(raw, &letters) != nil {
+		return 0, false
+	}
+	return a1.ColumnIndex(letters)
+}
@@ -0,0 +1,228 @@
+package router
+
+import (
+	"bytes"
+	"dev-challenge/internal/cell"
+	"dev-challenge/internal/sheet"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// maxImportSize limits the size of a file uploaded to import a sheet.
+const maxImportSize = 10 << 20
+
+func (rt *Router) handleExportCSV(ctx *Ctx) {
+	sheetID, okSheetID := ctx.Params["sheet_id"]
+
+	if !okSheetID {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	sheetID = strings.ToLower(sheetID)
+
+	content := ctx.Request.URL.Query().Get("content")
+	if content == "" {
+		content = sheet.ContentResults
+	}
+
+	if content != sheet.ContentResults && content != sheet.ContentValues {
+		ctx.Response.WriteHeader(http.StatusBadRequest)
+		ctx.Response.Write([]byte("content must be either values or results"))
+		return
+	}
+
+	// buffered to be able to respond with an error status if the export fails
+	buffer := bytes.Buffer{}
+	err := rt.sheetService.ExportCSV(sheetID, content, &buffer)
+	if errors.Is(err, cell.ErrNotFound) {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		ctx.Response.Write([]byte("Sheet " + http.StatusText(http.StatusNotFound)))
+		return
+	}
+	if errors.Is(err, sheet.ErrExportTooLarge) {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		respondJSON(ctx.Response, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		ctx.Response.WriteHeader(http.StatusInternalServerError)
+		ctx.Response.Write([]byte(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	ctx.Response.Header().Set("Content-Type", "text/csv")
+	ctx.Response.Header().Set("Content-Disposition", "attachment; filename=\""+sheetID+".csv\"")
+	ctx.Response.Write(buffer.Bytes())
+}
+
+func (rt *Router) handleImportCSV(ctx *Ctx) {
+	sheetID, okSheetID := ctx.Params["sheet_id"]
+
+	if !okSheetID {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	sheetID = strings.ToLower(sheetID)
+
+	body := http.MaxBytesReader(ctx.Response, ctx.Request.Body, maxImportSize)
+	report, err := rt.sheetService.ImportCSV(sheetID, body)
+	if err != nil {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		respondJSON(ctx.Response, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	respondJSON(ctx.Response, &report)
+}
+
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// handleExportWorkbook exports either the sheet from the path
+// or every sheet listed in the "sheet" query parameters.
+func (rt *Router) handleExportWorkbook(ctx *Ctx) {
+	sheetIDs := ctx.Request.URL.Query()["sheet"]
+	if sheetID, ok := ctx.Params["sheet_id"]; ok {
+		sheetIDs = []string{sheetID}
+	}
+
+	if len(sheetIDs) == 0 {
+		ctx.Response.WriteHeader(http.StatusBadRequest)
+		ctx.Response.Write([]byte("at least one sheet is required"))
+		return
+	}
+
+	for i, sheetID := range sheetIDs {
+		sheetIDs[i] = strings.ToLower(sheetID)
+	}
+
+	buffer := bytes.Buffer{}
+	err := rt.sheetService.ExportXLSX(sheetIDs, &buffer)
+	if errors.Is(err, cell.ErrNotFound) {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		ctx.Response.Write([]byte(err.Error()))
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		ctx.Response.WriteHeader(http.StatusInternalServerError)
+		ctx.Response.Write([]byte(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	ctx.Response.Header().Set("Content-Type", xlsxContentType)
+	ctx.Response.Header().Set("Content-Disposition", "attachment; filename=\""+sheetIDs[0]+".xlsx\"")
+	ctx.Response.Write(buffer.Bytes())
+}
+
+func (rt *Router) handleImportWorkbook(ctx *Ctx) {
+	// zip archives need random access, so the file is read into memory
+	data, err := io.ReadAll(http.MaxBytesReader(ctx.Response, ctx.Request.Body, maxImportSize))
+	tooLarge := &http.MaxBytesError{}
+	if errors.As(err, &tooLarge) {
+		ctx.Response.WriteHeader(http.StatusRequestEntityTooLarge)
+		ctx.Response.Write([]byte(http.StatusText(http.StatusRequestEntityTooLarge)))
+		return
+	}
+	if err != nil {
+		ctx.Response.WriteHeader(http.StatusBadRequest)
+		ctx.Response.Write([]byte("cannot read request body"))
+		return
+	}
+
+	report, err := rt.sheetService.ImportXLSX(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		respondJSON(ctx.Response, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	respondJSON(ctx.Response, &report)
+}
+
+func (rt *Router) handleGetSnapshot(ctx *Ctx) {
+	sheetID, okSheetID := ctx.Params["sheet_id"]
+
+	if !okSheetID {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	sheetID = strings.ToLower(sheetID)
+
+	snapshot, err := rt.sheetService.GetSnapshot(sheetID)
+	if errors.Is(err, cell.ErrNotFound) {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		ctx.Response.Write([]byte("Sheet " + http.StatusText(http.StatusNotFound)))
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		ctx.Response.WriteHeader(http.StatusInternalServerError)
+		ctx.Response.Write([]byte(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	ctx.Response.Header().Set("ETag", sheetETag(snapshot.Revision))
+	respondJSON(ctx.Response, &snapshot)
+}
+
+func (rt *Router) handlePutSnapshot(ctx *Ctx) {
+	sheetID, okSheetID := ctx.Params["sheet_id"]
+
+	if !okSheetID {
+		ctx.Response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	sheetID = strings.ToLower(sheetID)
+
+	snapshot := sheet.Snapshot{}
+	body := http.MaxBytesReader(ctx.Response, ctx.Request.Body, maxImportSize)
+	if err := json.NewDecoder(body).Decode(&snapshot); err != nil {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.Response.Write([]byte("cannot process request body"))
+		return
+	}
+
+	restored, failures, err := rt.sheetService.RestoreSnapshot(sheetID, snapshot)
+	if errors.Is(err, sheet.ErrInvalidSnapshot) {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		respondJSON(ctx.Response, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		ctx.Response.WriteHeader(http.StatusInternalServerError)
+		ctx.Response.Write([]byte(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	if len(failures) > 0 {
+		ctx.Response.WriteHeader(http.StatusUnprocessableEntity)
+		respondJSON(ctx.Response, map[string]any{
+			"message": "snapshot contains cells which cannot be evaluated",
+			"errors":  failures,
+		})
+		return
+	}
+
+	if restored.Revision != "" {
+		ctx.Response.Header().Set("ETag", sheetETag(restored.Revision))
+	}
+	respondJSON(ctx.Response, &restored)
+}
@@ -0,0 +1,163 @@
+package sheet
+
+import (
+	"dev-challenge/internal/a1"
+	"dev-challenge/internal/cell"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	ContentValues  = "values"
+	ContentResults = "results"
+)
+
+// MaxExportFields limits the fields of an exported grid, which starts from A1 however
+// far the cells are, so that a single distant cell cannot make the export endless.
+const MaxExportFields = 10000000
+
+var ErrExportTooLarge = errors.New("sheet is too large to export")
+
+type ImportReport struct {
+	Imported int            `json:"imported"`
+	Errors   []cell.Failure `json:"errors"`
+}
+
+// ExportCSV writes A1-style cells of the sheet as a grid, where the first record
+// is row 1 and the first field is column A. Other cells cannot be placed on
+// a grid and are left out. The content is either ContentValues or ContentResults.
+func (s *Service) ExportCSV(sheetID, content string, w io.Writer) error {
+	cells, err := s.cellService.GetCellsBySheetID(sheetID)
+	if err != nil {
+		return err
+	}
+
+	if len(cells) == 0 {
+		return cell.ErrNotFound
+	}
+
+	positioned := make(map[a1.Ref]cell.Cell)
+	bounds := a1.Ref{}
+	for _, c := range cells {
+		ref, ok := a1.Parse(c.CellID)
+		if !ok {
+			continue
+		}
+
+		positioned[ref] = c
+		if ref.Col > bounds.Col {
+			bounds.Col = ref.Col
+		}
+		if ref.Row > bounds.Row {
+			bounds.Row = ref.Row
+		}
+	}
+
+	if bounds.Row*bounds.Col > MaxExportFields {
+		return fmt.Errorf("%w: a grid up to %s has more than %d fields", ErrExportTooLarge, bounds, MaxExportFields)
+	}
+
+	writer := csv.NewWriter(w)
+	for row := 1; row <= bounds.Row; row++ {
+		record := make([]string, bounds.Col)
+		for col := 1; col <= bounds.Col; col++ {
+			c, ok := positioned[a1.Ref{Col: col, Row: row}]
+			if !ok {
+				continue
+			}
+
+			if content == ContentValues {
+				record[col-1] = c.Value
+			} else {
+				record[col-1] = c.Result
+			}
+		}
+
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// ImportCSV creates a cell for every non-empty field named by its column letter
+// and row number. Formulas are evaluated in dependency order so that they may
+// reference cells which come later in the file. Cells which cannot be evaluated
+// are reported and do not prevent the rest of the file from being imported,
+// which is written in a single transaction.
+func (s *Service) ImportCSV(sheetID string, r io.Reader) (ImportReport, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	cells := make([]cell.Cell, 0)
+	for row, record := range records {
+		for col, field := range record {
+			value := strings.TrimSpace(field)
+			if value == "" {
+				continue
+			}
+
+			cells = append(cells, cell.Cell{
+				SheetID: sheetID,
+				CellID:  a1.Ref{Col: col + 1, Row: row + 1}.String(),
+				Value:   value,
+			})
+		}
+	}
+
+	reports, err := s.importCells(cells)
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	report, ok := reports[sheetID]
+	if !ok {
+		report.Errors = make([]cell.Failure, 0)
+	}
+
+	return report, nil
+}
+
+// importCells imports cells, possibly of several sheets, with cell.Service.Import
+// and reports the outcome per sheet.
+func (s *Service) importCells(cells []cell.Cell) (map[string]ImportReport, error) {
+	imported, failures, err := s.cellService.Import(cells)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make(map[string]ImportReport)
+	report := func(sheetID string) ImportReport {
+		r, ok := reports[sheetID]
+		if !ok {
+			r = ImportReport{
+				Errors: make([]cell.Failure, 0),
+			}
+		}
+		return r
+	}
+
+	for _, c := range imported {
+		r := report(c.SheetID)
+		r.Imported++
+		reports[c.SheetID] = r
+	}
+
+	for sheetID, sheetFailures := range failures {
+		r := report(sheetID)
+		r.Errors = append(r.Errors, sheetFailures...)
+		reports[sheetID] = r
+	}
+
+	return reports, nil
+}
@@ -0,0 +1,48 @@
+package sheet_test
+
+import (
+	"bytes"
+	"dev-challenge/internal/cell"
+	"dev-challenge/internal/sheet"
+	"errors"
+	"testing"
+)
+
+// farRepo has a single cell, however far from A1 it is.
+type farRepo struct {
+	cell.Repository
+	cellID string
+}
+
+func (r farRepo) GetManyBySheetID(sheetID string) ([]cell.Cell, error) {
+	return []cell.Cell{{SheetID: sheetID, CellID: r.cellID, Value: "1", Result: "1"}}, nil
+}
+
+func TestService_ExportCSV(t *testing.T) {
+	testCases := []struct {
+		cellID string
+		want   string
+		err    error
+	}{
+		{cellID: "b2", want: ",\n,1\n"},
+		{cellID: "total", want: ""},
+		{cellID: "xfd1048576", err: sheet.ErrExportTooLarge},
+		{cellID: "a9999999999", want: ""},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.cellID, func(t *testing.T) {
+			service := sheet.NewService(cell.NewService(farRepo{cellID: test.cellID}, nil, nil))
+
+			buffer := bytes.Buffer{}
+			err := service.ExportCSV("sheet", sheet.ContentResults, &buffer)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("want (%v) got (%v)", test.err, err)
+			}
+
+			if err == nil && buffer.String() != test.want {
+				t.Fatalf("want (%q) got (%q)", test.want, buffer.String())
+			}
+		})
+	}
+}
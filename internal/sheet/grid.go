@@ -0,0 +1,107 @@
+package sheet
+
+import (
+	"dev-challenge/internal/a1"
+	"dev-challenge/internal/cell"
+	"dev-challenge/internal/evaluator"
+	"errors"
+	"fmt"
+)
+
+// ViewGrid selects the grid representation of a sheet.
+const ViewGrid = "grid"
+
+var ErrGridTooLarge = errors.New("grid is too large")
+
+// Grid lays out results of A1-style cells of a sheet by rows and columns.
+type Grid struct {
+	// Range is the area of the sheet the grid covers, e.g. "a1:f50",
+	// or an empty string if the sheet has no A1-style cells.
+	Range string `json:"range"`
+	// Columns are the letters of the columns and Rows the numbers of the rows, in order.
+	Columns []string `json:"columns"`
+	Rows    []int    `json:"rows"`
+	// Results are the results row by row, null for empty cells.
+	Results [][]*string `json:"results"`
+}
+
+// GetGrid returns the results of the cells within the area, or within
+// the smallest range containing every A1-style cell if area is nil.
+// Cells which cannot be placed on a grid, e.g. "total", are left out.
+func (s *Service) GetGrid(sheetID string, area *a1.Range) (Grid, error) {
+	cells, err := s.cellService.GetCellsBySheetID(sheetID)
+	if err != nil {
+		return Grid{}, err
+	}
+
+	if len(cells) == 0 {
+		return Grid{}, cell.ErrNotFound
+	}
+
+	positioned := make(map[a1.Ref]cell.Cell)
+	var bounds *a1.Range
+	for _, c := range cells {
+		ref, ok := a1.Parse(c.CellID)
+		if !ok {
+			continue
+		}
+		positioned[ref] = c
+
+		if bounds == nil {
+			bounds = &a1.Range{From: ref, To: ref}
+			continue
+		}
+		if ref.Col < bounds.From.Col {
+			bounds.From.Col = ref.Col
+		}
+		if ref.Row < bounds.From.Row {
+			bounds.From.Row = ref.Row
+		}
+		if ref.Col > bounds.To.Col {
+			bounds.To.Col = ref.Col
+		}
+		if ref.Row > bounds.To.Row {
+			bounds.To.Row = ref.Row
+		}
+	}
+
+	if area == nil {
+		area = bounds
+	}
+
+	grid := Grid{Columns: make([]string, 0), Rows: make([]int, 0), Results: make([][]*string, 0)}
+	if area == nil {
+		return grid, nil
+	}
+
+	// coordinates beyond the sheet could make the size overflow
+	if area.From.Col < 1 || area.From.Row < 1 || area.To.Col > a1.MaxCol || area.To.Row > a1.MaxRow ||
+		area.From.Col > area.To.Col || area.From.Row > area.To.Row {
+		return Grid{}, fmt.Errorf("%w: %s is not a range of the sheet", ErrGridTooLarge, area)
+	}
+
+	// the same limit as for ranges of formulas keeps responses of a sensible size
+	if area.Size() > evaluator.MaxRangeSize {
+		return Grid{}, fmt.Errorf("%w: %s spans more than %d cells, request a smaller range", ErrGridTooLarge, area, evaluator.MaxRangeSize)
+	}
+
+	grid.Range = area.String()
+	for col := area.From.Col; col <= area.To.Col; col++ {
+		grid.Columns = append(grid.Columns, a1.ColumnName(col))
+	}
+
+	for row := area.From.Row; row <= area.To.Row; row++ {
+		grid.Rows = append(grid.Rows, row)
+
+		results := make([]*string, area.Cols())
+		for col := area.From.Col; col <= area.To.Col; col++ {
+			if c, ok := positioned[a1.Ref{Col: col, Row: row}]; ok {
+				result := c.Result
+				results[col-area.From.Col] = &result
+			}
+		}
+		grid.Results = append(grid.Results, results)
+	}
+
+	return grid, nil
+}
@@ -0,0 +1,77 @@
+package sheet_test
+
+import (
+	"dev-challenge/internal/a1"
+	"dev-challenge/internal/cell"
+	"dev-challenge/internal/sheet"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// generatedRepo generates the cells of a sheet while they are read instead of storing them.
+type generatedRepo struct {
+	cell.Repository
+	cells int
+}
+
+func (r generatedRepo) generate(i int) cell.Cell {
+	row := strconv.Itoa(i + 1)
+	return cell.Cell{
+		SheetID:    "sheet",
+		CellID:     "b" + row,
+		Value:      "=a" + row + "*2",
+		Result:     strconv.Itoa(i * 2),
+		Normalized: "=a" + row + " * 2",
+		Version:    1,
+	}
+}
+
+func (r generatedRepo) GetManyBySheetID(sheetID string) ([]cell.Cell, error) {
+	cells := make([]cell.Cell, 0, r.cells)
+	for i := 0; i < r.cells; i++ {
+		cells = append(cells, r.generate(i))
+	}
+	return cells, nil
+}
+
+func (r generatedRepo) ForEachBySheetID(sheetID string, fn func(cell.Cell) error) error {
+	for i := 0; i < r.cells; i++ {
+		if err := fn(r.generate(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestService_GetGrid(t *testing.T) {
+	service := sheet.NewService(cell.NewService(generatedRepo{cells: 3}, nil, nil))
+
+	testCases := []struct {
+		name string
+		area *a1.Range
+		want string
+		err  error
+	}{
+		{name: "bounds", want: "b1:b3"},
+		{name: "range", area: &a1.Range{From: a1.Ref{Col: 1, Row: 1}, To: a1.Ref{Col: 3, Row: 2}}, want: "a1:c2"},
+		{name: "too large", area: &a1.Range{From: a1.Ref{Col: 1, Row: 1}, To: a1.Ref{Col: 100, Row: 10000}}, err: sheet.ErrGridTooLarge},
+		{name: "beyond the sheet", area: &a1.Range{From: a1.Ref{Col: 1, Row: 1}, To: a1.Ref{Col: 2, Row: 1 << 62}}, err: sheet.ErrGridTooLarge},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			grid, err := service.GetGrid("sheet", test.area)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("want (%v) got (%v)", test.err, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if grid.Range != test.want || len(grid.Results) != len(grid.Rows) || len(grid.Results[0]) != len(grid.Columns) {
+				t.Fatalf("unexpected grid (%+v)", grid)
+			}
+		})
+	}
+}
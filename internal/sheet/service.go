@@ -14,11 +14,12 @@ func NewService(cellService *cell.Service) *Service {
 	}
 }
 
-func (s *Service) GetSheet(sheetID string) (Sheet, error) {
-	cells, err := s.cellService.GetCellsBySheetID(sheetID)
-	if err != nil {
-		return Sheet{}, err
-	}
+// GetRevision returns a token which changes with every change made to the sheet.
+func (s *Service) GetRevision(sheetID string) (string, error) {
+	return s.cellService.GetSheetRevision(sheetID)
+}
 
-	return Sheet(cells), nil
+// GetPage returns a page of the cells of the sheet, see cell.Query.
+func (s *Service) GetPage(sheetID string, query cell.Query) (cell.Page, error) {
+	return s.cellService.GetPage(sheetID, query)
 }
@@ -1,5 +0,0 @@
-package sheet
-
-import "dev-challenge/internal/cell"
-
-type Sheet []cell.Cell
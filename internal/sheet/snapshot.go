@@ -0,0 +1,135 @@
+package sheet
+
+import (
+	"dev-challenge/internal/cell"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	SnapshotFormat  = "dev-challenge/sheet-snapshot"
+	SnapshotVersion = 1
+)
+
+var (
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+	validCellID = regexp.MustCompile(`^[\w-]+$`)
+)
+
+// Snapshot is a self-describing document holding the complete state
+// of a sheet. Cells are sorted by their ids to keep snapshots diffable.
+type Snapshot struct {
+	Format    string         `json:"format"`
+	Version   int            `json:"version"`
+	SheetID   string         `json:"sheet_id"`
+	Revision  string         `json:"revision"`
+	CreatedAt time.Time      `json:"created_at"`
+	Cells     []SnapshotCell `json:"cells"`
+}
+
+type SnapshotCell struct {
+	CellID  string `json:"cell_id"`
+	Value   string `json:"value"`
+	Result  string `json:"result"`
+	Version int    `json:"version"`
+}
+
+func (s *Service) GetSnapshot(sheetID string) (Snapshot, error) {
+	cells, err := s.cellService.GetCellsBySheetID(sheetID)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	if len(cells) == 0 {
+		return Snapshot{}, cell.ErrNotFound
+	}
+
+	revision, err := s.cellService.GetSheetRevision(sheetID)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	return newSnapshot(sheetID, revision, cells), nil
+}
+
+// RestoreSnapshot replaces the sheet with the snapshot's cells in one
+// transaction. The sheet id of the snapshot is not required to match,
+// which allows promoting a sheet under another id. Results are evaluated
+// anew, if some of them fail the sheet is left untouched.
+func (s *Service) RestoreSnapshot(sheetID string, snapshot Snapshot) (Snapshot, []cell.Failure, error) {
+	if snapshot.Format != SnapshotFormat {
+		return Snapshot{}, nil, fmt.Errorf("%w: unknown format %q", ErrInvalidSnapshot, snapshot.Format)
+	}
+
+	if snapshot.Version < 1 || snapshot.Version > SnapshotVersion {
+		return Snapshot{}, nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, snapshot.Version)
+	}
+
+	cells := make([]cell.Cell, 0, len(snapshot.Cells))
+	seen := make(map[string]bool, len(snapshot.Cells))
+	for _, snapshotCell := range snapshot.Cells {
+		cellID := strings.ToLower(snapshotCell.CellID)
+
+		if !validCellID.MatchString(cellID) {
+			return Snapshot{}, nil, fmt.Errorf("%w: invalid cell id %q", ErrInvalidSnapshot, snapshotCell.CellID)
+		}
+
+		if seen[cellID] {
+			return Snapshot{}, nil, fmt.Errorf("%w: duplicate cell id %q", ErrInvalidSnapshot, cellID)
+		}
+		seen[cellID] = true
+
+		if strings.TrimSpace(snapshotCell.Value) == "" {
+			return Snapshot{}, nil, fmt.Errorf("%w: value of %q is required", ErrInvalidSnapshot, cellID)
+		}
+
+		cells = append(cells, cell.Cell{
+			SheetID: sheetID,
+			CellID:  cellID,
+			Value:   snapshotCell.Value,
+		})
+	}
+
+	replaced, failures, err := s.cellService.ReplaceSheet(sheetID, cells)
+	if err != nil || len(failures) > 0 {
+		return Snapshot{}, failures, err
+	}
+
+	revision, err := s.cellService.GetSheetRevision(sheetID)
+	if err != nil {
+		return Snapshot{}, nil, err
+	}
+
+	return newSnapshot(sheetID, revision, replaced), nil, nil
+}
+
+func newSnapshot(sheetID, revision string, cells []cell.Cell) Snapshot {
+	snapshot := Snapshot{
+		Format:    SnapshotFormat,
+		Version:   SnapshotVersion,
+		SheetID:   sheetID,
+		Revision:  revision,
+		CreatedAt: time.Now().UTC(),
+		Cells:     make([]SnapshotCell, 0, len(cells)),
+	}
+
+	for _, c := range cells {
+		snapshot.Cells = append(snapshot.Cells, SnapshotCell{
+			CellID:  c.CellID,
+			Value:   c.Value,
+			Result:  c.Result,
+			Version: c.Version,
+		})
+	}
+
+	sort.Slice(snapshot.Cells, func(i, j int) bool {
+		return snapshot.Cells[i].CellID < snapshot.Cells[j].CellID
+	})
+
+	return snapshot
+}
@@ -0,0 +1,70 @@
+package sheet
+
+import (
+	"bufio"
+	"dev-challenge/internal/cell"
+	"encoding/json"
+	"io"
+)
+
+const (
+	// FormatJSON is an array of cells, the way the whole sheet has always been returned.
+	FormatJSON = "json"
+	// FormatNDJSON is a cell with its id per line.
+	FormatNDJSON = "ndjson"
+)
+
+// line is a cell of the NDJSON format, which lists cells with their ids.
+type line struct {
+	CellID string `json:"cell_id"`
+	cell.Cell
+}
+
+// WriteSheet streams the cells of the sheet to w as they are read from the
+// repository, so that memory usage does not depend on the size of the sheet.
+// The format is either FormatJSON or FormatNDJSON. If it fails, a part of
+// the sheet may have already been written.
+func (s *Service) WriteSheet(sheetID, format string, w io.Writer) error {
+	buffered := bufio.NewWriter(w)
+
+	if format == FormatNDJSON {
+		encoder := json.NewEncoder(buffered)
+		err := s.cellService.ForEachCell(sheetID, func(c cell.Cell) error {
+			return encoder.Encode(line{CellID: c.CellID, Cell: c})
+		})
+		if err != nil {
+			return err
+		}
+		return buffered.Flush()
+	}
+
+	if _, err := buffered.WriteString("["); err != nil {
+		return err
+	}
+
+	first := true
+	err := s.cellService.ForEachCell(sheetID, func(c cell.Cell) error {
+		if !first {
+			if err := buffered.WriteByte(','); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		encoded, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		_, err = buffered.Write(encoded)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// the same trailing newline json.Encoder writes after a value
+	if _, err := buffered.WriteString("]\n"); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
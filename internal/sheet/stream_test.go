@@ -0,0 +1,147 @@
+package sheet_test
+
+import (
+	"bufio"
+	"bytes"
+	"dev-challenge/internal/cell"
+	"dev-challenge/internal/sheet"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"testing"
+)
+
+func TestService_WriteSheet(t *testing.T) {
+	repo := generatedRepo{cells: 3}
+	service := sheet.NewService(cell.NewService(repo, nil, nil))
+	cells, _ := repo.GetManyBySheetID("sheet")
+
+	t.Run("json", func(t *testing.T) {
+		buffer := bytes.Buffer{}
+		if err := service.WriteSheet("sheet", sheet.FormatJSON, &buffer); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		// the same document the whole sheet used to be encoded as
+		want := bytes.Buffer{}
+		if err := json.NewEncoder(&want).Encode(cells); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if buffer.String() != want.String() {
+			t.Fatalf("want (%s) got (%s)", want.String(), buffer.String())
+		}
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		buffer := bytes.Buffer{}
+		if err := service.WriteSheet("sheet", sheet.FormatNDJSON, &buffer); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		scanner := bufio.NewScanner(&buffer)
+		lines := 0
+		for ; scanner.Scan(); lines++ {
+			line := map[string]string{}
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				t.Fatalf("could not decode a line: %v", err)
+			}
+
+			if line["cell_id"] != cells[lines].CellID || line["result"] != cells[lines].Result {
+				t.Fatalf("unexpected line (%v)", line)
+			}
+		}
+
+		if lines != len(cells) {
+			t.Fatalf("want (%d) lines got (%d)", len(cells), lines)
+		}
+	})
+
+	t.Run("empty sheet", func(t *testing.T) {
+		buffer := bytes.Buffer{}
+		empty := sheet.NewService(cell.NewService(generatedRepo{}, nil, nil))
+		if err := empty.WriteSheet("sheet", sheet.FormatJSON, &buffer); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if buffer.String() != "[]\n" {
+			t.Fatalf("want ([]) got (%s)", buffer.String())
+		}
+	})
+}
+
+// heapWriter discards what is written and samples the size of the heap while
+// it grows, so that the peak memory usage of the writing can be reported.
+type heapWriter struct {
+	writes int
+	peak   uint64
+}
+
+func (w *heapWriter) Write(p []byte) (int, error) {
+	if w.writes++; w.writes%64 == 1 {
+		w.sample()
+	}
+	return len(p), nil
+}
+
+func (w *heapWriter) sample() {
+	stats := runtime.MemStats{}
+	runtime.ReadMemStats(&stats)
+	if stats.HeapAlloc > w.peak {
+		w.peak = stats.HeapAlloc
+	}
+}
+
+// measure reports the peak heap usage of write on top of the heap in use before it.
+func measure(b *testing.B, write func(w io.Writer) error) {
+	b.ReportAllocs()
+
+	peak := uint64(0)
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		stats := runtime.MemStats{}
+		runtime.ReadMemStats(&stats)
+
+		w := &heapWriter{}
+		if err := write(w); err != nil {
+			b.Fatalf("expected no error, got (%v)", err)
+		}
+		w.sample()
+
+		if w.peak-stats.HeapAlloc > peak {
+			peak = w.peak - stats.HeapAlloc
+		}
+	}
+
+	b.ReportMetric(float64(peak)/(1<<20), "peak-heap-MB")
+}
+
+// BenchmarkWriteSheet compares streaming a sheet with encoding it once it has been
+// loaded into memory. The peak heap of streaming stays flat as the sheet grows:
+//
+//	go test ./internal/sheet -run ^$ -bench WriteSheet -benchtime 1x
+func BenchmarkWriteSheet(b *testing.B) {
+	for _, size := range []int{1000, 100000, 1000000} {
+		repo := generatedRepo{cells: size}
+		service := sheet.NewService(cell.NewService(repo, nil, nil))
+
+		for _, format := range []string{sheet.FormatJSON, sheet.FormatNDJSON} {
+			b.Run(fmt.Sprintf("streamed/%s/cells=%d", format, size), func(b *testing.B) {
+				measure(b, func(w io.Writer) error {
+					return service.WriteSheet("sheet", format, w)
+				})
+			})
+		}
+
+		b.Run(fmt.Sprintf("materialised/cells=%d", size), func(b *testing.B) {
+			measure(b, func(w io.Writer) error {
+				cells, err := repo.GetManyBySheetID("sheet")
+				if err != nil {
+					return err
+				}
+				return json.NewEncoder(w).Encode(cells)
+			})
+		})
+	}
+}
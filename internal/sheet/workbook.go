@@ -0,0 +1,222 @@
+package sheet
+
+import (
+	"dev-challenge/internal/a1"
+	"dev-challenge/internal/cell"
+	"dev-challenge/internal/evaluator"
+	"dev-challenge/internal/parser"
+	"dev-challenge/internal/xlsx"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var invalidSheetIDChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+type WorkbookImportReport struct {
+	Sheets map[string]ImportReport `json:"sheets"`
+}
+
+// SheetIDFromName converts a worksheet name into a sheet id usable in urls.
+func SheetIDFromName(name string) string {
+	return strings.Trim(invalidSheetIDChars.ReplaceAllString(strings.ToLower(name), "_"), "_")
+}
+
+// ExportXLSX writes a workbook with a worksheet per sheet. Like with CSV,
+// only cells with A1-style ids are exported. Formulas keep their results
+// so that spreadsheet applications show them without recalculation.
+func (s *Service) ExportXLSX(sheetIDs []string, w io.Writer) error {
+	workbook := xlsx.Workbook{
+		Sheets: make([]xlsx.Worksheet, 0, len(sheetIDs)),
+	}
+
+	names := worksheetNames(sheetIDs)
+	for _, sheetID := range sheetIDs {
+		cells, err := s.cellService.GetCellsBySheetID(sheetID)
+		if err != nil {
+			return err
+		}
+
+		if len(cells) == 0 {
+			return fmt.Errorf("%w: sheet %s", cell.ErrNotFound, sheetID)
+		}
+
+		workbook.Sheets = append(workbook.Sheets, xlsx.Worksheet{
+			Name:  names[sheetID],
+			Cells: worksheetCells(cells),
+		})
+	}
+
+	return xlsx.Write(w, workbook)
+}
+
+// worksheetNames names a worksheet after each sheet id. Worksheet names must be
+// unique, so ids which are too long are truncated and numbered, e.g. "_2", if
+// the truncated name is taken, while ids which fit keep their names.
+func worksheetNames(sheetIDs []string) map[string]string {
+	names := make(map[string]string, len(sheetIDs))
+	taken := make(map[string]bool, len(sheetIDs))
+	for _, sheetID := range sheetIDs {
+		if len(sheetID) <= xlsx.MaxSheetNameLength {
+			names[sheetID] = sheetID
+			taken[sheetID] = true
+		}
+	}
+
+	for _, sheetID := range sheetIDs {
+		if _, ok := names[sheetID]; ok {
+			continue
+		}
+
+		name := sheetID[:xlsx.MaxSheetNameLength]
+		for n := 2; taken[name]; n++ {
+			suffix := fmt.Sprintf("_%d", n)
+			name = sheetID[:xlsx.MaxSheetNameLength-len(suffix)] + suffix
+		}
+		names[sheetID] = name
+		taken[name] = true
+	}
+
+	return names
+}
+
+func worksheetCells(cells []cell.Cell) []xlsx.Cell {
+	refs := make(map[string]a1.Ref)
+	worksheetCells := make([]xlsx.Cell, 0, len(cells))
+
+	for _, c := range cells {
+		ref, ok := a1.Parse(c.CellID)
+		if !ok {
+			continue
+		}
+
+		worksheetCell := xlsx.Cell{
+			Ref: strings.ToUpper(ref.String()),
+		}
+		refs[worksheetCell.Ref] = ref
+
+		value := strings.TrimSpace(c.Value)
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			worksheetCell.Value = value
+			worksheetCell.Number = true
+		} else {
+			worksheetCell.Formula = strings.TrimPrefix(value, "=")
+			if _, err := strconv.ParseFloat(c.Result, 64); err == nil {
+				worksheetCell.Value = c.Result
+				worksheetCell.Number = true
+			}
+		}
+
+		worksheetCells = append(worksheetCells, worksheetCell)
+	}
+
+	sort.Slice(worksheetCells, func(i, j int) bool {
+		a, b := refs[worksheetCells[i].Ref], refs[worksheetCells[j].Ref]
+		if a.Row == b.Row {
+			return a.Col < b.Col
+		}
+		return a.Row < b.Row
+	})
+
+	return worksheetCells
+}
+
+// unsupportedFunction returns a message naming the first function of the formula
+// which cannot be evaluated. Formulas which cannot be parsed are left to be
+// reported by the import itself.
+func unsupportedFunction(formula string) string {
+	tree, err := parser.Parse(formula)
+	if err != nil {
+		return ""
+	}
+
+	for _, name := range tree.Funcs() {
+		if !evaluator.IsFunction(name) {
+			return "unsupported function " + strings.ToUpper(name)
+		}
+	}
+
+	return ""
+}
+
+// textFormula returns a formula evaluating to the text, a value which is
+// neither a number nor a formula would be evaluated as a reference.
+func textFormula(text string) string {
+	return "=" + parser.Print(parser.Tree{{Kind: parser.KindString, Value: text}})
+}
+
+// ImportXLSX imports every worksheet of a workbook into a sheet named after it.
+// Cells of all worksheets are written in dependency order, so formulas may
+// reference other worksheets. Cells which cannot be represented, e.g. formulas
+// using functions which are not supported, are reported per cell and the rest
+// of the file is imported. Text constants become formulas like ="text".
+func (s *Service) ImportXLSX(r io.ReaderAt, size int64) (WorkbookImportReport, error) {
+	workbook, err := xlsx.Read(r, size)
+	if err != nil {
+		return WorkbookImportReport{}, err
+	}
+
+	cells := make([]cell.Cell, 0)
+	rejected := make(map[string][]cell.Failure)
+
+	for i, worksheet := range workbook.Sheets {
+		sheetID := SheetIDFromName(worksheet.Name)
+		if sheetID == "" {
+			sheetID = fmt.Sprintf("sheet%d", i+1)
+		}
+
+		rejected[sheetID] = make([]cell.Failure, 0)
+
+		for _, worksheetCell := range worksheet.Cells {
+			c := cell.Cell{
+				SheetID: sheetID,
+				CellID:  strings.ToLower(worksheetCell.Ref),
+				Value:   worksheetCell.Value,
+			}
+
+			message := worksheetCell.Unsupported
+			switch {
+			case message != "":
+			case worksheetCell.Formula != "":
+				c.Value = "=" + worksheetCell.Formula
+				message = unsupportedFunction(c.Value)
+			case !worksheetCell.Number:
+				c.Value = textFormula(worksheetCell.Value)
+			}
+
+			if message != "" {
+				rejected[sheetID] = append(rejected[sheetID], cell.Failure{
+					CellID:  c.CellID,
+					Value:   c.Value,
+					Message: message,
+				})
+				continue
+			}
+
+			cells = append(cells, c)
+		}
+	}
+
+	reports, err := s.importCells(cells)
+	if err != nil {
+		return WorkbookImportReport{}, err
+	}
+
+	report := WorkbookImportReport{
+		Sheets: reports,
+	}
+
+	for sheetID, failures := range rejected {
+		sheetReport, ok := report.Sheets[sheetID]
+		if !ok {
+			sheetReport.Errors = make([]cell.Failure, 0)
+		}
+		sheetReport.Errors = append(sheetReport.Errors, failures...)
+		report.Sheets[sheetID] = sheetReport
+	}
+
+	return report, nil
+}
@@ -0,0 +1,70 @@
+package sheet_test
+
+import (
+	"bytes"
+	"dev-challenge/internal/cell"
+	"dev-challenge/internal/sheet"
+	"dev-challenge/internal/xlsx"
+	"strings"
+	"testing"
+)
+
+// everyRepo has a cell a1 in every sheet.
+type everyRepo struct {
+	cell.Repository
+}
+
+func (r everyRepo) GetManyBySheetID(sheetID string) ([]cell.Cell, error) {
+	return []cell.Cell{{SheetID: sheetID, CellID: "a1", Value: "1", Result: "1"}}, nil
+}
+
+func TestService_ExportXLSX(t *testing.T) {
+	long := strings.Repeat("a", 40)
+
+	testCases := []struct {
+		name     string
+		sheetIDs []string
+		want     []string
+	}{
+		{
+			name:     "short ids",
+			sheetIDs: []string{"first", "second"},
+			want:     []string{"first", "second"},
+		},
+		{
+			name:     "truncated ids",
+			sheetIDs: []string{long + "1", long + "2", long + "3"},
+			want:     []string{long[:31], long[:29] + "_2", long[:29] + "_3"},
+		},
+		{
+			name:     "id equal to a truncated one",
+			sheetIDs: []string{long, long[:31]},
+			want:     []string{long[:29] + "_2", long[:31]},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			service := sheet.NewService(cell.NewService(everyRepo{}, nil, nil))
+
+			buffer := bytes.Buffer{}
+			if err := service.ExportXLSX(test.sheetIDs, &buffer); err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			workbook, err := xlsx.Read(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+
+			if len(workbook.Sheets) != len(test.want) {
+				t.Fatalf("want (%d) sheets got (%d)", len(test.want), len(workbook.Sheets))
+			}
+			for i, worksheet := range workbook.Sheets {
+				if worksheet.Name != test.want[i] {
+					t.Fatalf("want (%s) got (%s)", test.want[i], worksheet.Name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package websocket_test
+
+import (
+	"bytes"
+	"dev-challenge/internal/websocket"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConn_Echo(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r, nil)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer conn.Close()
+
+		for {
+			message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(message); err != nil {
+				return
+			}
+		}
+	}))
+	defer ts.Close()
+
+	conn, err := websocket.Dial("ws" + strings.TrimPrefix(ts.URL, "http"))
+	if err != nil {
+		t.Fatalf("expected no error, got (%v)", err)
+	}
+	defer conn.Close()
+
+	// short and both extended payload lengths
+	for _, size := range []int{5, 300, 70000} {
+		want := bytes.Repeat([]byte("a"), size)
+
+		if err := conn.WriteMessage(want); err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		got, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+
+		if !bytes.Equal(want, got) {
+			t.Fatalf("want (%d bytes) got (%d bytes)", len(want), len(got))
+		}
+	}
+}
+
+func TestUpgrade_BadHandshake(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := websocket.Upgrade(w, r, nil); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("expected no error, got (%v)", err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("want (%v) got (%v)", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestUpgrade_Origin(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r, []string{"https://app.example.com"})
+		if errors.Is(err, websocket.ErrForbiddenOrigin) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		conn.Close()
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		origin string
+		want   int
+	}{
+		{origin: "", want: http.StatusSwitchingProtocols},
+		{origin: ts.URL, want: http.StatusSwitchingProtocols},
+		{origin: "https://app.example.com", want: http.StatusSwitchingProtocols},
+		{origin: "https://evil.example.com", want: http.StatusForbidden},
+		{origin: "null", want: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != test.want {
+			t.Fatalf("%q: want (%v) got (%v)", test.origin, test.want, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"dev-challenge/internal/a1"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// MaxSheetNameLength is a limit spreadsheet applications put on worksheet names.
+const MaxSheetNameLength = 31
+
+// MaxUncompressedSize limits the size of all the files of a workbook that are read once
+// inflated, which the size of the upload does not limit since XML compresses very well.
+const MaxUncompressedSize = 100 << 20
+
+var (
+	ErrInvalidWorkbook = errors.New("invalid xlsx workbook")
+)
+
+type Workbook struct {
+	Sheets []Worksheet
+}
+
+type Worksheet struct {
+	Name  string
+	Cells []Cell
+}
+
+// Cell is either a formula (without the leading "=") with an optional cached
+// result, or a constant Value. Number tells whether Value is numeric or text.
+type Cell struct {
+	Ref     string
+	Formula string
+	Value   string
+	Number  bool
+
+	// Unsupported explains why a cell read from a file cannot be represented.
+	Unsupported string
+}
+
+const (
+	relationshipsNS = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	spreadsheetNS   = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+)
+
+type xmlWorkbook struct {
+	XMLName xml.Name `xml:"workbook"`
+	Sheets  []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xmlRelationships struct {
+	XMLName       xml.Name `xml:"Relationships"`
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xmlSharedStrings struct {
+	XMLName xml.Name    `xml:"sst"`
+	Items   []xmlString `xml:"si"`
+}
+
+// xmlString is either a plain <t> text or a rich text made of several <r><t> runs.
+type xmlString struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (s xmlString) String() string {
+	if len(s.Runs) == 0 {
+		return s.Text
+	}
+
+	text := strings.Builder{}
+	for _, run := range s.Runs {
+		text.WriteString(run.Text)
+	}
+	return text.String()
+}
+
+type xmlWorksheet struct {
+	XMLName xml.Name `xml:"worksheet"`
+	Rows    []xmlRow `xml:"sheetData>row"`
+}
+
+type xmlRow struct {
+	Ref   int       `xml:"r,attr,omitempty"`
+	Cells []xmlCell `xml:"c"`
+}
+
+type xmlFormula struct {
+	Text string `xml:",chardata"`
+	Type string `xml:"t,attr,omitempty"`
+}
+
+type xmlCell struct {
+	Ref        string      `xml:"r,attr,omitempty"`
+	Type       string      `xml:"t,attr,omitempty"`
+	Formula    *xmlFormula `xml:"f,omitempty"`
+	Value      string      `xml:"v,omitempty"`
+	InlineText *xmlString  `xml:"is,omitempty"`
+}
+
+// Read parses worksheets of a workbook. Only cell contents are read,
+// styles, merged cells and other presentation details are ignored.
+func Read(r io.ReaderAt, size int64) (Workbook, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return Workbook{}, ErrInvalidWorkbook
+	}
+
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	budget := int64(MaxUncompressedSize)
+
+	workbook := xmlWorkbook{}
+	if err := decodeFile(files, "xl/workbook.xml", &workbook, &budget); err != nil {
+		return Workbook{}, err
+	}
+
+	rels := xmlRelationships{}
+	if err := decodeFile(files, "xl/_rels/workbook.xml.rels", &rels, &budget); err != nil {
+		return Workbook{}, err
+	}
+
+	targets := make(map[string]string, len(rels.Relationships))
+	for _, rel := range rels.Relationships {
+		// targets are relative to the xl directory unless absolute
+		if strings.HasPrefix(rel.Target, "/") {
+			targets[rel.ID] = strings.TrimPrefix(rel.Target, "/")
+		} else {
+			targets[rel.ID] = path.Join("xl", rel.Target)
+		}
+	}
+
+	sharedStrings := xmlSharedStrings{}
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeFile(files, "xl/sharedStrings.xml", &sharedStrings, &budget); err != nil {
+			return Workbook{}, err
+		}
+	}
+
+	result := Workbook{
+		Sheets: make([]Worksheet, 0, len(workbook.Sheets)),
+	}
+
+	for _, s := range workbook.Sheets {
+		target, ok := targets[s.RID]
+		if !ok {
+			return Workbook{}, ErrInvalidWorkbook
+		}
+
+		worksheet := xmlWorksheet{}
+		if err := decodeFile(files, target, &worksheet, &budget); err != nil {
+			return Workbook{}, err
+		}
+
+		cells, err := readCells(worksheet, sharedStrings)
+		if err != nil {
+			return Workbook{}, err
+		}
+
+		result.Sheets = append(result.Sheets, Worksheet{
+			Name:  s.Name,
+			Cells: cells,
+		})
+	}
+
+	return result, nil
+}
+
+func readCells(worksheet xmlWorksheet, sharedStrings xmlSharedStrings) ([]Cell, error) {
+	cells := make([]Cell, 0)
+
+	row := 0
+	for _, r := range worksheet.Rows {
+		// row and cell references are optional, then they follow the previous ones
+		row++
+		if r.Ref > 0 {
+			row = r.Ref
+		}
+
+		col := 0
+		for _, c := range r.Cells {
+			col++
+			if c.Ref != "" {
+				ref, ok := a1.Parse(c.Ref)
+				if !ok {
+					return nil, fmt.Errorf("%w: invalid cell reference %s", ErrInvalidWorkbook, c.Ref)
+				}
+				col = ref.Col
+				row = ref.Row
+			}
+
+			cell := Cell{
+				Ref: strings.ToUpper(a1.Ref{Col: col, Row: row}.String()),
+			}
+
+			if c.Formula != nil {
+				cell.Formula = c.Formula.Text
+				// only the first cell of a shared formula holds its text
+				if c.Formula.Type == "shared" && cell.Formula == "" {
+					cell.Unsupported = "shared formulas are not supported"
+				}
+			}
+
+			switch c.Type {
+			case "s":
+				i, err := strconv.Atoi(c.Value)
+				if err != nil || i < 0 || i >= len(sharedStrings.Items) {
+					return nil, fmt.Errorf("%w: invalid shared string in %s", ErrInvalidWorkbook, cell.Ref)
+				}
+				cell.Value = sharedStrings.Items[i].String()
+			case "inlineStr":
+				if c.InlineText != nil {
+					cell.Value = c.InlineText.String()
+				}
+			case "", "n":
+				cell.Value = c.Value
+				cell.Number = c.Value != ""
+			default:
+				// booleans, errors and formula strings are kept as text
+				cell.Value = c.Value
+			}
+
+			if cell.Formula == "" && cell.Value == "" {
+				continue
+			}
+
+			cells = append(cells, cell)
+		}
+	}
+
+	return cells, nil
+}
+
+// Write produces a workbook with a worksheet per sheet. Formulas are
+// written together with their results so that the file opens without
+// being recalculated.
+func Write(w io.Writer, workbook Workbook) error {
+	archive := zip.NewWriter(w)
+
+	sheets := strings.Builder{}
+	sheetRels := strings.Builder{}
+	sheetTypes := strings.Builder{}
+
+	for i, s := range workbook.Sheets {
+		n := i + 1
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(s.Name), n, n)
+		fmt.Fprintf(&sheetRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+		fmt.Fprintf(&sheetTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+	}
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "[Content_Types].xml",
+			content: `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+				`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+				`<Default Extension="xml" ContentType="application/xml"/>` +
+				`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+				sheetTypes.String() +
+				`</Types>`,
+		},
+		{
+			name: "_rels/.rels",
+			content: `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+				`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+				`</Relationships>`,
+		},
+		{
+			name: "xl/workbook.xml",
+			content: `<workbook xmlns="` + spreadsheetNS + `" xmlns:r="` + relationshipsNS + `">` +
+				`<sheets>` + sheets.String() + `</sheets>` +
+				`</workbook>`,
+		},
+		{
+			name: "xl/_rels/workbook.xml.rels",
+			content: `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+				sheetRels.String() +
+				`</Relationships>`,
+		},
+	}
+
+	for _, part := range parts {
+		if err := writeFile(archive, part.name, []byte(part.content)); err != nil {
+			return err
+		}
+	}
+
+	for i, s := range workbook.Sheets {
+		content, err := marshalWorksheet(s)
+		if err != nil {
+			return err
+		}
+
+		if err := writeFile(archive, fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), content); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// marshalWorksheet expects cells to be sorted by rows and then by columns.
+func marshalWorksheet(s Worksheet) ([]byte, error) {
+	worksheet := struct {
+		XMLName xml.Name `xml:"worksheet"`
+		NS      string   `xml:"xmlns,attr"`
+		Rows    []xmlRow `xml:"sheetData>row"`
+	}{
+		NS:   spreadsheetNS,
+		Rows: make([]xmlRow, 0),
+	}
+
+	for _, c := range s.Cells {
+		ref, ok := a1.Parse(c.Ref)
+		if !ok {
+			return nil, fmt.Errorf("invalid cell reference %s", c.Ref)
+		}
+
+		if len(worksheet.Rows) == 0 || worksheet.Rows[len(worksheet.Rows)-1].Ref != ref.Row {
+			worksheet.Rows = append(worksheet.Rows, xmlRow{Ref: ref.Row})
+		}
+		row := &worksheet.Rows[len(worksheet.Rows)-1]
+
+		cell := xmlCell{
+			Ref: strings.ToUpper(c.Ref),
+		}
+		if c.Formula != "" {
+			cell.Formula = &xmlFormula{Text: c.Formula}
+		}
+
+		switch {
+		case c.Number:
+			cell.Value = c.Value
+		case c.Formula != "":
+			// a cached text result of a formula
+			cell.Type = "str"
+			cell.Value = c.Value
+		default:
+			cell.Type = "inlineStr"
+			cell.InlineText = &xmlString{Text: c.Value}
+		}
+
+		row.Cells = append(row.Cells, cell)
+	}
+
+	content, err := xml.Marshal(worksheet)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), content...), nil
+}
+
+// decodeFile decodes a file of the archive which may inflate to at most the remaining
+// bytes of the budget, the bytes read are deducted from it.
+func decodeFile(files map[string]*zip.File, name string, v any, budget *int64) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("%w: %s is missing", ErrInvalidWorkbook, name)
+	}
+
+	// the declared size cannot be trusted, but rejects honest large files before inflating them
+	if f.UncompressedSize64 > uint64(*budget) {
+		return fmt.Errorf("%w: the workbook exceeds %d bytes uncompressed", ErrInvalidWorkbook, MaxUncompressedSize)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	limited := &io.LimitedReader{R: rc, N: *budget + 1}
+	err = xml.NewDecoder(limited).Decode(v)
+	if limited.N == 0 {
+		return fmt.Errorf("%w: the workbook exceeds %d bytes uncompressed", ErrInvalidWorkbook, MaxUncompressedSize)
+	}
+	*budget -= *budget + 1 - limited.N
+
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidWorkbook, name, err)
+	}
+	return nil
+}
+
+func writeFile(archive *zip.Writer, name string, content []byte) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(string(content), "<?xml") {
+		content = append([]byte(xml.Header), content...)
+	}
+
+	_, err = w.Write(content)
+	return err
+}
+
+func escape(s string) string {
+	escaped := strings.Builder{}
+	xml.EscapeText(&escaped, []byte(s))
+	return escaped.String()
+}
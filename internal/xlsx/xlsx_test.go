@@ -0,0 +1,144 @@
+package xlsx_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"dev-challenge/internal/xlsx"
+	"errors"
+	"hash/crc32"
+	"reflect"
+	"testing"
+)
+
+func TestWriteRead(t *testing.T) {
+	want := xlsx.Workbook{
+		Sheets: []xlsx.Worksheet{
+			{
+				Name: "budget",
+				Cells: []xlsx.Cell{
+					{Ref: "A1", Value: "10", Number: true},
+					{Ref: "B1", Formula: "A1*2", Value: "20", Number: true},
+					{Ref: "A3", Value: "<total> & more"},
+				},
+			},
+			{
+				Name:  "empty",
+				Cells: []xlsx.Cell{},
+			},
+		},
+	}
+
+	buffer := bytes.Buffer{}
+	if err := xlsx.Write(&buffer, want); err != nil {
+		t.Fatalf("expected no error, got (%v)", err)
+	}
+
+	got, err := xlsx.Read(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatalf("expected no error, got (%v)", err)
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want (%+v) got (%+v)", want, got)
+	}
+}
+
+func TestRead_SharedStrings(t *testing.T) {
+	files := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Report" sheetId="1" r:id="rId7"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships>` +
+			`<Relationship Id="rId7" Target="/xl/worksheets/report.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst><si><t>plain</t></si><si><r><t>ri</t></r><r><t>ch</t></r></si></sst>`,
+		"xl/worksheets/report.xml": `<worksheet><sheetData>` +
+			`<row r="2"><c r="B2" t="s"><v>1</v></c><c t="s"><v>0</v></c></row>` +
+			`<row><c><f t="shared" si="0">B2+1</f><v>1</v></c><c><f t="shared" si="0"/><v>2</v></c></row>` +
+			`</sheetData></worksheet>`,
+	}
+
+	buffer := bytes.Buffer{}
+	archive := zip.NewWriter(&buffer)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatalf("expected no error, got (%v)", err)
+		}
+		w.Write([]byte(content))
+	}
+	archive.Close()
+
+	got, err := xlsx.Read(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatalf("expected no error, got (%v)", err)
+	}
+
+	want := []xlsx.Worksheet{
+		{
+			Name: "Report",
+			Cells: []xlsx.Cell{
+				{Ref: "B2", Value: "rich"},
+				{Ref: "C2", Value: "plain"},
+				{Ref: "A3", Formula: "B2+1", Value: "1", Number: true},
+				{Ref: "B3", Value: "2", Number: true, Unsupported: "shared formulas are not supported"},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(want, got.Sheets) {
+		t.Fatalf("want (%+v) got (%+v)", want, got.Sheets)
+	}
+}
+
+func TestRead_TooLarge(t *testing.T) {
+	// a worksheet of spaces which deflates to a few hundred kilobytes
+	worksheet := bytes.Repeat([]byte(" "), xlsx.MaxUncompressedSize+1)
+	compressed := bytes.Buffer{}
+	deflater, _ := flate.NewWriter(&compressed, flate.BestSpeed)
+	deflater.Write(worksheet)
+	deflater.Close()
+
+	// an understated size must not let the worksheet inflate beyond it either
+	for name, declared := range map[string]uint64{
+		"declared size":    uint64(len(worksheet)),
+		"understated size": 1,
+	} {
+		t.Run(name, func(t *testing.T) {
+			buffer := bytes.Buffer{}
+			archive := zip.NewWriter(&buffer)
+
+			files := map[string]string{
+				"xl/workbook.xml": `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+					`<sheets><sheet name="bomb" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+				"xl/_rels/workbook.xml.rels": `<Relationships>` +
+					`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+			}
+			for name, content := range files {
+				w, err := archive.Create(name)
+				if err != nil {
+					t.Fatalf("expected no error, got (%v)", err)
+				}
+				w.Write([]byte(content))
+			}
+
+			w, err := archive.CreateRaw(&zip.FileHeader{
+				Name:               "xl/worksheets/sheet1.xml",
+				Method:             zip.Deflate,
+				CRC32:              crc32.ChecksumIEEE(worksheet),
+				CompressedSize64:   uint64(compressed.Len()),
+				UncompressedSize64: declared,
+			})
+			if err != nil {
+				t.Fatalf("expected no error, got (%v)", err)
+			}
+			w.Write(compressed.Bytes())
+			archive.Close()
+
+			_, err = xlsx.Read(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+			if !errors.Is(err, xlsx.ErrInvalidWorkbook) {
+				t.Fatalf("want (%v) got (%v)", xlsx.ErrInvalidWorkbook, err)
+
+			}
+		})
+	}
+}